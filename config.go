@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// untrustedOptions are the options a config file in the scanned directory can't set:
+// whoever wrote the repository could otherwise have its dump written or uploaded where
+// they like, pull in files from outside it or hidden ones like .git/config, hand git
+// arguments of their choosing, or skip the confirmation prompt.
+var untrustedOptions = map[string]bool{
+	"o":                    true,
+	"tree-json":            true,
+	"upload":               true,
+	"no-follow-outside":    true,
+	"include-hidden":       true,
+	"hidden-allow":         true,
+	"changed-since-commit": true,
+	"content-ref":          true,
+	"from-file":            true,
+	"ignore":               true,
+	"cb2mdignore":          true,
+	"yes":                  true,
+}
+
+// findConfig locates the config file: name itself if absolute, otherwise name inside
+// the scanned directory, falling back to the home directory. It returns "" if none exists;
+// local reports whether the file is the one in the scanned directory (unless that's the
+// home directory), which can't set untrustedOptions.
+func findConfig(rootDir, name string) (path string, local bool) {
+	if name == "" || filepath.IsAbs(name) {
+		if info, err := os.Stat(name); err == nil && !info.IsDir() {
+			return name, false
+		}
+		return "", false
+	}
+	inRoot := filepath.Join(rootDir, name)
+	var inHome string
+	if home, err := os.UserHomeDir(); err == nil {
+		inHome = filepath.Join(home, name)
+	}
+	for _, c := range []string{inRoot, inHome} {
+		if info, err := os.Stat(c); c != "" && err == nil && !info.IsDir() {
+			return c, c == inRoot && !sameFile(inRoot, inHome)
+		}
+	}
+	return "", false
+}
+
+// sameFile reports whether paths a and b are the same existing file.
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
+
+// applyConfig reads flag defaults from a config file and sets them on fs, skipping any flag
+// that was given explicitly on the command line. The file holds "name = value" lines, where
+// name is a flag name; lines before the first section apply to every run, and lines in a
+// "[profile NAME]" section only apply when that profile is selected, overriding the former:
+//
+//	# always honor .gitignore
+//	gitignore = true
+//
+//	[profile llm]
+//	strip-license = true
+//	preview = 4k
+//
+// Blank lines and lines starting with "#" or ";" are ignored. A local file (see findConfig)
+// setting any of untrustedOptions is an error.
+func applyConfig(fs *flag.FlagSet, path, profile string, local bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	type setting struct {
+		name, value string
+		line        int
+	}
+	var defaults, selected []setting
+	profiles := make(map[string]bool)
+
+	section := "" // "" for the top level, else the profile name
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			fields := strings.Fields(strings.Trim(line, "[]"))
+			if len(fields) != 2 || fields[0] != "profile" {
+				return fmt.Errorf("%s:%d: expected a [profile NAME] section, got %s", path, lineNo, line)
+			}
+			section = fields[1]
+			profiles[section] = true
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected name = value, got %s", path, lineNo, line)
+		}
+		s := setting{name: strings.TrimSpace(name), value: strings.TrimSpace(value), line: lineNo}
+		if fs.Lookup(s.name) == nil {
+			return fmt.Errorf("%s:%d: unknown option %q", path, lineNo, s.name)
+		}
+		if local && untrustedOptions[s.name] {
+			return fmt.Errorf("%s:%d: %s can't be set in a config file in the scanned directory; give it on the command line or in ~/%s",
+				path, lineNo, s.name, filepath.Base(path))
+		}
+		switch section {
+		case "":
+			defaults = append(defaults, s)
+		case profile:
+			selected = append(selected, s)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if profile != "" && !profiles[profile] {
+		return fmt.Errorf("%s: no [profile %s] section", path, profile)
+	}
+
+	// Explicit command-line flags always win
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for _, s := range append(defaults, selected...) {
+		if explicit[s.name] {
+			continue
+		}
+		if err := fs.Set(s.name, s.value); err != nil {
+			return fmt.Errorf("%s:%d: invalid value for %s: %v", path, s.line, s.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pekhota/cb2md/pkg/cb2md"
+)
+
+// TestApplyConfigProfile checks that top-level defaults and the selected profile apply,
+// the other profile doesn't, and explicit flags still win.
+func TestApplyConfigProfile(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{".cb2mdrc": `
+# applies to every run
+gitignore = true
+sort = size
+
+[profile llm]
+strip-license = true
+preview = 4k
+sort = name
+
+[profile review]
+tree-sizes = true
+list-only = true
+`})
+
+	var opts cb2md.Options
+	fs := flag.NewFlagSet("cb2md", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineFlags(fs, &opts)
+	if err := fs.Parse([]string{"-preview=1k", tmp}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	path, local := findConfig(tmp, ".cb2mdrc")
+	if path != filepath.Join(tmp, ".cb2mdrc") || !local {
+		t.Fatalf("findConfig = %q, %v; want the file in the scanned directory", path, local)
+	}
+	if err := applyConfig(fs, path, "llm", local); err != nil {
+		t.Fatalf("applyConfig error: %v", err)
+	}
+
+	if !opts.Gitignore {
+		t.Errorf("expected top-level default gitignore = true")
+	}
+	if !opts.StripLicense || opts.SortBy != "name" {
+		t.Errorf("expected the llm profile to apply (strip-license, sort = name), got %+v", opts)
+	}
+	if opts.Preview != 1024 {
+		t.Errorf("explicit -preview=1k should win over the profile, got %d", opts.Preview)
+	}
+	if opts.TreeSizes || opts.ListOnly {
+		t.Errorf("the review profile should not apply, got %+v", opts)
+	}
+}
+
+// TestApplyConfigErrors checks that unknown profiles and options are reported.
+func TestApplyConfigErrors(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"good.rc": "[profile llm]\nlist-only = true\n",
+		"bad.rc":  "no-such-flag = 1\n",
+	})
+
+	for _, tt := range []struct {
+		file, profile string
+	}{
+		{"good.rc", "missing"},
+		{"bad.rc", ""},
+	} {
+		var opts cb2md.Options
+		fs := flag.NewFlagSet("cb2md", flag.ContinueOnError)
+		defineFlags(fs, &opts)
+		if err := applyConfig(fs, filepath.Join(tmp, tt.file), tt.profile, false); err == nil {
+			t.Errorf("applyConfig(%s, %q) succeeded; want an error", tt.file, tt.profile)
+		}
+	}
+
+	// The stringList flag accumulates values from the config too
+	var opts cb2md.Options
+	fs := flag.NewFlagSet("cb2md", flag.ContinueOnError)
+	defineFlags(fs, &opts)
+	writeFiles(t, tmp, map[string]string{"list.rc": "ignore-pattern = *.log\nignore-pattern = *.tmp\n"})
+	if err := applyConfig(fs, filepath.Join(tmp, "list.rc"), "", false); err != nil {
+		t.Fatalf("applyConfig error: %v", err)
+	}
+	if want := []string{"*.log", "*.tmp"}; !reflect.DeepEqual(opts.IgnorePatterns, want) {
+		t.Errorf("ignore patterns got %v, want %v", opts.IgnorePatterns, want)
+	}
+}
+
+// TestApplyConfigUntrusted checks that a config file in the scanned directory can't set
+// where the output goes, or widen what's read, while the same settings in the home
+// directory's config file apply.
+func TestApplyConfigUntrusted(t *testing.T) {
+	home, root := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	writeFiles(t, home, map[string]string{".cb2mdrc": "o = " + filepath.Join(home, "out.md") + "\n"})
+
+	// The home directory's file applies when the scanned directory has none
+	path, local := findConfig(root, ".cb2mdrc")
+	if path != filepath.Join(home, ".cb2mdrc") || local {
+		t.Fatalf("findConfig = %q, %v; want the home directory's file", path, local)
+	}
+	var opts cb2md.Options
+	fs := flag.NewFlagSet("cb2md", flag.ContinueOnError)
+	defineFlags(fs, &opts)
+	if err := applyConfig(fs, path, "", local); err != nil {
+		t.Fatalf("applyConfig error: %v", err)
+	}
+	if opts.OutFile != filepath.Join(home, "out.md") {
+		t.Errorf("expected -o from the home directory's config, got %q", opts.OutFile)
+	}
+
+	// Nor is it local when the home directory is the one scanned
+	if _, local := findConfig(home, ".cb2mdrc"); local {
+		t.Errorf("findConfig in the home directory says it's local")
+	}
+
+	for _, setting := range []string{
+		"o = /tmp/stolen.md",
+		"tree-json = /tmp/tree.json",
+		"upload = https://example.com",
+		"no-follow-outside = false",
+		"include-hidden = true",
+		"[profile x]\nhidden-allow = .env",
+		"changed-since-commit = --output=/tmp/pwned",
+		"content-ref = HEAD",
+		"from-file = /etc/passwd",
+		"ignore = /etc/passwd",
+		"cb2mdignore = /etc/passwd",
+		"yes = true",
+	} {
+		writeFiles(t, root, map[string]string{".cb2mdrc": "gitignore = true\n" + setting + "\n"})
+		path, local := findConfig(root, ".cb2mdrc")
+		if path != filepath.Join(root, ".cb2mdrc") || !local {
+			t.Fatalf("findConfig = %q, %v; want the file in the scanned directory", path, local)
+		}
+		var opts cb2md.Options
+		fs := flag.NewFlagSet("cb2md", flag.ContinueOnError)
+		defineFlags(fs, &opts)
+		fs.Bool("yes", false, "") // registered by main rather than defineFlags
+		if err := applyConfig(fs, path, "", local); err == nil || !strings.Contains(err.Error(), "can't be set in a config file in the scanned directory") {
+			t.Errorf("applyConfig with %q: got error %v; want it refused", setting, err)
+		}
+	}
+}
@@ -7,328 +7,344 @@ import (
 	"io"
 	"log"
 	"os"
-	"path/filepath"
-	"sort"
+	"runtime"
+	"runtime/debug"
+	"strconv"
 	"strings"
-)
-
-// Node represents a file or directory in our tree structure.
-type Node struct {
-	Name     string
-	IsDir    bool
-	Children []*Node
-}
-
-// includedFiles holds only those files we want to show in the “Full File List” section.
-var includedFiles []string
-
-// skipContentPatterns: these appear in the ASCII tree but won't show in the file list.
-// (Images, lock files, etc.) We use case-insensitive matching on the *base filename*.
-var skipContentPatterns = []string{
-	"*.png", "*.jpg", "*.jpeg", "*.gif", "*.svg", "*.webp",
-	"package-lock.json", "composer.lock",
-}
+	"time"
 
-// We'll store the absolute path to the output file so we can skip it in the directory walk.
-var absOutFile string
+	"github.com/pekhota/cb2md/pkg/cb2md"
+)
 
 func main() {
-	var ignoreFile string
-	var outFile string
+	var opts cb2md.Options
+	defineFlags(flag.CommandLine, &opts)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		opts.Version = info.Main.Version
+	}
 
-	flag.StringVar(&ignoreFile, "ignore", ".ignore", "Path to ignore file (glob patterns). Default is .ignore")
-	flag.StringVar(&outFile, "o", "", "Output file path (if empty, prints to stdout). If ends with .md, we also print file contents.")
+	var configFile, profile, pathsFile string
+	var changelog, yes, fromStdin bool
+	flag.BoolVar(&yes, "yes", false, "Don't ask for confirmation before writing an output larger than -confirm-over.")
+	flag.BoolVar(&fromStdin, "from-stdin", false, "Only include the files listed (one relative path per line) on stdin, as with -from-file -; e.g. git diff --name-only | cb2md -from-stdin .")
+	flag.BoolVar(&changelog, "changelog", false, "Compare two -tree-json dumps, given instead of directories (OLD.json NEW.json), and print a Markdown changelog of added, removed and renamed files.")
+	flag.StringVar(&pathsFile, "tree-from-paths", "", "Print the tree of the relative paths listed (one per line) in this `FILE`, or - for stdin, without scanning anything; e.g. git ls-files | cb2md -tree-from-paths -")
+	flag.StringVar(&configFile, "config", ".cb2mdrc", "Config file with flag defaults and named profiles (relative paths are looked up in the scanned directory, then $HOME; one in the scanned directory can't set -o, -tree-json, -upload, -no-follow-outside, -include-hidden, -hidden-allow, -changed-since-commit, -content-ref, -from-file, -ignore, -cb2mdignore or -yes).")
+	flag.StringVar(&profile, "profile", "", "Apply the flag defaults of this named profile from the config file.")
 	flag.Parse()
 
-	if flag.NArg() < 1 {
-		log.Fatalf("Usage: go run main.go [-ignore=.ignore] [-o=tree.md] /path/to/directory")
+	// Paths-only mode draws the tree of a list of paths, without touching the disk
+	if pathsFile != "" {
+		if err := printTreeFromPaths(pathsFile, opts); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	// Root directory to scan
-	rootDir := flag.Arg(0)
-
-	// Convert rootDir to absolute path
-	absRoot, err := filepath.Abs(rootDir)
-	if err != nil {
-		log.Fatalf("Error getting absolute path: %v\n", err)
+	if flag.NArg() < 1 {
+		log.Fatalf("Usage: cb2md [options] /path/to/directory... (see -h for the list of options)")
 	}
 
-	// If user specified an output file, get its absolute path.
-	// We'll skip it during our directory walk so it doesn't get re-included.
-	if outFile != "" {
-		absOutFile, err = filepath.Abs(outFile)
+	// Changelog mode compares two earlier dumps instead of scanning anything
+	if changelog {
+		if flag.NArg() != 2 {
+			log.Fatalf("Usage: cb2md -changelog OLD.json NEW.json")
+		}
+		oldTree, err := cb2md.ReadTreeJSON(flag.Arg(0))
 		if err != nil {
-			log.Fatalf("Error getting absolute output file path: %v\n", err)
+			log.Fatal(err)
 		}
-	}
-
-	// Load ignore patterns (if any) from the .ignore file
-	ignorePatterns := loadIgnorePatterns(filepath.Join(absRoot, ignoreFile))
-
-	// Maintain a map of visited directories (real paths) to prevent loops
-	visited := make(map[string]bool)
-
-	// Build in-memory tree
-	rootNode, err := buildTree(absRoot, absRoot, ignorePatterns, visited)
-	if err != nil {
-		log.Fatalf("Error building tree: %v\n", err)
-	}
-
-	// Sort the list of included files so we have a predictable order
-	sort.Strings(includedFiles)
-
-	// Determine output destination (stdout or file)
-	var w io.Writer = os.Stdout
-	if outFile != "" {
-		// Explicitly open with O_TRUNC to overwrite if it exists
-		f, err := os.OpenFile(outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		newTree, err := cb2md.ReadTreeJSON(flag.Arg(1))
 		if err != nil {
-			log.Fatalf("Error creating output file '%s': %v", outFile, err)
+			log.Fatal(err)
 		}
-		defer f.Close()
-		w = f
+		cb2md.WriteChangelog(os.Stdout, oldTree, newTree)
+		return
 	}
 
-	// Check if we need Markdown fences for the ASCII tree
-	outIsMarkdown := strings.HasSuffix(strings.ToLower(outFile), ".md") || outFile == ""
-
-	// Print the ASCII tree
-	if outIsMarkdown && outFile != "" {
-		// If user specifically gave a .md outFile, wrap the tree in triple backticks
-		fmt.Fprintln(w, "```")
-		printTree(rootNode, "", true, w)
-		fmt.Fprintln(w, "```")
-	} else {
-		// Otherwise just print the ASCII tree as plain text
-		printTree(rootNode, "", true, w)
+	// Fill in anything not given on the command line from the config file
+	configPath, local := findConfig(flag.Arg(0), configFile)
+	if configPath == "" && profile != "" {
+		log.Fatalf("Profile %q requested, but no config file %s was found", profile, configFile)
 	}
-
-	// If it's Markdown, we also print each file’s path + contents
-	if outIsMarkdown {
-		// A heading for file list
-		fmt.Fprintln(w)
-		fmt.Fprintln(w, "## Full File List")
-		fmt.Fprintln(w)
-
-		for _, fpath := range includedFiles {
-			// Print the file’s path
-			fmt.Fprintf(w, "### %s\n", fpath)
-
-			// Determine language for code block
-			language := guessLanguage(fpath)
-			fmt.Fprintf(w, "```%s\n", language)
-
-			// Print file contents
-			err := printFileContents(filepath.Join(absRoot, fpath), w)
-			if err != nil {
-				fmt.Fprintf(w, "Error reading file: %v\n", err)
-			}
-			fmt.Fprintln(w, "```")
-			fmt.Fprintln(w)
+	if configPath != "" {
+		if err := applyConfig(flag.CommandLine, configPath, profile, local); err != nil {
+			log.Fatal(err)
 		}
 	}
-}
 
-// buildTree recursively walks directories to build a tree of Nodes.
-// Also populates "includedFiles" for any files we keep.
-func buildTree(basePath, currentPath string, ignorePatterns []string, visited map[string]bool) (*Node, error) {
-	// Resolve symbolic links to prevent infinite loops
-	realPath, err := filepath.EvalSymlinks(currentPath)
-	if err != nil {
-		return nil, err
+	// Markdown (the tree plus file contents) goes to stdout or a .md file; anything else only gets the tree,
+	// unless the contents are asked for in another format
+	opts.Markdown = opts.OutFile == "" || strings.HasSuffix(strings.ToLower(opts.OutFile), ".md") || opts.Format != "md"
+	opts.Stderr = os.Stderr
+	if fromStdin {
+		opts.FromFile = "-"
 	}
 
-	// Skip if it's our output file
-	if absOutFile != "" && realPath == absOutFile {
-		return nil, nil
+	// Only ask about huge outputs if someone is there to answer
+	if !yes && isTerminal(os.Stdin) {
+		opts.Confirm = func(question string) bool { return askYesNo(os.Stdin, os.Stderr, question) }
 	}
 
-	// If we've already seen this real path, skip
-	if visited[realPath] {
-		return nil, nil
-	}
-	visited[realPath] = true
-
-	info, err := os.Stat(currentPath)
-	if err != nil {
-		return nil, err
-	}
-
-	node := &Node{
-		Name:  info.Name(),
-		IsDir: info.IsDir(),
+	if err := cb2md.RunRoots(flag.Args(), opts, os.Stdout); err != nil {
+		log.Fatal(err)
 	}
+}
 
-	if info.IsDir() {
-		// If it's a directory, read its contents
-		entries, err := os.ReadDir(currentPath)
+// printTreeFromPaths prints to stdout the tree of the paths listed in the file at path,
+// or on stdin if path is "-".
+func printTreeFromPaths(path string, opts cb2md.Options) error {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		defer f.Close()
+		r = f
+	}
+	root, err := cb2md.TreeFromPaths(r, ".")
+	if err != nil {
+		return err
+	}
+	cb2md.PrintTree(os.Stdout, root, opts)
+	return nil
+}
 
-		for _, e := range entries {
-			name := e.Name()
-
-			// Skip hidden (files/folders starting with ".")
-			if strings.HasPrefix(name, ".") {
-				continue
-			}
-
-			childPath := filepath.Join(currentPath, name)
-			relPath, err := filepath.Rel(basePath, childPath)
-			if err != nil {
-				return nil, err
-			}
-
-			// Check .ignore patterns (full path, case-sensitive by default).
-			if matchesAnyPattern(relPath, ignorePatterns) {
-				continue
-			}
-
-			childNode, err := buildTree(basePath, childPath, ignorePatterns, visited)
-			if err != nil {
-				return nil, err
-			}
-			if childNode != nil {
-				node.Children = append(node.Children, childNode)
-			}
+// defineFlags registers every command-line option on fs, bound to the fields of opts.
+func defineFlags(fs *flag.FlagSet, opts *cb2md.Options) {
+	fs.StringVar(&opts.IgnoreFile, "ignore", ".ignore", "Path to ignore file (glob patterns). Default is .ignore")
+	fs.StringVar(&opts.Cb2mdIgnoreFile, "cb2mdignore", ".cb2mdignore", "Path to cb2md's own ignore file, whose patterns are applied after the -ignore file's.")
+	fs.StringVar(&opts.OutFile, "o", "", "Output file path (if empty, prints to stdout). If ends with .md, we also print file contents.")
+	fs.StringVar(&opts.TreeJSON, "tree-json", "", "Also write the directory structure (no contents) as JSON to this file.")
+	fs.StringVar(&opts.Upload, "upload", "", "Also upload the output to this `URL` (s3://bucket/key), with AWS credentials and region from the environment.")
+	fs.StringVar(&opts.ChangedSince, "changed-since-commit", "", "Only include files changed since this git commit (per `git diff --name-only`).")
+	fs.StringVar(&opts.RelativeTo, "relative-to", "", "Show paths in the tree and headings relative to this `DIR` (an ancestor of the scanned directory, e.g. the repository root) instead of to the scanned directory.")
+	fs.StringVar(&opts.ContentRef, "content-ref", "", "Dump file contents as they are at this git `REF` (per `git show`), instead of from the working tree.")
+	fs.BoolVar(&opts.JSONPretty, "json-pretty", false, "Indent JSON output for readability (compact by default).")
+	fs.StringVar(&opts.FromFile, "from-file", "", "Only include the files listed (one relative path per line) in this file, or - for stdin, in the listed order.")
+	fs.Func("include", "Only list the files matching this glob or extension (e.g. *.go, go, src/**/*.ts; comma-separated and repeatable), after the ignore rules; the tree still shows the rest.", func(v string) error {
+		opts.Include = append(opts.Include, splitList(v)...)
+		return nil
+	})
+	fs.BoolVar(&opts.IncludeTree, "include-tree", false, "With -include, leave the other files out of the tree too.")
+	fs.Func("modified-since", "Only list the files modified within this `DURATION` (e.g. 24h, 90m) or since this RFC 3339 time (e.g. 2024-05-01T09:00:00Z); the tree still shows the rest.", func(v string) error {
+		t, err := parseSince(v, time.Now())
+		opts.ModifiedSince = t
+		return err
+	})
+	fs.BoolVar(&opts.ModifiedSinceTree, "modified-since-tree", false, "With -modified-since, leave the other files out of the tree too.")
+	fs.StringVar(&opts.ContentMatch, "content-match", "", "Only list the files whose content matches this regular expression (they all stay in the tree).")
+	fs.BoolVar(&opts.OnlyTODOs, "only-todos", false, "Only list the files containing TODO, FIXME or XXX markers (a preset for -content-match).")
+	fs.BoolVar(&opts.Placeholder, "placeholder", false, "Give the files left out of the file list by -include, -modified-since, -content-match or -only-todos a heading with a note saying so.")
+	fs.Func("match-context", "With -content-match or -only-todos, only show the matching lines of each file, plus `N` lines around each.", func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err == nil && n < 0 {
+			err = fmt.Errorf("must not be negative")
 		}
-
-		// Sort children so the output is predictable
-		sort.Slice(node.Children, func(i, j int) bool {
-			return node.Children[i].Name < node.Children[j].Name
-		})
-
-	} else {
-		// It's a file, so let's see if we skip content
-		relPath, err := filepath.Rel(basePath, currentPath)
-		if err != nil {
-			return nil, err
+		opts.MatchLines, opts.MatchContext = true, n
+		return err
+	})
+	fs.StringVar(&opts.SortBy, "sort", "name", "Order of the Full File List and the tree: name, size (largest first), or mtime (most recently modified first).")
+	fs.Func("delimiter", "Print a `MARKER` line between the files of the Full File List, for tools to split the output on (Go escapes such as \\x00 are interpreted).", func(v string) error {
+		if unquoted, err := strconv.Unquote(`"` + v + `"`); err == nil {
+			v = unquoted
 		}
-
-		// If this file doesn't match skipContentPatterns (case-insensitive), we add it to includedFiles
-		if !matchesAnySkipContent(relPath, skipContentPatterns) {
-			includedFiles = append(includedFiles, relPath)
+		opts.Delimiter = v
+		return nil
+	})
+	fs.BoolVar(&opts.SortReverse, "sort-reverse", false, "Reverse the -sort order.")
+	fs.StringVar(&opts.OrderDirs, "order-dirs", "name", "Order of entries in the tree: name, or count (directories with the most included files first, then files by name).")
+	fs.StringVar(&opts.Format, "format", "md", "Structure of the output: md (headings and code blocks), xml (<directory_structure> and <file path=...> tags), or json (the tree and the files with their contents, as one object).")
+	fs.StringVar(&opts.EOL, "eol", "lf", "Line endings of the output: lf, or crlf (for Windows consumers).")
+	fs.Func("max-depth", "Only descend `N` levels below the root (0 lists the root only); directories at the limit are shown without their contents.", func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err == nil && n < 0 {
+			err = fmt.Errorf("must not be negative")
 		}
-	}
+		opts.LimitDepth, opts.MaxDepth = true, n
+		return err
+	})
+	fs.IntVar(&opts.MaxDirs, "max-dirs", 0, "Stop descending after scanning `N` directories (0 means no limit).")
+	fs.IntVar(&opts.MaxSymlinks, "max-symlinks", 0, "Resolve at most `N` symlinks, skipping any more with a warning (0 means no limit).")
+	fs.BoolVar(&opts.MergeRoots, "merge-roots", false, "With several directories, combine them into one tree below a synthetic root, with one Full File List, instead of a section per directory.")
+	fs.IntVar(&opts.SplitDepth, "split-depth", 0, "Split the output (-o) into one file per directory at this depth, plus an index.")
+	fs.BoolVar(&opts.SplitContext, "split-context", false, "With -split-depth, start each part with a tree showing where it sits in the repository.")
+	fs.IntVar(&opts.SplitTokens, "split-tokens", 0, "Split the output (-o) into numbered parts of about this many estimated tokens each.")
+	fs.IntVar(&opts.Overlap, "overlap", 0, "With -split-tokens, start each part by repeating the files at the end of the previous one, up to this many tokens (at least one file).")
+	fs.Func("split-size", "Split the output (-o) into numbered parts of about `SIZE` (e.g. 500k, 2M) each, cut between files.", func(v string) error {
+		n, err := parseSize(v)
+		opts.SplitSize = n
+		return err
+	})
+	fs.StringVar(&opts.TestPattern, "test-pattern", "", "Explain which ignore/skip-content patterns match this relative path, then exit.")
+	fs.BoolVar(&opts.TreeSizes, "tree-sizes", false, "Show each file's size next to it in the tree.")
+	fs.BoolVar(&opts.DirSizes, "tree-sizes-dirs", false, "With -tree-sizes, also show the total size of each directory.")
+	fs.BoolVar(&opts.SizeBars, "size-bars", false, "Follow each file and directory in the tree with a bar of # showing its size relative to the whole tree.")
+	fs.BoolVar(&opts.AnnotateEmptyDirs, "annotate-empty-dirs", false, "Mark directories left with nothing to show as (empty) in the tree.")
+	fs.BoolVar(&opts.FoldChains, "fold-chains", false, "Collapse chains of single-child directories (like com/example/app) into one node in the tree.")
+	fs.BoolVar(&opts.Emoji, "emoji", false, "Prefix directories in the tree with 📁 and files with an emoji for their language (📄 by default). Emoji are wider than other characters, so the tree's alignment may suffer.")
+	fs.Var((*stringList)(&opts.IgnorePatterns), "ignore-pattern", "Extra ignore `pattern`, overriding the ignore files (repeatable; prefix with ! to re-include).")
+	fs.Func("skip-content", "Extra skip-content `patterns` (comma-separated, repeatable), matched case-insensitively against base names: such files stay in the tree, without their contents.", func(v string) error {
+		opts.SkipContent = append(opts.SkipContent, splitList(v)...)
+		return nil
+	})
+	fs.Func("skip-content-only", "Like -skip-content, but replacing the built-in skip-content `patterns` (images, lock files) instead of adding to them.", func(v string) error {
+		opts.SkipContent = append(opts.SkipContent, splitList(v)...)
+		opts.SkipContentOnly = true
+		return nil
+	})
+	fs.BoolVar(&opts.Explain, "explain", false, "Print the effective ignore/skip-content rules in precedence order, then exit.")
+	fs.BoolVar(&opts.IncludeHidden, "include-hidden", false, "Don't skip hidden files and directories (names starting with .), except .git and the ignore files.")
+	fs.Func("hidden-allow", "Don't skip the hidden files and directories whose names match these `globs` (comma-separated, repeatable), e.g. .github,.env.*", func(v string) error {
+		opts.HiddenAllow = append(opts.HiddenAllow, splitList(v)...)
+		return nil
+	})
+	fs.BoolVar(&opts.Gitignore, "gitignore", false, "Also skip files ignored by .gitignore files in any directory, using git's rules.")
+	fs.Func("preview", "Only show the first `SIZE` of each file (e.g. 2k, 1M), cut at a line boundary when possible.", func(v string) error {
+		n, err := parseSize(v)
+		opts.Preview = n
+		return err
+	})
+	fs.Func("max-file-size", "Replace the contents of files larger than `SIZE` (e.g. 256k, 2M) with a note giving their size; they stay in the tree.", func(v string) error {
+		n, err := parseSize(v)
+		opts.MaxFileSize = n
+		return err
+	})
+	fs.BoolVar(&opts.SkipSizeMismatch, "skip-size-mismatch", false, "Omit the contents of files of which more or fewer bytes were read than their size says, as with /proc files.")
+	fs.Func("large-warning", "Put a warning above the contents of files larger than `SIZE` (e.g. 100k).", func(v string) error {
+		n, err := parseSize(v)
+		opts.LargeWarning = n
+		return err
+	})
+	fs.BoolVar(&opts.TOC, "toc", false, "Add a table of contents before the Full File List, linking to each file's heading.")
+	fs.Func("confirm-over", "Ask for confirmation (when stdin is a terminal) before writing an output estimated to exceed `SIZE` (e.g. 10M).", func(v string) error {
+		n, err := parseSize(v)
+		opts.ConfirmOver = n
+		return err
+	})
+	fs.IntVar(&opts.TOCDepth, "toc-depth", 0, "Add a table of contents expanding directories down to this depth; deeper files are collapsed under their directory.")
+	fs.BoolVar(&opts.BackToTop, "back-to-top", false, "With -toc, follow each file's section with a link back to the table of contents.")
+	fs.BoolVar(&opts.ASCIIOnly, "ascii-only", false, "Make the output pure ASCII: transliterate or \\uXXXX-escape non-ASCII characters and use ASCII tree connectors.")
+	fs.BoolFunc("no-follow-outside", "Don't follow symlinks that resolve outside the scanned directory (on by default; use =false to allow).", func(v string) error {
+		noFollow, err := strconv.ParseBool(v)
+		opts.FollowOutside = !noFollow
+		return err
+	})
+	fs.BoolVar(&opts.HexPreview, "binary-hex-preview", false, "List skip-content files (images, etc.) too, with a short hex dump of their first bytes.")
+	fs.BoolVar(&opts.IncludeBinary, "include-binary", false, "Dump the contents of files that look binary (NUL bytes, or mostly non-printable) too, instead of a note.")
+	fs.BoolVar(&opts.MIMEDetect, "mime-detect", false, "Decide whether to dump a file by its content-sniffed MIME type instead: text/* and the -mime-allow types are dumped, anything else gets a note.")
+	fs.Func("mime-allow", "Comma-separated non-text MIME `types` dumped with -mime-detect (default application/json,application/xml; type/* matches a whole type).", func(v string) error {
+		opts.MIMEAllow = append([]string{}, splitList(v)...)
+		return nil
+	})
+	fs.BoolVar(&opts.SkipDataBlobs, "skip-data-blobs", false, "Replace the contents of text files that are mostly long base64-like runs (encoded blobs, data URIs) with a note.")
+	fs.BoolVar(&opts.SkipGenerated, "skip-generated", false, "Leave out the contents of generated files (a \"Code generated ... DO NOT EDIT.\" or @generated marker in their first lines), marking them (generated) in the tree.")
+	fs.BoolVar(&opts.StripLicense, "strip-license", false, "Replace a license comment block at the top of each file with a short note.")
+	fs.IntVar(&opts.SmartTrim, "smart-trim", 0, "Trim Go files over this many estimated `tokens` by eliding the largest function bodies, keeping imports, declarations and signatures.")
+	fs.BoolVar(&opts.ListOnly, "list-only", false, "List included file paths (with detected language) in the Full File List, without their contents.")
+	fs.BoolVar(&opts.TreeOnly, "tree-only", false, "Print only the tree, without the Full File List, even for .md output.")
+	fs.BoolVar(&opts.NoTree, "no-tree", false, "Print only the Full File List, without the tree.")
+	fs.BoolVar(&opts.Validate, "validate", false, "Check that the Markdown output has balanced code fences and well-nested headings before writing it, and fail if not.")
+	fs.BoolVar(&opts.PathComment, "path-comment", false, "Start each code block with a comment containing the file's path.")
+	fs.BoolVar(&opts.LineNumbers, "line-numbers", false, "Number the lines of each code block.")
+	fs.BoolVar(&opts.Collapsible, "collapsible", false, "Wrap each file's code block in a collapsible <details> element, summarized by its path and line count.")
+	opts.HeadingMeta = true
+	fs.BoolFunc("no-heading-meta", "Don't follow the path in each file's heading with its size and line count (shown by default; use =false to show).", func(v string) error {
+		noMeta, err := strconv.ParseBool(v)
+		opts.HeadingMeta = !noMeta
+		return err
+	})
+	fs.BoolVar(&opts.Stable, "stable", false, "Keep the output diff-friendly for storing it in git: no sizes or line counts in headings, files in name order, and a single newline at the end.")
+	fs.IntVar(&opts.HeadingLevel, "heading-level", 3, "Level of each file's heading (1-6), with the Full File List's heading one level above.")
+	fs.BoolVar(&opts.DepthHeadings, "depth-headings", false, "Make the Full File List's headings a level deeper for each directory a file is in (### at the top, down to ######).")
+	fs.BoolVar(&opts.SkipUnknownLang, "skip-unknown-lang", false, "Show files of unknown language (no recognized name, extension or shebang line) in the tree only, without their contents.")
+	fs.BoolVar(&opts.FrontMatter, "front-matter", false, "Start the Markdown output with a YAML front matter block: file count, generation time (left out with -stable), source directory and cb2md version.")
+	fs.BoolVar(&opts.RepoHeader, "repo-header", false, "Start the Markdown output with a summary of the repository: file count, size, dominant language, git branch and commit.")
+	fs.IntVar(&opts.Jobs, "jobs", runtime.NumCPU(), "Read and render up to `N` files concurrently, holding the whole output in memory until it's written (default: the number of CPUs; 1 renders one file at a time).")
+	fs.IntVar(&opts.MaxOpen, "max-open", defaultMaxOpen(), "Keep at most `N` files open at once while reading concurrently (default: half the open-file limit, where known; 0 means no limit).")
+	fs.BoolVar(&opts.Tokens, "tokens", false, "Print an estimate of the LLM tokens in the output, and in the file contents per language and per file, to stderr.")
+	fs.BoolVar(&opts.Stats, "stats", false, "End the output with a summary of the directories, files, lines and bytes captured, and the files per language.")
+	fs.BoolVar(&opts.WordCount, "word-count", false, "Print the number of words in the file contents, in total, per language and per file, to stderr.")
+	fs.BoolVar(&opts.ImportGraph, "import-graph", false, "Append a graph of which included Go and JS/TS files import which others, plus the imports that don't resolve to included files.")
+	fs.BoolVar(&opts.Legend, "legend", false, "Start the Markdown output with a table of the file extensions present and their languages.")
+	fs.BoolVar(&opts.MatrixIndex, "matrix-index", false, "Start the Markdown output with a table counting the files of each directory (rows) by language (columns).")
+}
 
-	return node, nil
+// isTerminal reports whether f is a terminal (a character device) rather than a pipe or a file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
-// printTree prints a Node (directory or file) in ASCII tree format.
-func printTree(node *Node, prefix string, isLast bool, w io.Writer) {
-	connector := "├── "
-	if isLast {
-		connector = "└── "
+// askYesNo writes question to w and reads the answer, a line, from r. Only "y" or "yes"
+// (in any case) count as yes.
+func askYesNo(r io.Reader, w io.Writer, question string) bool {
+	fmt.Fprint(w, question)
+	answer, _ := bufio.NewReader(r).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
 	}
+	return false
+}
 
-	// Print this node
-	fmt.Fprintln(w, prefix+connector+node.Name)
-
-	if node.IsDir {
-		// Prepare prefix for children
-		var childPrefix string
-		if isLast {
-			childPrefix = prefix + "    "
-		} else {
-			childPrefix = prefix + "│   "
-		}
-
-		for i, child := range node.Children {
-			last := (i == len(node.Children)-1)
-			printTree(child, childPrefix, last, w)
+// splitList splits a comma-separated flag value, dropping empty elements.
+func splitList(v string) []string {
+	var list []string
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
 		}
 	}
+	return list
 }
 
-// loadIgnorePatterns reads lines from the ignore file and returns them as patterns.
-func loadIgnorePatterns(ignorePath string) []string {
-	var patterns []string
-	f, err := os.Open(ignorePath)
-	if err != nil {
-		// If not found, no patterns
-		return patterns
-	}
-	defer f.Close()
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		patterns = append(patterns, line)
-	}
-	return patterns
-}
+func (l *stringList) String() string { return strings.Join(*l, ",") }
 
-// matchesAnyPattern checks if relPath matches any pattern (case-sensitive, using the entire path).
-// Used for .ignore patterns so users can skip entire directories, etc.
-func matchesAnyPattern(relPath string, patterns []string) bool {
-	for _, p := range patterns {
-		matched, err := filepath.Match(p, relPath)
-		if err == nil && matched {
-			return true
-		}
-	}
-	return false
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
 }
 
-// matchesAnySkipContent checks if the base name of relPath matches any skip-content pattern (case-insensitive).
-// e.g., "photo.GIF" -> base name is "photo.gif", we match "photo.gif" against patterns like "*.gif".
-func matchesAnySkipContent(relPath string, patterns []string) bool {
-	baseName := strings.ToLower(filepath.Base(relPath)) // e.g. "photo.gif"
-	for _, p := range patterns {
-		p = strings.ToLower(p) // e.g. "*.gif"
-		matched, err := filepath.Match(p, baseName)
-		if err == nil && matched {
-			return true
-		}
+// parseSize parses a human-readable size such as "512", "256k", "2MB" or "1g"
+// (case-insensitive, powers of 1024) into a number of bytes.
+func parseSize(s string) (int64, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "b")
+
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(str, "k"):
+		mult = 1 << 10
+	case strings.HasSuffix(str, "m"):
+		mult = 1 << 20
+	case strings.HasSuffix(str, "g"):
+		mult = 1 << 30
 	}
-	return false
-}
-
-// guessLanguage attempts to guess a code block language from the file extension.
-func guessLanguage(filename string) string {
-	ext := strings.ToLower(filepath.Ext(filename))
-	languageMap := map[string]string{
-		".go":   "go",
-		".py":   "python",
-		".js":   "javascript",
-		".jsx":  "jsx",
-		".ts":   "typescript",
-		".tsx":  "tsx",
-		".html": "html",
-		".css":  "css",
-		".scss": "scss",
-		".java": "java",
-		".rs":   "rust",
-		".sh":   "bash",
-		".rb":   "ruby",
-		".php":  "php",
-		".yaml": "yaml",
-		".yml":  "yaml",
-		".json": "json",
-		".md":   "markdown",
+	if mult > 1 {
+		str = str[:len(str)-1]
 	}
-	if lang, ok := languageMap[ext]; ok {
-		return lang
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 512, 256k, 2M, 1G)", s)
 	}
-	return "" // unknown
+	return int64(n * float64(mult)), nil
 }
 
-// printFileContents prints the contents of a file to the given writer.
-func printFileContents(path string, w io.Writer) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
+// parseSince parses a -modified-since value: a duration before now, such as "24h", or an
+// RFC 3339 time, such as "2024-05-01T09:00:00Z".
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
 	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		fmt.Fprintln(w, scanner.Text())
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (want a duration like 24h, or an RFC 3339 time like 2024-05-01T09:00:00Z)", s)
 	}
-	return scanner.Err()
+	return t, nil
 }
@@ -1,104 +1,99 @@
-// main_test.go
 package main
 
 import (
 	"os"
 	"path/filepath"
-	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
-// TestLoadIgnorePatterns ensures patterns are loaded from .ignore correctly.
-func TestLoadIgnorePatterns(t *testing.T) {
-	tmpDir := t.TempDir()
-	ignoreFile := filepath.Join(tmpDir, ".ignore")
-
-	content := []byte(`
-# This is a comment
-*.log
-secret.txt
-
-build/
-`)
-	if err := os.WriteFile(ignoreFile, content, 0o644); err != nil {
-		t.Fatalf("Failed to write .ignore: %v", err)
+// TestAskYesNo checks that only an explicit yes confirms.
+func TestAskYesNo(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{" yes \n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"yep\n", false},
+		{"", false}, // EOF
 	}
-
-	patterns := loadIgnorePatterns(ignoreFile)
-	want := []string{"*.log", "secret.txt", "build/"}
-	if !reflect.DeepEqual(patterns, want) {
-		t.Errorf("loadIgnorePatterns got %v, want %v", patterns, want)
+	for _, tt := range tests {
+		var out strings.Builder
+		if got := askYesNo(strings.NewReader(tt.answer), &out, "Continue? [y/N] "); got != tt.want {
+			t.Errorf("askYesNo(%q) = %v; want %v", tt.answer, got, tt.want)
+		}
+		if out.String() != "Continue? [y/N] " {
+			t.Errorf("question written as %q", out.String())
+		}
 	}
 }
 
-// TestMatchesAnySkipContent checks we do case-insensitive filename-only match.
-func TestMatchesAnySkipContent(t *testing.T) {
-	patterns := []string{
-		"*.png", "*.jpg", "*.jpeg", "*.gif", "*.svg", "*.webp",
-		"package-lock.json", "composer.lock",
-	}
+// TestParseSize checks human-readable size parsing.
+func TestParseSize(t *testing.T) {
 	tests := []struct {
-		relPath string
-		want    bool
+		in      string
+		want    int64
+		wantErr bool
 	}{
-		{"photo.JPG", true}, // baseName=photo.jpg, match *.jpg
-		{"photo.jpeg", true},
-		{"photo.JPEg", true},
-		{"image.png", true},
-		{"image.PNG", true},
-		{"composer.lock", true},
-		{"COMPOSER.LOCK", true}, // baseName=composer.lock
-		{"package-lock.JSON", true},
-		{"photo.txt", false},
-		{"photo.jpg.bak", false}, // baseName=photo.jpg.bak; doesn't match *.jpg
+		{"512", 512, false},
+		{"256k", 256 << 10, false},
+		{"256K", 256 << 10, false},
+		{"2M", 2 << 20, false},
+		{"2mb", 2 << 20, false},
+		{"1G", 1 << 30, false},
+		{"1g", 1 << 30, false},
+		{"3GB", 3 << 30, false},
+		{"64Kb", 64 << 10, false},
+		{"1.5k", 1536, false},
+		{"abc", 0, true},
+		{"-1k", 0, true},
 	}
 	for _, tt := range tests {
-		got := matchesAnySkipContent(tt.relPath, patterns)
-		if got != tt.want {
-			t.Errorf("matchesAnySkipContent(%q) = %v; want %v", tt.relPath, got, tt.want)
+		got, err := parseSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d (error %v)", tt.in, got, err, tt.want, tt.wantErr)
 		}
 	}
 }
 
-// TestGuessLanguage verifies extension-to-language mapping.
-func TestGuessLanguage(t *testing.T) {
+// TestParseSince checks -modified-since values: durations back from now, and RFC 3339 times.
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
 	tests := []struct {
-		filename string
-		want     string
+		in      string
+		want    time.Time
+		wantErr bool
 	}{
-		{"main.go", "go"},
-		{"script.js", "javascript"},
-		{"script.JS", "javascript"}, // checks case-insensitivity of extension
-		{"styles.css", "css"},
-		{"readme.md", "markdown"},
-		{"data.json", "json"},
-		{"unknownfile.xyz", ""},
+		{"24h", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), false},
+		{"90m", time.Date(2024, 5, 2, 10, 30, 0, 0, time.UTC), false},
+		{"2024-05-01T09:00:00Z", time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC), false},
+		{"2024-05-01", time.Time{}, true},
+		{"-1h", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
 	}
 	for _, tt := range tests {
-		got := guessLanguage(tt.filename)
-		if got != tt.want {
-			t.Errorf("guessLanguage(%q) = %q; want %q", tt.filename, got, tt.want)
+		got, err := parseSince(tt.in, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseSince(%q) = %v, %v; want %v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
 		}
 	}
 }
 
-// TestPrintFileContents ensures file contents are printed as expected.
-func TestPrintFileContents(t *testing.T) {
-	tmp := t.TempDir()
-	filePath := filepath.Join(tmp, "hello.txt")
-	content := "Hello\nWorld"
-	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
-		t.Fatalf("WriteFile failed: %v", err)
-	}
-
-	var buf strings.Builder
-	if err := printFileContents(filePath, &buf); err != nil {
-		t.Errorf("printFileContents error: %v", err)
-	}
-	got := buf.String()
-	want := "Hello\nWorld\n"
-	if got != want {
-		t.Errorf("printFileContents got:\n%q\nwant:\n%q", got, want)
+// writeFiles creates each file (and its parent directories) under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
 	}
 }
@@ -0,0 +1,107 @@
+package cb2md
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// asciiReplacements transliterates common non-ASCII characters, including the
+// box-drawing characters used for tree connectors.
+var asciiReplacements = map[rune]string{
+	// Tree connectors
+	'├': "|", '└': "`", '─': "-", '│': "|",
+
+	// Typography
+	'‘': "'", '’': "'", '‚': ",", '“': `"`, '”': `"`, '„': `"`,
+	'–': "-", '—': "-", '…': "...", '•': "*", ' ': " ",
+	'«': "<<", '»': ">>", '→': "->", '←': "<-", '×': "x",
+	'©': "(c)", '®': "(R)", '™': "(TM)", '°': "deg",
+
+	// Latin letters with diacritics
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Ā': "A", 'Ă': "A", 'Ą': "A",
+	'ç': "c", 'ć': "c", 'č': "c", 'Ç': "C", 'Ć': "C", 'Č': "C",
+	'ď': "d", 'đ': "d", 'Ď': "D", 'Đ': "D",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ę': "e", 'ě': "e",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ē': "E", 'Ę': "E", 'Ě': "E",
+	'ğ': "g", 'Ğ': "G",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ı': "i",
+	'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I", 'Ī': "I", 'İ': "I",
+	'ł': "l", 'Ł': "L",
+	'ñ': "n", 'ń': "n", 'ň': "n", 'Ñ': "N", 'Ń': "N", 'Ň': "N",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O", 'Ō': "O", 'Ő': "O",
+	'ř': "r", 'Ř': "R",
+	'ś': "s", 'š': "s", 'ş': "s", 'Ś': "S", 'Š': "S", 'Ş': "S",
+	'ť': "t", 'ţ': "t", 'Ť': "T", 'Ţ': "T",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U", 'Ū': "U", 'Ů': "U", 'Ű': "U",
+	'ý': "y", 'ÿ': "y", 'Ý': "Y", 'Ÿ': "Y",
+	'ź': "z", 'ż': "z", 'ž': "z", 'Ź': "Z", 'Ż': "Z", 'Ž': "Z",
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'þ': "th", 'Þ': "TH", 'ð': "d", 'Ð': "D",
+}
+
+// toASCII transliterates r if it has a known ASCII equivalent, and otherwise escapes it
+// as \uXXXX (or \UXXXXXXXX outside the Basic Multilingual Plane).
+func toASCII(r rune) string {
+	if r < utf8.RuneSelf {
+		return string(r)
+	}
+	if s, ok := asciiReplacements[r]; ok {
+		return s
+	}
+	if r > 0xFFFF {
+		return fmt.Sprintf(`\U%08X`, r)
+	}
+	return fmt.Sprintf(`\u%04X`, r)
+}
+
+// asciiWriter passes output through as pure ASCII, transliterating or escaping every
+// non-ASCII character. Invalid UTF-8 bytes become "?". A character split across two
+// writes is held back until it is complete (or until Flush).
+type asciiWriter struct {
+	w       io.Writer
+	pending []byte
+}
+
+func (a *asciiWriter) Write(p []byte) (int, error) {
+	data := append(a.pending, p...)
+	a.pending = nil
+
+	out := make([]byte, 0, len(data))
+	for len(data) > 0 {
+		if data[0] < utf8.RuneSelf {
+			out = append(out, data[0])
+			data = data[1:]
+			continue
+		}
+		if !utf8.FullRune(data) {
+			// Possibly the start of a character that continues in the next write
+			a.pending = append([]byte(nil), data...)
+			break
+		}
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			out = append(out, '?')
+		} else {
+			out = append(out, toASCII(r)...)
+		}
+		data = data[size:]
+	}
+
+	if _, err := a.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes out any incomplete character left over from the last write, as "?".
+func (a *asciiWriter) Flush() error {
+	if len(a.pending) == 0 {
+		return nil
+	}
+	a.pending = nil
+	_, err := io.WriteString(a.w, "?")
+	return err
+}
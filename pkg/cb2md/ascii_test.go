@@ -0,0 +1,52 @@
+package cb2md
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestASCIIOnly checks that emoji and accented characters in content, paths and tree connectors become pure ASCII.
+func TestASCIIOnly(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"café.md":     "Crème brûlée “quoted” — naïve 😀 日本\n",
+		"src/main.go": "package main\n",
+	})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, ASCIIOnly: true})
+
+	for i := 0; i < len(got); i++ {
+		if got[i] >= 0x80 {
+			t.Fatalf("non-ASCII byte %#x at offset %d in output:\n%s", got[i], i, got)
+		}
+	}
+	for _, want := range []string{
+		"|-- cafe.md\n",
+		"`-- src\n",
+		"### cafe.md\n",
+		`Creme brulee "quoted" - naive \U0001F600 \u65E5\u672C`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+}
+
+// TestASCIIWriterSplitRune checks that a character split across writes is still transliterated.
+func TestASCIIWriterSplitRune(t *testing.T) {
+	var buf strings.Builder
+	aw := &asciiWriter{w: &buf}
+	e := []byte("é")
+	if _, err := aw.Write([]byte{'a', e[0]}); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if _, err := aw.Write([]byte{e[1], 'b', 0xff}); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if err := aw.Flush(); err != nil {
+		t.Fatalf("Flush error: %v", err)
+	}
+	if got := buf.String(); got != "aeb?" {
+		t.Errorf("asciiWriter got %q, want %q", got, "aeb?")
+	}
+}
@@ -0,0 +1,1903 @@
+// Package cb2md renders a directory as an ASCII tree and, in Markdown mode, dumps the
+// contents of its files below it, skipping hidden files and anything matched by the
+// ignore rules. It is the engine behind the cb2md command.
+package cb2md
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Node represents a file or directory in our tree structure.
+type Node struct {
+	Name     string  `json:"name"`
+	IsDir    bool    `json:"isDir"`
+	Children []*Node `json:"children,omitempty"`
+
+	// Size is the file's size in bytes, or the total of everything below a directory.
+	Size int64 `json:"-"`
+
+	// ModTime is when the file was last modified, or the latest of those below a directory.
+	ModTime time.Time `json:"-"`
+
+	// Note is shown next to the name in the tree, e.g. to say why a node wasn't followed.
+	Note string `json:"note,omitempty"`
+
+	// FileCount is 1 for a file in the Full File List, or the number of such files below a directory.
+	FileCount int `json:"-"`
+
+	// Truncated is set on a directory whose contents weren't scanned, because of -max-depth or -max-dirs.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Hash is the hex SHA-256 of a file's content. It is only filled in for -tree-json, so
+	// changelogs between two dumps can tell renamed files from added and removed ones.
+	Hash string `json:"hash,omitempty"`
+}
+
+// skipContentPatterns: these appear in the ASCII tree but won't show in the file list.
+// (Images, lock files, etc.) We use case-insensitive matching on the *base filename*.
+var skipContentPatterns = []string{
+	"*.png", "*.jpg", "*.jpeg", "*.gif", "*.svg", "*.webp",
+	"package-lock.json", "composer.lock",
+}
+
+// Options controls what gets scanned and how it is printed. The zero value prints the
+// tree of everything that isn't hidden, skipping symlinks that lead outside the root.
+// Most fields correspond to a command-line flag of the same name.
+type Options struct {
+	IgnoreFile        string // ignore file (glob patterns), relative to the root
+	Cb2mdIgnoreFile   string // cb2md's own ignore file in the root, whose patterns follow IgnoreFile's
+	OutFile           string // write here instead of to the writer given to Run
+	Markdown          bool   // also dump the file contents, as Markdown, below the tree
+	TreeJSON          string // also write the structure as JSON to this file
+	ChangedSince      string // only include files changed since this git commit
+	ContentRef        string // dump file contents as of this git ref instead of from disk
+	RelativeTo        string // show paths relative to this directory, an ancestor of the root, instead of to the root
+	SortBy            string // order of the Full File List and the tree: "name" (default), "size" (largest first) or "mtime" (newest first)
+	SortReverse       bool   // reverse the SortBy order
+	Delimiter         string // print this line between the sections of the Full File List, for tools to split on
+	OrderDirs         string // order of the tree: "name" (default) or "count"
+	EOL               string // line endings of the output: "lf" (default) or "crlf"
+	Format            string // structure of the output: "md" (default), "xml" tags around the tree and each file, or a "json" document
+	SplitDepth        int    // split the output (OutFile) into one file per directory at this depth
+	MaxDirs           int    // stop descending after scanning this many directories, if positive
+	MaxSymlinks       int    // leave out the symlinks found after resolving this many, if positive
+	MaxDepth          int    // with LimitDepth, list the contents of directories only down to this depth (0 is the root)
+	LimitDepth        bool
+	MergeRoots        bool // with several roots, combine them into one tree below a synthetic root
+	SplitContext      bool
+	SplitTokens       int    // split the output (OutFile) into numbered parts of about this many estimated tokens
+	Overlap           int    // with SplitTokens, repeat about this many tokens of files from the end of each part in the next
+	SplitSize         int64  // split the output (OutFile) into numbered parts of about this many bytes
+	TestPattern       string // explain the rules matching this relative path instead of scanning
+	TreeSizes         bool
+	DirSizes          bool
+	SizeBars          bool // follow each node in the tree with a bar showing its size relative to the whole tree
+	AnnotateEmptyDirs bool
+	FoldChains        bool // collapse chains of single-child directories into one tree node
+	Emoji             bool // prefix tree labels with a folder emoji, or one for the file's language
+	Gitignore         bool
+	IncludeHidden     bool     // don't skip hidden files and directories (other than .git and the ignore files)
+	HiddenAllow       []string // don't skip the hidden files and directories whose names match these globs
+	Preview           int64    // only show this many bytes of each file, if positive
+	LargeWarning      int64    // warn above the contents of files larger than this many bytes, if positive
+	MaxFileSize       int64    // omit the contents of files larger than this many bytes, if positive
+	SkipSizeMismatch  bool     // omit the contents of files of which more or fewer bytes were read than their size says
+
+	// ConfirmOver, if positive, is the estimated output size above which Confirm is asked
+	// (with a question like "Output will be ~12.0 MB, continue? [y/N] ") whether to go on.
+	// If it says no, nothing is written and ErrCanceled is returned.
+	ConfirmOver int64
+	Confirm     func(question string) bool
+
+	IgnorePatterns  []string // extra ignore patterns, overriding the ignore files
+	SkipContent     []string // extra skip-content patterns, matched case-insensitively against base names
+	SkipContentOnly bool     // use SkipContent instead of the built-in skip-content patterns
+	Explain         bool     // print the effective rules instead of scanning
+	TOC             bool     // add a table of contents linking to each file
+	TOCDepth        int
+	ASCIIOnly       bool
+	FollowOutside   bool // follow symlinks that resolve outside the root
+	HexPreview      bool
+	StripLicense    bool
+	SmartTrim       int // elide the largest function bodies of Go files over this many estimated tokens
+	ListOnly        bool
+	TreeOnly        bool // print only the tree, without the Full File List, even for Markdown output
+	NoTree          bool // print only the Full File List, without the tree
+	Validate        bool // check that the Markdown output is well-formed before writing it
+	PathComment     bool
+	LineNumbers     bool // number the lines of each code block
+	HeadingMeta     bool // follow the path in each file's heading with its size and line count
+	Stable          bool // keep the output diff-friendly: no HeadingMeta or front matter timestamp, ordered by name, and a single final newline
+	FrontMatter     bool // start the output with a YAML front matter block: file count, timestamp, source and Version
+	Collapsible     bool // wrap each file's code block in a <details> element
+	DepthHeadings   bool // make the headings of the Full File List a level deeper for each directory, like the tree
+	HeadingLevel    int  // level of each file's heading (3 if zero, clamped to 1–6), with the Full File List's one above
+	BackToTop       bool // with TOC, follow each file's section with a link back to the table of contents
+	Placeholder     bool // give the files left out by -include, -modified-since or a content filter a section saying so
+	JSONPretty      bool
+	Legend          bool
+	MatrixIndex     bool // start with a table counting the files of each directory by language
+	SkipUnknownLang bool
+	RepoHeader      bool
+	Tokens          bool
+	Stats           bool     // summarize the directories, files, lines and bytes captured, at the end of the output
+	WordCount       bool     // print the words in the file contents, in total, per language and per file, to Stderr
+	ImportGraph     bool     // append a graph of which included Go/JS files import which
+	IncludeBinary   bool     // dump the contents of files that look binary, instead of a note
+	MIMEDetect      bool     // decide whether to dump a file by its sniffed MIME type instead
+	MIMEAllow       []string // non-text MIME types dumped with MIMEDetect (application/json and application/xml if nil)
+	SkipDataBlobs   bool     // omit the contents of files that are mostly base64-like data
+	SkipGenerated   bool     // leave out the contents of files marked as generated, noting them in the tree
+	ContentMatch    string   // only list the files whose content matches this regular expression
+	OnlyTODOs       bool     // only list the files containing TODO, FIXME or XXX
+	MatchLines      bool     // with ContentMatch or OnlyTODOs, only show the matching lines of each file
+	MatchContext    int      // with MatchLines, also show this many lines around each match
+	FromFile        string   // only include the files listed in this file ("-" for Stdin), in that order
+	Include         []string // only list the files matching one of these globs or extensions (the tree still shows all)
+	IncludeTree     bool     // with Include, leave the other files out of the tree too
+
+	// ModifiedSince, if not zero, leaves the files last modified before it out of the Full
+	// File List, and with ModifiedSinceTree, out of the tree too.
+	ModifiedSince     time.Time
+	ModifiedSinceTree bool
+
+	// Version is the version of cb2md shown in the front matter, if known.
+	Version string
+
+	// Jobs is how many files are read, rendered and hashed concurrently. With more than
+	// one, every file is rendered before the output is written, so the whole dump is held
+	// in memory; with one, files are rendered one at a time as they're written.
+	Jobs    int
+	MaxOpen int // keep at most this many of the files being read open at once (0 means no limit)
+
+	// Upload, if set, is where to upload the output once written, as an s3://bucket/key URL.
+	// Uploader, if set, does the uploading instead of the one the URL's scheme calls for.
+	Upload   string
+	Uploader Uploader
+
+	// Stdin is where a FromFile of "-" is read from; os.Stdin if nil.
+	Stdin io.Reader
+
+	// Stderr receives reports that aren't part of the output, such as the token estimate.
+	// If nil, they are discarded.
+	Stderr io.Writer
+}
+
+// scan is the state of a single run: where the walk starts, what it must skip, and what it found.
+type scan struct {
+	opts     Options
+	root     string // absolute path of the scanned directory
+	shownAs  string // with opts.RelativeTo, the root's path as shown: relative to it, or absolute
+	file     string // when a single file was given to scan, its name; root is then its directory
+	realRoot string // root with symlinks resolved, so symlink targets can be checked against it
+	visited  map[string]bool
+
+	// dirCount is the number of directories scanned so far, and dirsSkipped the number
+	// left unscanned because of opts.MaxDirs. filesIgnored counts the files left out by
+	// the ignore rules, not counting those in ignored directories, which aren't walked.
+	dirCount, dirsSkipped int
+	filesIgnored          int
+
+	// symlinks is the number of symlinks resolved so far, for opts.MaxSymlinks.
+	symlinks int
+
+	// outFiles are the absolute paths of the files we write, skipped during the walk. When
+	// splitting, splitOutFile is the index (or with -split-tokens or -split-size, the name
+	// the parts are numbered after), whose part files are skipped too.
+	outFiles     []string
+	splitOutFile string
+
+	// marks, when non-nil, records where each file's section starts and ends as the file
+	// list is printed, for splitting the output between files.
+	marks *sectionMarks
+
+	// mounts, when scanning several roots, maps the name of each root (the first element of
+	// the paths of its files) to its absolute path. Unless sections is set, the roots are
+	// merged into one tree; otherwise each root is printed in a section of its own.
+	mounts   map[string]string
+	sections bool
+
+	// onlyFiles, when non-nil, restricts the walk to these relative file paths (and their parent directories).
+	// onlyDirs then holds those parent directories, so the walk doesn't descend anywhere else.
+	onlyFiles map[string]bool
+	onlyDirs  map[string]bool
+
+	// included holds only those files we want to show in the “Full File List” section.
+	included []string
+
+	// contentSkipped holds the files that appear in the tree but whose content is skipped
+	// (e.g. images matched by skipContentPatterns), keyed by relative path.
+	contentSkipped map[string]bool
+
+	// filtered holds the files that appear in the tree but were left out of the Full File
+	// List by -include, -modified-since or a content filter (-content-match, -only-todos),
+	// keyed by relative path.
+	filtered map[string]bool
+
+	// rendered holds the files read up front by readFiles, or for their headings by
+	// fileLines, keyed by relative path.
+	rendered map[string]renderedFile
+
+	// shebangLanguages caches the language fileLanguage finds in the shebang line of each
+	// file whose name doesn't tell, keyed by relative path, so the file is opened only once
+	// for it. Files are rendered concurrently, hence the mutex.
+	shebangLanguages   map[string]string
+	shebangLanguagesMu sync.Mutex
+
+	// fileInfos caches the stat result of every file in the tree, keyed by its relative path,
+	// so sizes are available later without stat-ing again.
+	fileInfos map[string]os.FileInfo
+
+	// contentMatch, when non-nil, restricts the Full File List to files whose content matches it.
+	contentMatch *regexp.Regexp
+
+	// openSlots, with opts.MaxOpen, holds a token for each file open for reading; opening
+	// another waits for a free slot.
+	openSlots chan struct{}
+
+	// stats accumulates counts, such as the token estimate, over the dumped file contents.
+	stats *contentStats
+
+	// uploadKey is the key the output is uploaded under with opts.Upload.
+	uploadKey string
+
+	// output counts everything written to the output files (or the writer given to Run).
+	output charCounter
+}
+
+// Generate scans root and returns the output (see Run) as a string. opts.OutFile is
+// ignored unless splitting, which always writes files.
+func Generate(root string, opts Options) (string, error) {
+	if opts.SplitDepth == 0 {
+		opts.OutFile = ""
+	}
+	var b strings.Builder
+	if _, err := run(root, opts, &b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Run scans root and writes the tree (and, in Markdown mode, the file list) to
+// opts.OutFile, or to w if that is empty.
+func Run(root string, opts Options, w io.Writer) error {
+	_, err := run(root, opts, w)
+	return err
+}
+
+// BuildTree scans root and returns its tree, as filtered by the ignore rules in opts.
+func BuildTree(root string, opts Options) (*Node, error) {
+	s, err := newScan(root, opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildRootTree(s.loadRules())
+}
+
+// PrintTree prints the tree below root in ASCII format.
+func PrintTree(w io.Writer, root *Node, opts Options) {
+	printTree(root, "", true, w, opts)
+}
+
+// newScan validates opts and prepares a scan of rootDir.
+func newScan(rootDir string, opts Options) (*scan, error) {
+	if opts.SortBy == "" {
+		opts.SortBy = "name"
+	}
+	if opts.SortBy != "name" && opts.SortBy != "size" && opts.SortBy != "mtime" {
+		return nil, fmt.Errorf("unknown -sort value %q (want name, size or mtime)", opts.SortBy)
+	}
+
+	if opts.OrderDirs == "" {
+		opts.OrderDirs = "name"
+	}
+	if opts.OrderDirs != "name" && opts.OrderDirs != "count" {
+		return nil, fmt.Errorf("unknown -order-dirs value %q (want name or count)", opts.OrderDirs)
+	}
+
+	if opts.HeadingLevel == 0 {
+		opts.HeadingLevel = 3
+	}
+	opts.HeadingLevel = min(max(opts.HeadingLevel, 1), 6)
+
+	// Keep the output the same as long as the files are, and changes to one file in its section
+	if opts.Stable {
+		if opts.SortBy != "name" {
+			return nil, fmt.Errorf("-stable can't be combined with -sort=%s, which reorders the output as files change", opts.SortBy)
+		}
+		if opts.OrderDirs != "name" {
+			return nil, fmt.Errorf("-stable can't be combined with -order-dirs=%s, which reorders the output as files change", opts.OrderDirs)
+		}
+		opts.HeadingMeta = false
+	}
+
+	if opts.Format == "" {
+		opts.Format = "md"
+	}
+	if opts.Format != "md" && opts.Format != "xml" && opts.Format != "json" {
+		return nil, fmt.Errorf("unknown -format value %q (want md, xml or json)", opts.Format)
+	}
+	if opts.Format == "json" && (opts.SplitDepth > 0 || opts.SplitTokens > 0 || opts.SplitSize > 0) {
+		return nil, fmt.Errorf("-format=json can't be split (-split-depth, -split-tokens, -split-size)")
+	}
+
+	if opts.ContentRef != "" {
+		if err := checkGitRev(opts.ContentRef); err != nil {
+			return nil, fmt.Errorf("-content-ref: %w", err)
+		}
+	}
+
+	if opts.EOL == "" {
+		opts.EOL = "lf"
+	}
+	if opts.EOL != "lf" && opts.EOL != "crlf" {
+		return nil, fmt.Errorf("unknown -eol value %q (want lf or crlf)", opts.EOL)
+	}
+
+	if opts.SplitDepth > 0 && opts.OutFile == "" {
+		return nil, fmt.Errorf("-split-depth requires an output file (-o)")
+	}
+	if opts.SplitDepth > 0 && opts.Upload != "" {
+		return nil, fmt.Errorf("-upload can't be combined with -split-depth")
+	}
+	if opts.TreeOnly && opts.NoTree {
+		return nil, fmt.Errorf("-tree-only and -no-tree are mutually exclusive")
+	}
+	if (opts.TreeOnly || opts.NoTree) && opts.SplitDepth > 0 {
+		return nil, fmt.Errorf("-tree-only and -no-tree can't be combined with -split-depth")
+	}
+	if opts.NoTree && !opts.Markdown {
+		return nil, fmt.Errorf("-no-tree needs the file contents in the output (stdout or a .md file)")
+	}
+	if opts.Delimiter != "" && opts.Format == "json" {
+		return nil, fmt.Errorf("-delimiter doesn't go with -format=json, whose files are split already")
+	}
+	if strings.Contains(opts.Delimiter, "\n") {
+		return nil, fmt.Errorf("-delimiter must be a single line")
+	}
+	if opts.FrontMatter && opts.Format != "md" {
+		return nil, fmt.Errorf("-front-matter only goes with -format=md")
+	}
+	if opts.Validate && (!opts.Markdown || opts.Format != "md") {
+		return nil, fmt.Errorf("-validate only checks Markdown output (stdout or a .md file, with -format=md)")
+	}
+	if opts.BackToTop && !opts.TOC && opts.TOCDepth <= 0 {
+		return nil, fmt.Errorf("-back-to-top requires -toc (or -toc-depth)")
+	}
+	if opts.SplitTokens > 0 && opts.OutFile == "" {
+		return nil, fmt.Errorf("-split-tokens requires an output file (-o)")
+	}
+	if opts.SplitTokens > 0 && (opts.SplitDepth > 0 || opts.Upload != "") {
+		return nil, fmt.Errorf("-split-tokens can't be combined with -split-depth or -upload")
+	}
+	if opts.SplitSize > 0 && opts.OutFile == "" {
+		return nil, fmt.Errorf("-split-size requires an output file (-o)")
+	}
+	if opts.SplitSize > 0 && (opts.SplitTokens > 0 || opts.SplitDepth > 0 || opts.Upload != "") {
+		return nil, fmt.Errorf("-split-size can't be combined with -split-tokens, -split-depth or -upload")
+	}
+	if opts.Overlap > 0 && opts.SplitTokens <= 0 {
+		return nil, fmt.Errorf("-overlap requires -split-tokens")
+	}
+	if opts.Overlap < 0 || opts.Overlap > 0 && opts.Overlap >= opts.SplitTokens {
+		return nil, fmt.Errorf("-overlap must be between 0 and -split-tokens")
+	}
+	if opts.MaxOpen < 0 {
+		return nil, fmt.Errorf("-max-open must not be negative")
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = io.Discard
+	}
+	contentMatch, err := compileContentMatch(opts)
+	if err != nil {
+		return nil, err
+	}
+	var uploadKey string
+	if opts.Upload != "" {
+		uploader, key, err := newUploader(opts.Upload)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Uploader == nil {
+			opts.Uploader = uploader
+		}
+		uploadKey = key
+	}
+
+	s := &scan{
+		opts:             opts,
+		visited:          make(map[string]bool),
+		contentSkipped:   make(map[string]bool),
+		filtered:         make(map[string]bool),
+		fileInfos:        make(map[string]os.FileInfo),
+		shebangLanguages: make(map[string]string),
+		stats:            newContentStats(),
+		contentMatch:     contentMatch,
+		uploadKey:        uploadKey,
+	}
+	if opts.MaxOpen > 0 {
+		s.openSlots = make(chan struct{}, opts.MaxOpen)
+	}
+
+	// Convert rootDir to absolute path
+	s.root, err = filepath.Abs(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("error getting absolute path: %w", err)
+	}
+
+	// A single file is scanned as the only one in its directory, so it gets its own name
+	if info, err := os.Stat(s.root); err == nil && !info.IsDir() {
+		s.root, s.file = filepath.Split(s.root)
+		s.root = filepath.Clean(s.root)
+	}
+
+	// Resolve the root itself, so symlink targets can be checked against it
+	s.realRoot, err = filepath.EvalSymlinks(s.root)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving root directory: %w", err)
+	}
+
+	// Show paths relative to another directory, which only works from below it
+	if opts.RelativeTo != "" {
+		base, err := filepath.Abs(opts.RelativeTo)
+		if err != nil {
+			return nil, fmt.Errorf("error getting absolute path: %w", err)
+		}
+		rel, err := filepath.Rel(base, s.root)
+		switch {
+		case err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)):
+			s.shownAs = s.root
+		case rel != ".":
+			s.shownAs = rel
+		}
+	}
+
+	// If user specified output files, get their absolute paths.
+	// We'll skip them during our directory walk so they don't get re-included.
+	for _, out := range []string{opts.OutFile, opts.TreeJSON} {
+		if out == "" {
+			continue
+		}
+		absOut, err := filepath.Abs(out)
+		if err != nil {
+			return nil, fmt.Errorf("error getting absolute output file path: %w", err)
+		}
+		s.outFiles = append(s.outFiles, absOut)
+	}
+	if opts.SplitDepth > 0 || opts.SplitTokens > 0 || opts.SplitSize > 0 {
+		s.splitOutFile = s.outFiles[0]
+	}
+
+	// Restrict the walk to files touched since the given commit
+	if opts.ChangedSince != "" {
+		s.onlyFiles, err = gitChangedFiles(s.root, opts.ChangedSince)
+		if err != nil {
+			return nil, fmt.Errorf("error listing files changed since '%s': %w", opts.ChangedSince, err)
+		}
+	}
+	return s, nil
+}
+
+// loadRules loads the ignore patterns (if any) from the ignore file, and combines every
+// source of rules into one precedence-ordered set.
+func (s *scan) loadRules() ruleSet {
+	ignore := ignoreRules(loadIgnorePatterns(filepath.Join(s.root, s.opts.IgnoreFile)), "", s.opts.IgnoreFile)
+	var defaults []rule
+	if !s.opts.SkipContentOnly {
+		defaults = skipContentRules(skipContentPatterns, "defaults")
+	}
+	rules := ruleSet{
+		defaults:     append(defaults, skipContentRules(s.opts.SkipContent, "-skip-content")...),
+		ignore:       ignore,
+		inline:       ignoreRules(s.opts.IgnorePatterns, "", "-ignore-pattern"),
+		useGitignore: s.opts.Gitignore,
+	}
+	// An ignore file given by name is looked for in every directory, not just the root, and
+	// in the directories above the root if the root has none
+	if name := s.opts.IgnoreFile; name != "" && filepath.Base(name) == name {
+		rules.ignoreName = name
+		if !pathExists(filepath.Join(s.root, name)) {
+			if path, prefix := findParentIgnoreFile(s.root, name); path != "" {
+				source, _ := filepath.Rel(s.root, path)
+				rules.ignore = parentIgnoreRules(loadIgnorePatterns(path), prefix, source)
+			}
+		}
+	}
+	// cb2md's own ignore file comes right after the -ignore file, before those in subdirectories
+	if name := s.opts.Cb2mdIgnoreFile; name != "" {
+		rules.ignore = append(rules.ignore, ignoreRules(loadIgnorePatterns(filepath.Join(s.root, name)), "", name)...)
+	}
+	if s.opts.SkipUnknownLang {
+		rules.defaults = append(rules.defaults, unknownLanguageRule("-skip-unknown-lang", s.fileLanguage))
+	}
+	return rules
+}
+
+// run does the work of Run, returning the finished scan so callers can inspect what was found.
+func run(rootDir string, opts Options, stdout io.Writer) (*scan, error) {
+	s, err := newScan(rootDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	opts = s.opts
+	absRoot := s.root
+
+	// Restrict the walk to an explicit list of files, whose order is kept in the output
+	var fileOrder []string
+	if opts.FromFile != "" {
+		fileOrder, err = readFileListFrom(opts.FromFile, opts.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		s.onlyFiles = restrictTo(s.onlyFiles, fileOrder)
+	}
+	if s.onlyFiles != nil {
+		s.onlyDirs = parentDirs(s.onlyFiles)
+	}
+
+	rules := s.loadRules()
+
+	// Diagnostic modes: show the rules, or explain the decision for a single path, instead of scanning
+	if opts.Explain || opts.TestPattern != "" {
+		if opts.Explain {
+			var nested []string
+			if opts.Gitignore {
+				nested = findNestedFiles(absRoot, ".gitignore")
+			}
+			if rules.ignoreName != "" {
+				nested = append(nested, findNestedFiles(absRoot, rules.ignoreName)...)
+			}
+			sort.Strings(nested)
+			printRuleSet(stdout, rules.enter(absRoot, ""), nested)
+		}
+		if opts.TestPattern != "" {
+			explainPath(stdout, absRoot, opts.TestPattern, rules, opts)
+		}
+		return s, nil
+	}
+
+	// Build in-memory tree
+	rootNode, err := s.buildRootTree(rules)
+	if err != nil {
+		return nil, fmt.Errorf("error building tree: %w", err)
+	}
+	if s.shownAs != "" {
+		rootNode.Name = s.shownAs
+	}
+	return s, s.write(rootNode, fileOrder, stdout)
+}
+
+// write writes the output for the tree at rootNode, whose files are listed in s.included
+// (and s.contentSkipped), to opts.OutFile or stdout. fileOrder, if not nil, is the order
+// the files were listed in with -from-file.
+func (s *scan) write(rootNode *Node, fileOrder []string, stdout io.Writer) error {
+	opts := s.opts
+	if s.dirsSkipped > 0 {
+		fmt.Fprintf(opts.Stderr, "cb2md: stopped descending after %d directories (-max-dirs); %d more were not scanned\n", s.dirCount, s.dirsSkipped)
+	}
+
+	// Only keep the files whose content matches, if asked to
+	if s.contentMatch != nil {
+		s.included = s.filterByContent(s.included)
+	}
+
+	// Sort the list of included files so we have a predictable order, unless it was given explicitly
+	order := func(files []string) {
+		if fileOrder != nil {
+			sortByList(files, fileOrder)
+		} else {
+			s.sortFiles(files)
+		}
+	}
+	order(s.included)
+	switch {
+	case opts.OrderDirs == "count":
+		orderDirsByCount(rootNode)
+	case opts.SortBy != "name" || opts.SortReverse:
+		orderTree(rootNode, opts)
+	}
+
+	// The files that get a section in the output: usually just the included ones, but
+	// skip-content files get one too when showing hex previews, and filtered-out files
+	// one with a placeholder. A single file given to scan always gets one, saying why
+	// its contents are left out, if they are.
+	single := s.file != "" && s.mounts == nil
+	listedFiles := s.included
+	if single || opts.HexPreview && len(s.contentSkipped) > 0 || opts.Placeholder && len(s.filtered) > 0 {
+		listedFiles = append([]string(nil), s.included...)
+		if opts.HexPreview || single {
+			for f := range s.contentSkipped {
+				listedFiles = append(listedFiles, f)
+			}
+		}
+		if opts.Placeholder || single {
+			for f := range s.filtered {
+				listedFiles = append(listedFiles, f)
+			}
+		}
+		order(listedFiles)
+	}
+
+	// Check that a huge output is really wanted before writing anything
+	if err := s.confirmOutput(listedFiles); err != nil {
+		return err
+	}
+	s.readFiles(rootNode, listedFiles)
+
+	// Write the machine-readable structure alongside the main output, if requested
+	if opts.TreeJSON != "" {
+		if err := writeTreeJSON(opts.TreeJSON, rootNode, opts.JSONPretty); err != nil {
+			return fmt.Errorf("error writing tree JSON '%s': %w", opts.TreeJSON, err)
+		}
+	}
+
+	// Report the token estimate and word counts once everything has been written
+	if opts.WordCount {
+		defer func() { printWordSummary(opts.Stderr, s.stats) }()
+	}
+	if opts.Tokens {
+		defer func() { printTokenSummary(opts.Stderr, s.stats, s.output.tokens()) }()
+	}
+	if opts.Stats && (!opts.Markdown || opts.Format != "md") {
+		defer func() { s.printStats(opts.Stderr, false) }()
+	}
+
+	// Splitting writes its own set of files
+	if opts.SplitDepth > 0 {
+		return s.writeSplitOutput(rootNode, listedFiles)
+	}
+	if opts.SplitTokens > 0 || opts.SplitSize > 0 {
+		return s.writeChunks(rootNode, listedFiles)
+	}
+
+	// Render the output up front to check it, if asked to, so that nothing gets written if it's broken
+	var validated []byte
+	if opts.Validate {
+		var buf bytes.Buffer
+		s.printOutput(&buf, rootNode, listedFiles)
+		if err := validateMarkdown(buf.Bytes()); err != nil {
+			return fmt.Errorf("invalid Markdown output, not written: %w", err)
+		}
+		validated = buf.Bytes()
+	}
+
+	// Determine output destination (stdout or file)
+	w := stdout
+	if opts.OutFile != "" {
+		// Truncate to overwrite if it exists
+		f, err := createOutputFile(opts.OutFile)
+		if err != nil {
+			return fmt.Errorf("error creating output file '%s': %w", opts.OutFile, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	// Keep a copy of the output to upload, as written
+	var upload bytes.Buffer
+	if opts.Upload != "" {
+		w = io.MultiWriter(w, &upload)
+	}
+	w, flush := wrapOutput(io.MultiWriter(w, &s.output), opts)
+	if opts.Validate {
+		fmt.Fprintf(w, "%s", validated)
+	} else {
+		s.printOutput(w, rootNode, listedFiles)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if opts.Upload != "" {
+		return opts.Uploader.Upload(s.uploadKey, upload.Bytes())
+	}
+	return nil
+}
+
+// printOutput prints the whole output for files: the optional header and legend, the
+// body (per root, when they're kept apart) and the import graph.
+func (s *scan) printOutput(w io.Writer, rootNode *Node, listedFiles []string) {
+	opts := s.opts
+
+	// JSON is a document of its own, with none of the Markdown extras
+	if opts.Format == "json" {
+		s.printJSON(w, rootNode, listedFiles)
+		return
+	}
+
+	// Summarize the repository and explain the code fence languages up front
+	if opts.FrontMatter {
+		s.printFrontMatter(w, listedFiles)
+	}
+	if opts.Markdown && opts.RepoHeader {
+		s.printRepoHeader(w, rootNode, listedFiles)
+	}
+	if opts.Markdown && opts.Legend {
+		s.printLegend(w, listedFiles)
+	}
+	if opts.Markdown && opts.MatrixIndex {
+		s.printMatrixIndex(w, s.included)
+	}
+
+	// With several roots kept apart, each gets a section of its own
+	if s.sections {
+		for i, child := range rootNode.Children {
+			// The file list ends with a blank line already; the tree alone doesn't
+			if i > 0 && !opts.Markdown {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "# %s\n\n", child.Name)
+			s.printBody(w, child, filesUnder(listedFiles, child.Name))
+		}
+	} else {
+		s.printBody(w, rootNode, listedFiles)
+	}
+	if opts.Markdown && opts.ImportGraph {
+		printImportGraph(w, s.buildImportGraph(s.included), s.included)
+	}
+	if opts.Stats && opts.Markdown && opts.Format == "md" {
+		s.printStats(w, true)
+	}
+}
+
+// printBody prints the tree at rootNode and, in Markdown mode, the table of contents and
+// the file list for files.
+func (s *scan) printBody(w io.Writer, rootNode *Node, files []string) {
+	opts := s.opts
+
+	// Print the ASCII tree
+	switch {
+	case opts.NoTree:
+		// What follows starts with a blank line to set it apart from the tree
+		w = &skipLeadingNewline{w: w}
+	case opts.Format == "xml":
+		printTreeXML(w, rootNode, opts)
+	case opts.Markdown && opts.OutFile != "":
+		// If user specifically gave a Markdown outFile, wrap the tree in triple backticks
+		fmt.Fprintln(w, "```")
+		printTree(rootNode, "", true, w, opts)
+		fmt.Fprintln(w, "```")
+	default:
+		// Otherwise just print the ASCII tree as plain text
+		printTree(rootNode, "", true, w, opts)
+	}
+
+	// If it's Markdown, we also print each file’s path + contents
+	if opts.Markdown && !opts.TreeOnly {
+		if (opts.TOC || opts.TOCDepth > 0) && opts.Format != "xml" {
+			printTOC(w, files, s.fileAnchors(files), opts.TOCDepth)
+		}
+		s.printFileList(w, files)
+	}
+}
+
+// skipLeadingNewline drops the first byte written through it if that's a newline.
+type skipLeadingNewline struct {
+	w       io.Writer
+	started bool
+}
+
+func (sw *skipLeadingNewline) Write(p []byte) (int, error) {
+	if sw.started || len(p) == 0 {
+		return sw.w.Write(p)
+	}
+	sw.started = true
+	if p[0] != '\n' {
+		return sw.w.Write(p)
+	}
+	n, err := sw.w.Write(p[1:])
+	return n + 1, err
+}
+
+// printFileHeading prints fpath's heading in the Full File List: a heading of
+// opts.HeadingLevel, or with opts.DepthHeadings, one a level deeper for each directory
+// fpath is in, down to 6.
+func (s *scan) printFileHeading(w io.Writer, fpath string) {
+	level := s.opts.HeadingLevel
+	if s.opts.DepthHeadings {
+		level = min(level+strings.Count(fpath, string(filepath.Separator)), 6)
+	}
+	fmt.Fprintf(w, "%s %s\n", strings.Repeat("#", level), s.fileHeading(fpath))
+}
+
+// fileHeading returns the text of fpath's heading in the Full File List: its path, annotated
+// with its language in a list-only dump, as a hex preview, or with its size and line count.
+func (s *scan) fileHeading(fpath string) string {
+	shown := s.shownPath(fpath)
+	switch {
+	case s.opts.ListOnly:
+		// Just the path, annotated with its language when we know it
+		if language := s.fileLanguage(fpath); language != "" {
+			return fmt.Sprintf("%s (%s)", shown, language)
+		}
+	case s.opts.HexPreview && s.contentSkipped[fpath]:
+		return shown + " (binary, hex preview)"
+	case s.opts.HeadingMeta && s.contentSkipped[fpath]:
+		// Images and such have no lines to count
+		return fmt.Sprintf("%s (%s)", shown, formatSize(s.fileSize(fpath)))
+	case s.opts.HeadingMeta:
+		lines, unit := s.fileLines(fpath), "lines"
+		if lines == 1 {
+			unit = "line"
+		}
+		return fmt.Sprintf("%s (%s, %d %s)", shown, formatSize(s.fileSize(fpath)), lines, unit)
+	}
+	return shown
+}
+
+// shownPath returns the path shown for the file at relative path fpath: fpath itself, or
+// with opts.RelativeTo, its path relative to that directory (or absolute, if the root
+// isn't below it).
+func (s *scan) shownPath(fpath string) string {
+	if s.shownAs == "" {
+		return fpath
+	}
+	return filepath.Join(s.shownAs, fpath)
+}
+
+// createOutputFile creates (or truncates) the file at path for writing, creating any
+// missing parent directories first.
+func createOutputFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating output directory: %w", err)
+	}
+	// Explicitly open with O_TRUNC to overwrite if it exists
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+}
+
+// wrapOutput applies output-wide transformations (such as -ascii-only) on top of w.
+// The returned flush function must be called once everything has been written.
+func wrapOutput(w io.Writer, opts Options) (io.Writer, func() error) {
+	flush := func() error { return nil }
+	if opts.EOL == "crlf" {
+		w = &crlfWriter{w: w}
+	}
+	if opts.Stable {
+		nw := &finalNewlineWriter{w: w}
+		w, flush = nw, nw.Flush
+	}
+	if opts.ASCIIOnly {
+		aw := &asciiWriter{w: w}
+		next := flush
+		w, flush = aw, func() error {
+			if err := aw.Flush(); err != nil {
+				return err
+			}
+			return next()
+		}
+	}
+	return w, flush
+}
+
+// printFileList prints the “Full File List” section: a heading per file followed
+// by its contents in a code block, or only the headings when opts.ListOnly is set.
+func (s *scan) printFileList(w io.Writer, files []string) {
+	opts := s.opts
+	if s.marks != nil {
+		defer s.marks.end()
+	}
+
+	if opts.Format == "xml" {
+		s.printFileListXML(w, files)
+		return
+	}
+
+	// A heading for file list
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%s Full File List\n", strings.Repeat("#", max(opts.HeadingLevel-1, 1)))
+	fmt.Fprintln(w)
+
+	for i, fpath := range files {
+		// End the previous file's section
+		if i > 0 {
+			printBackToTop(w, opts)
+			printDelimiter(w, opts)
+		}
+		if s.marks != nil {
+			s.marks.start()
+		}
+
+		// Determine language for code block
+		language := s.fileLanguage(fpath)
+
+		if opts.ListOnly {
+			s.printFileHeading(w, fpath)
+			continue
+		}
+
+		// Files a filter left out are only there to say so
+		if s.filtered[fpath] {
+			s.printFileHeading(w, fpath)
+			fmt.Fprintln(w, "_content excluded by filter_")
+			fmt.Fprintln(w)
+			continue
+		}
+
+		// Files whose content we skip only get a short hex dump
+		if opts.HexPreview && s.contentSkipped[fpath] {
+			var dump bytes.Buffer
+			err := printHexPreview(s.absPath(fpath), &dump)
+			fence := codeFence(dump.Bytes())
+			s.printFileHeading(w, fpath)
+			fmt.Fprintln(w, fence)
+			fmt.Fprintf(w, "%s", dump.Bytes())
+			if err != nil {
+				fmt.Fprintf(w, "Error reading file: %v\n", err)
+			}
+			fmt.Fprintln(w, fence)
+			fmt.Fprintln(w)
+			continue
+		}
+		if s.contentSkipped[fpath] {
+			s.printFileHeading(w, fpath)
+			fmt.Fprintln(w, "_skip-content file, contents omitted_")
+			fmt.Fprintln(w)
+			continue
+		}
+
+		// Print the file’s path, and warn readers before a big file
+		s.printFileHeading(w, fpath)
+		if size := s.fileSize(fpath); opts.LargeWarning > 0 && size > opts.LargeWarning {
+			fmt.Fprintf(w, "> ⚠️ Large file (%s)\n\n", formatSize(size))
+		}
+
+		// Optionally repeat the path inside the block, so it survives copy-pasting
+		var comment string
+		if opts.PathComment {
+			comment = pathComment(fpath, language)
+		}
+
+		// Render the file contents first: the code fence has to be longer than any run of
+		// backticks inside the block
+		content, err := s.fileContent(fpath, language)
+		if reason := s.omittedReason(err); reason != "" {
+			fmt.Fprintf(w, "_%s, contents omitted_\n\n", reason)
+			continue
+		}
+		// A size mismatch is only a warning, kept out of the block so it can't pass for part of the file
+		var sizeErr *sizeMismatchError
+		if errors.As(err, &sizeErr) {
+			fmt.Fprintf(w, "> ⚠️ Size mismatch (%v)\n\n", sizeErr)
+			err = nil
+		}
+		content = s.escapeDelimiter(fpath, content)
+		fence := codeFence([]byte(comment), content)
+
+		// Let readers expand files individually; GitHub needs blank lines around the fenced block
+		if opts.Collapsible {
+			lines, unit := countLines(content), "lines"
+			if lines == 1 {
+				unit = "line"
+			}
+			fmt.Fprintf(w, "<details><summary>%s (%d %s)</summary>\n\n", html.EscapeString(s.shownPath(fpath)), lines, unit)
+		}
+		fmt.Fprintf(w, "%s%s\n", fence, language)
+		if comment != "" {
+			fmt.Fprintln(w, comment)
+		}
+		fmt.Fprintf(w, "%s", content)
+		if err != nil {
+			fmt.Fprintf(w, "Error reading file: %v\n", err)
+		}
+		fmt.Fprintln(w, fence)
+		fmt.Fprintln(w)
+		if opts.Collapsible {
+			fmt.Fprintln(w, "</details>")
+			fmt.Fprintln(w)
+		}
+	}
+	if len(files) > 0 {
+		printBackToTop(w, opts)
+	}
+}
+
+// printBackToTop prints, with opts.BackToTop, the link back to the table of contents that
+// ends each file's section. The loop in printFileList prints it when starting the next
+// file, since each file's section can end in several ways.
+func printBackToTop(w io.Writer, opts Options) {
+	if opts.BackToTop {
+		fmt.Fprintf(w, "[↑ back to top](#%s)\n\n", headingAnchor(tocHeading))
+	}
+}
+
+// printDelimiter prints the -delimiter line between two files' sections, if any.
+func printDelimiter(w io.Writer, opts Options) {
+	if opts.Delimiter != "" {
+		fmt.Fprintln(w, opts.Delimiter)
+	}
+}
+
+// escapeDelimiter returns content, that of the file at relative path fpath, with any line
+// that is the -delimiter marker, which the output is split on, escaped with a leading
+// backslash, warning about it if so.
+func (s *scan) escapeDelimiter(fpath string, content []byte) []byte {
+	if s.opts.Delimiter == "" {
+		return content
+	}
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	var escaped bool
+	for i, line := range lines {
+		line := bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+		if string(line) == s.opts.Delimiter {
+			lines[i] = append([]byte(`\`), lines[i]...)
+			escaped = true
+		}
+	}
+	if !escaped {
+		return content
+	}
+	fmt.Fprintf(s.opts.Stderr, "cb2md: %s has a line that is the -delimiter marker; escaped it with a backslash\n", fpath)
+	return bytes.Join(lines, nil)
+}
+
+// countLines returns the number of lines in content, counting a last line without a
+// trailing newline.
+func countLines(content []byte) int {
+	n := bytes.Count(content, []byte("\n"))
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// fileContent returns the rendered content of the file at relative path fpath: as read up
+// front by readFiles, or for its heading by fileLines, if it was, or rendered now. A file
+// rendered for its heading isn't held on to once it's been asked for.
+func (s *scan) fileContent(fpath, language string) ([]byte, error) {
+	if r, ok := s.rendered[fpath]; ok && r.hasContent {
+		if s.opts.Jobs <= 1 {
+			s.rendered[fpath] = renderedFile{lines: r.lines, hash: r.hash}
+		}
+		return r.content, r.err
+	}
+	var buf bytes.Buffer
+	err := s.renderFile(&buf, fpath, language, s.stats, nil)
+	return buf.Bytes(), err
+}
+
+// fileLines returns the number of lines in the file at relative path fpath, for its
+// heading: as counted by readFiles, if it was, or else as it's read now. A file whose
+// contents are dumped is rendered now, and kept until fileContent asks for it, so it's
+// still read only once.
+func (s *scan) fileLines(fpath string) int {
+	if r, ok := s.rendered[fpath]; ok {
+		return r.lines
+	}
+	digest := &fileDigest{}
+	if s.filtered[fpath] {
+		s.digestFile(fpath, digest)
+		s.rendered[fpath] = renderedFile{lines: digest.lines()}
+		return digest.lines()
+	}
+	var buf bytes.Buffer
+	err := s.renderFile(&buf, fpath, s.fileLanguage(fpath), s.stats, digest)
+	s.rendered[fpath] = renderedFile{content: buf.Bytes(), err: err, hasContent: true, lines: digest.lines()}
+	return digest.lines()
+}
+
+// buildTree recursively walks directories to build a tree of Nodes.
+// Also populates s.included for any files we keep.
+// rules carries the ignore/skip-content rules, including .gitignore rules inherited from parent directories.
+// depth is that of currentPath below the root, which is at depth 0.
+// Errors below the root, like a dangling symlink or an unreadable directory, are reported
+// to s.opts.Stderr and the entry left out; only an error on currentPath itself is returned.
+func (s *scan) buildTree(currentPath string, rules ruleSet, depth int) (*Node, error) {
+	basePath := s.root
+
+	// Resolve symbolic links to prevent infinite loops
+	realPath, err := filepath.EvalSymlinks(currentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip if it's one of our output files
+	if s.isOutputFile(realPath) {
+		return nil, nil
+	}
+
+	// Don't follow symlinks out of the scanned directory: list them, but go no further
+	if !s.opts.FollowOutside && !isWithin(realPath, s.realRoot) {
+		return &Node{Name: filepath.Base(currentPath), Note: "outside root, skipped"}, nil
+	}
+
+	// If we've already seen this real path, skip
+	if s.visited[realPath] {
+		return nil, nil
+	}
+	s.visited[realPath] = true
+
+	info, err := os.Stat(currentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &Node{
+		Name:  info.Name(),
+		IsDir: info.IsDir(),
+	}
+	if !info.IsDir() {
+		node.Size, node.ModTime = info.Size(), info.ModTime()
+	}
+
+	if info.IsDir() {
+		// Directories at the depth limit are shown, but not what's inside
+		if s.opts.LimitDepth && depth >= s.opts.MaxDepth {
+			node.Truncated = true
+			return node, nil
+		}
+
+		// Stop descending once the directory budget is spent, but still show where
+		if s.opts.MaxDirs > 0 && s.dirCount >= s.opts.MaxDirs {
+			s.dirsSkipped++
+			node.Note = "not scanned, -max-dirs reached"
+			node.Truncated = true
+			return node, nil
+		}
+		s.dirCount++
+
+		// If it's a directory, read its contents
+		entries, err := os.ReadDir(currentPath)
+		if err != nil {
+			return nil, err
+		}
+
+		// Layer this directory's .gitignore and ignore file on top of the inherited rules
+		relDir, err := filepath.Rel(basePath, currentPath)
+		if err != nil {
+			return nil, err
+		}
+		if relDir == "." {
+			relDir = ""
+		}
+		rules = rules.enter(currentPath, relDir)
+
+		for _, e := range entries {
+			name := e.Name()
+
+			// Skip hidden (files/folders starting with "."), unless asked not to
+			if skipHidden(name, s.opts) {
+				continue
+			}
+
+			childPath := filepath.Join(currentPath, name)
+			relPath, err := filepath.Rel(basePath, childPath)
+			if err != nil {
+				return nil, err
+			}
+
+			// Check ignore rules (.ignore, -ignore-pattern and .gitignore), which may depend on
+			// whether the entry is a directory
+			isDir := isDirEntry(e, childPath)
+			if action, _ := rules.decide(relPath, isDir); action == actionExclude {
+				if !isDir {
+					s.filesIgnored++
+				}
+				continue
+			}
+
+			// When restricted to a set of files, drop every other file, and don't descend
+			// into directories holding none of them
+			if s.onlyFiles != nil && !e.IsDir() && !s.onlyFiles[relPath] {
+				continue
+			}
+			if s.onlyDirs != nil && e.IsDir() && !s.onlyDirs[relPath] {
+				continue
+			}
+
+			// Resolving symlinks adds up, so there may be a cap on how many get followed; those
+			// left out anyway don't count
+			if e.Type()&os.ModeSymlink != 0 {
+				if s.opts.MaxSymlinks > 0 && s.symlinks >= s.opts.MaxSymlinks {
+					fmt.Fprintf(s.opts.Stderr, "cb2md: skipping %s: -max-symlinks (%d) reached\n", relPath, s.opts.MaxSymlinks)
+					continue
+				}
+				s.symlinks++
+			}
+
+			// One broken symlink or unreadable directory shouldn't sink the whole walk
+			childNode, err := s.buildTree(childPath, rules, depth+1)
+			if err != nil {
+				fmt.Fprintf(s.opts.Stderr, "cb2md: skipping %s: %v\n", relPath, err)
+				continue
+			}
+			if childNode != nil {
+				node.Children = append(node.Children, childNode)
+				node.Size += childNode.Size
+				node.FileCount += childNode.FileCount
+				if childNode.ModTime.After(node.ModTime) {
+					node.ModTime = childNode.ModTime
+				}
+			}
+		}
+
+		// When restricted to a set of files, keep the tree minimal by pruning directories left empty
+		restricted := s.onlyFiles != nil || s.opts.IncludeTree && len(s.opts.Include) > 0 ||
+			s.opts.ModifiedSinceTree && !s.opts.ModifiedSince.IsZero()
+		if restricted && len(node.Children) == 0 && currentPath != basePath {
+			return nil, nil
+		}
+
+		// Sort children so the output is predictable
+		sort.Slice(node.Children, func(i, j int) bool {
+			return node.Children[i].Name < node.Children[j].Name
+		})
+
+	} else {
+		// It's a file, so let's see if we skip content
+		relPath, err := filepath.Rel(basePath, currentPath)
+		if err != nil {
+			return nil, err
+		}
+
+		// Files not whitelisted by -include are only shown in the tree, if at all
+		included := len(s.opts.Include) == 0 || matchesAnyInclude(relPath, s.opts.Include)
+		if !included && s.opts.IncludeTree {
+			return nil, nil
+		}
+
+		// Likewise for files not modified recently enough
+		if !s.opts.ModifiedSince.IsZero() && info.ModTime().Before(s.opts.ModifiedSince) {
+			if s.opts.ModifiedSinceTree {
+				return nil, nil
+			}
+			included = false
+		}
+
+		// Unless a skip-content rule (e.g. the case-insensitive defaults) wins, we add it to s.included
+		switch action, _ := rules.decide(relPath, false); {
+		case !included:
+			// In the tree only
+			s.filtered[relPath] = true
+		case action == actionSkipContent:
+			s.contentSkipped[relPath] = true
+		case s.opts.SkipGenerated && s.looksGenerated(relPath):
+			node.Note = "generated"
+		default:
+			s.included = append(s.included, relPath)
+			node.FileCount = 1
+		}
+		s.fileInfos[relPath] = info
+	}
+
+	return node, nil
+}
+
+// buildRootTree builds the tree of everything scanned: the root directory, or the single
+// file given instead, which is then the whole tree.
+func (s *scan) buildRootTree(rules ruleSet) (*Node, error) {
+	if s.file == "" {
+		return s.buildTree(s.root, rules, 0)
+	}
+	path := filepath.Join(s.root, s.file)
+	node, err := s.buildTree(path, rules.enter(s.root, ""), 0)
+	if err != nil || node != nil {
+		return node, err
+	}
+
+	// Left out of the tree: say why, as buildTree decided
+	switch realPath, _ := filepath.EvalSymlinks(path); {
+	case s.isOutputFile(realPath):
+		return nil, fmt.Errorf("%s is the output file", s.file)
+	case s.opts.IncludeTree && len(s.opts.Include) > 0 && !matchesAnyInclude(s.file, s.opts.Include):
+		return nil, fmt.Errorf("%s is filtered out by -include (with -include-tree)", s.file)
+	default:
+		return nil, fmt.Errorf("%s is filtered out by -modified-since (with -modified-since-tree)", s.file)
+	}
+}
+
+// isWithin reports whether path is dir itself or lies below it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// skipHidden reports whether the walk skips the entry called name for being hidden: any
+// name starting with "." is, unless opts.IncludeHidden is set or it matches one of
+// opts.HiddenAllow. The .git directory and the ignore files are skipped regardless.
+func skipHidden(name string, opts Options) bool {
+	if !strings.HasPrefix(name, ".") {
+		return false
+	}
+	if name == ".git" || name == filepath.Base(opts.IgnoreFile) || opts.Cb2mdIgnoreFile != "" && name == filepath.Base(opts.Cb2mdIgnoreFile) {
+		return true
+	}
+	if opts.IncludeHidden {
+		return false
+	}
+	for _, p := range opts.HiddenAllow {
+		if matched, err := filepath.Match(p, name); err == nil && matched {
+			return false
+		}
+	}
+	return true
+}
+
+// isDirEntry reports whether a directory entry is a directory, following symlinks.
+func isDirEntry(e os.DirEntry, path string) bool {
+	if e.Type()&os.ModeSymlink == 0 {
+		return e.IsDir()
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// sortFiles orders the included files in opts.SortBy order, by path or by their cached
+// size or modification time.
+func (s *scan) sortFiles(files []string) {
+	if s.opts.SortBy == "name" && !s.opts.SortReverse {
+		sort.Strings(files)
+		return
+	}
+	entry := func(f string) sortEntry {
+		e := sortEntry{name: f}
+		if info, ok := s.fileInfos[f]; ok {
+			e.size, e.modTime = info.Size(), info.ModTime()
+		}
+		return e
+	}
+	sort.Slice(files, func(i, j int) bool { return sortsBefore(s.opts, entry(files[i]), entry(files[j])) })
+}
+
+// orderTree reorders every directory's children in opts.SortBy order, as with the Full File
+// List: directories count as big as everything below them, and as new as the newest.
+func orderTree(node *Node, opts Options) {
+	sort.Slice(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		return sortsBefore(opts, sortEntry{a.Name, a.Size, a.ModTime}, sortEntry{b.Name, b.Size, b.ModTime})
+	})
+	for _, child := range node.Children {
+		orderTree(child, opts)
+	}
+}
+
+// sortEntry is what a file or directory is sorted by.
+type sortEntry struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// sortsBefore reports whether a comes before b in opts.SortBy order: by name, largest
+// first, or newest first (ties broken by name), all reversed with opts.SortReverse.
+func sortsBefore(opts Options, a, b sortEntry) bool {
+	var c int
+	switch opts.SortBy {
+	case "size":
+		c = cmp.Compare(b.size, a.size)
+	case "mtime":
+		c = b.modTime.Compare(a.modTime)
+	}
+	if c == 0 {
+		c = strings.Compare(a.name, b.name)
+	}
+	if opts.SortReverse {
+		return c > 0
+	}
+	return c < 0
+}
+
+// orderDirsByCount reorders every directory's children: subdirectories first, those holding the
+// most included files leading (ties by name), then files by name.
+func orderDirsByCount(node *Node) {
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		if a.IsDir && a.FileCount != b.FileCount {
+			return a.FileCount > b.FileCount
+		}
+		return a.Name < b.Name
+	})
+	for _, child := range node.Children {
+		if child.IsDir {
+			orderDirsByCount(child)
+		}
+	}
+}
+
+// fileSize returns the cached size of a file in the tree, or 0 if it wasn't stat-ed.
+func (s *scan) fileSize(relPath string) int64 {
+	if info, ok := s.fileInfos[relPath]; ok {
+		return info.Size()
+	}
+	return 0
+}
+
+// locate returns the root directory the file at relative path fpath is in, and its path
+// relative to that root. Without merged roots, that's s.root and fpath itself.
+func (s *scan) locate(fpath string) (root, rel string) {
+	if s.mounts == nil {
+		return s.root, fpath
+	}
+	name, rel, _ := strings.Cut(fpath, string(filepath.Separator))
+	return s.mounts[name], rel
+}
+
+// absPath returns the absolute path of the file at relative path fpath.
+func (s *scan) absPath(fpath string) string {
+	root, rel := s.locate(fpath)
+	return filepath.Join(root, rel)
+}
+
+// isOutputFile reports whether path is a file we write ourselves (including split parts).
+func (s *scan) isOutputFile(path string) bool {
+	for _, out := range s.outFiles {
+		if path == out {
+			return true
+		}
+	}
+	return s.splitOutFile != "" && isSplitPartFile(path, s.splitOutFile, s.root, s.opts.SplitDepth)
+}
+
+// printTree prints a Node (directory or file) in ASCII tree format.
+func printTree(node *Node, prefix string, isLast bool, w io.Writer, opts Options) {
+	// Size bars are scaled to the biggest node in the tree, which is the one at the top
+	printTreeNode(node, prefix, isLast, w, opts, node.Size)
+}
+
+// printTreeNode prints node and everything below it for printTree; barMax is the size
+// that gets a full-width bar with opts.SizeBars.
+func printTreeNode(node *Node, prefix string, isLast bool, w io.Writer, opts Options, barMax int64) {
+	connector := "├── "
+	if isLast {
+		connector = "└── "
+	}
+
+	// Print this node
+	label := nodeLabel(node, opts)
+	if bar := sizeBar(node.Size, barMax); opts.SizeBars && bar != "" {
+		label += " " + bar
+	}
+	fmt.Fprintln(w, prefix+connector+label)
+
+	if node.IsDir {
+		// Prepare prefix for children
+		var childPrefix string
+		if isLast {
+			childPrefix = prefix + "    "
+		} else {
+			childPrefix = prefix + "│   "
+		}
+
+		for i, child := range node.Children {
+			last := (i == len(node.Children)-1)
+			if opts.FoldChains {
+				child = foldChain(child)
+			}
+			printTreeNode(child, childPrefix, last, w, opts, barMax)
+		}
+	}
+}
+
+// sizeBarWidth is the width of a full size bar, for the biggest node in the tree.
+const sizeBarWidth = 20
+
+// sizeBar returns a bar of '#' as long as size is relative to total, out of sizeBarWidth,
+// but at least one '#' for anything that isn't empty.
+func sizeBar(size, total int64) string {
+	if size <= 0 || total <= 0 {
+		return ""
+	}
+	n := int((size*sizeBarWidth + total/2) / total)
+	return strings.Repeat("#", min(max(n, 1), sizeBarWidth))
+}
+
+// foldChain collapses a chain of directories that each hold nothing but the next one
+// (like com/example/app in a Java tree) into a single node named after the whole path,
+// with the last directory's contents. Directories with a note end the chain.
+func foldChain(node *Node) *Node {
+	if !node.IsDir || node.Note != "" {
+		return node
+	}
+	folded := node
+	for len(folded.Children) == 1 {
+		child := folded.Children[0]
+		if !child.IsDir || child.Note != "" {
+			break
+		}
+		merged := *child
+		merged.Name = folded.Name + "/" + child.Name
+		folded = &merged
+	}
+	return folded
+}
+
+// writeTreeJSON serializes the Node tree (names, IsDir, Children, and any notes and hashes) to path.
+func writeTreeJSON(path string, root *Node, pretty bool) error {
+	f, err := createOutputFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return encodeJSON(f, root, pretty)
+}
+
+// encodeJSON writes v as JSON: compact by default, or indented when pretty is set.
+func encodeJSON(w io.Writer, v any, pretty bool) error {
+	enc := json.NewEncoder(w)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
+// nodeLabel returns the text shown for a node in the tree: its name plus any requested annotations.
+func nodeLabel(node *Node, opts Options) string {
+	label := node.Name
+	if opts.Emoji {
+		label = nodeEmoji(node) + " " + label
+	}
+	if node.Note != "" {
+		label += " (" + node.Note + ")"
+	}
+	if opts.AnnotateEmptyDirs && node.IsDir && !node.Truncated && len(node.Children) == 0 {
+		label += " (empty)"
+	}
+	if opts.TreeSizes && (!node.IsDir || opts.DirSizes) {
+		label += " (" + formatSize(node.Size) + ")"
+	}
+	return label
+}
+
+// formatSize renders a byte count in human-readable form, e.g. 512 B, 2.1 KB, 3.0 MB.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 3; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// loadIgnorePatterns reads lines from the ignore file and returns them as patterns.
+func loadIgnorePatterns(ignorePath string) []string {
+	var patterns []string
+	f, err := os.Open(ignorePath)
+	if err != nil {
+		// If not found, no patterns
+		return patterns
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// matchesAnyPattern checks if relPath matches any pattern (case-sensitive, using the entire path).
+// Used for .ignore patterns so users can skip entire directories, etc. Supports "**" (see matchGlob).
+// A pattern ending in "/", like "build/", matches everything below the directories it names;
+// whether it matches relPath itself depends on relPath being a directory, which only the
+// caller knows (see ignoreRules).
+func matchesAnyPattern(relPath string, patterns []string) bool {
+	for _, p := range patterns {
+		if dir, ok := strings.CutSuffix(filepath.ToSlash(p), "/"); ok {
+			if matchesBelow(dir, relPath) {
+				return true
+			}
+			continue
+		}
+		if matchGlob(p, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesBelow reports whether one of the directories above relPath matches the glob dir.
+func matchesBelow(dir, relPath string) bool {
+	segs := strings.Split(filepath.ToSlash(relPath), "/")
+	for i := 1; i < len(segs); i++ {
+		if matchGlob(dir, strings.Join(segs[:i], "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnySkipContent checks if the base name of relPath matches any skip-content pattern (case-insensitive).
+// e.g., "photo.GIF" -> base name is "photo.gif", we match "photo.gif" against patterns like "*.gif".
+func matchesAnySkipContent(relPath string, patterns []string) bool {
+	baseName := strings.ToLower(filepath.Base(relPath)) // e.g. "photo.gif"
+	for _, p := range patterns {
+		p = strings.ToLower(p) // e.g. "*.gif"
+		matched, err := filepath.Match(p, baseName)
+		if err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// filenameLanguages maps the lowercased names of well-known files, which often have no
+// extension (or a misleading one), to their code block language.
+var filenameLanguages = map[string]string{
+	"dockerfile":     "dockerfile",
+	"makefile":       "makefile",
+	"gnumakefile":    "makefile",
+	"cmakelists.txt": "cmake",
+	"go.mod":         "go.mod",
+	"go.sum":         "go.sum",
+	".gitignore":     "gitignore",
+	".dockerignore":  "gitignore",
+}
+
+// guessLanguage attempts to guess a code block language from the file name, for
+// well-known files, or else from the file extension.
+func guessLanguage(filename string) string {
+	if lang, ok := filenameLanguages[strings.ToLower(filepath.Base(filename))]; ok {
+		return lang
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	languageMap := map[string]string{
+		".go":    "go",
+		".py":    "python",
+		".js":    "javascript",
+		".jsx":   "jsx",
+		".ts":    "typescript",
+		".tsx":   "tsx",
+		".html":  "html",
+		".css":   "css",
+		".scss":  "scss",
+		".java":  "java",
+		".rs":    "rust",
+		".sh":    "bash",
+		".rb":    "ruby",
+		".php":   "php",
+		".yaml":  "yaml",
+		".yml":   "yaml",
+		".json":  "json",
+		".md":    "markdown",
+		".c":     "c",
+		".h":     "c",
+		".cpp":   "cpp",
+		".sql":   "sql",
+		".toml":  "toml",
+		".xml":   "xml",
+		".kt":    "kotlin",
+		".swift": "swift",
+		".dart":  "dart",
+		".lua":   "lua",
+		".tf":    "hcl",
+	}
+	if lang, ok := languageMap[ext]; ok {
+		return lang
+	}
+	return "" // unknown
+}
+
+// shebangLanguages maps script interpreters, without any version suffix, to the code
+// block language of their scripts.
+var shebangLanguages = map[string]string{
+	"python": "python",
+	"bash":   "bash",
+	"zsh":    "bash",
+	"sh":     "sh",
+	"dash":   "sh",
+	"ruby":   "ruby",
+	"node":   "javascript",
+	"perl":   "perl",
+}
+
+// guessLanguageFromShebang returns the language of a script whose first line is line, if
+// that is a shebang naming a known interpreter directly (#!/bin/bash) or through env
+// (#!/usr/bin/env python3). Version suffixes like the 3 in python3 are ignored.
+func guessLanguageFromShebang(line string) string {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "#!")
+	if !ok {
+		return ""
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		// Skip env's own options, like -S
+		interpreter = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				interpreter = path.Base(f)
+				break
+			}
+		}
+	}
+	return shebangLanguages[strings.TrimRight(interpreter, "0123456789.")]
+}
+
+// fileLanguage returns the code block language of the file at relative path fpath: from
+// its name (see guessLanguage) or, failing that, from its shebang line, which is read only
+// the first time.
+func (s *scan) fileLanguage(fpath string) string {
+	if language := guessLanguage(fpath); language != "" {
+		return language
+	}
+	s.shebangLanguagesMu.Lock()
+	language, ok := s.shebangLanguages[fpath]
+	s.shebangLanguagesMu.Unlock()
+	if ok {
+		return language
+	}
+
+	language = s.shebangLanguage(fpath)
+	s.shebangLanguagesMu.Lock()
+	s.shebangLanguages[fpath] = language
+	s.shebangLanguagesMu.Unlock()
+	return language
+}
+
+// shebangLanguage returns the language named by the shebang line of the file at relative
+// path fpath, or "" if it has none.
+func (s *scan) shebangLanguage(fpath string) string {
+	r, err := s.openContent(fpath)
+	if err != nil {
+		return ""
+	}
+	defer r.Close()
+	line, _ := bufio.NewReaderSize(r, 256).ReadSlice('\n')
+	return guessLanguageFromShebang(string(line))
+}
+
+// pathComment returns a comment line containing path in the syntax of the given language,
+// or "" if the language is unknown or has no comments (e.g. JSON).
+func pathComment(path, language string) string {
+	return commentLine(path, language)
+}
+
+// commentLine wraps text in a single-line comment of the given language, or returns ""
+// if the language is unknown or has no comments.
+func commentLine(text, language string) string {
+	open, end := commentSyntax(language)
+	if open == "" {
+		return ""
+	}
+	return open + text + end
+}
+
+// commentSyntax returns how a one-line comment starts and ends in the given language,
+// or empty strings if the language is unknown or has no comments (e.g. JSON).
+func commentSyntax(language string) (open, end string) {
+	switch language {
+	case "go", "javascript", "jsx", "typescript", "tsx", "java", "rust", "php", "scss",
+		"c", "cpp", "kotlin", "swift", "dart", "go.mod":
+		return "// ", ""
+	case "python", "bash", "sh", "ruby", "perl", "yaml", "toml", "hcl", "dockerfile", "makefile", "cmake", "gitignore":
+		return "# ", ""
+	case "sql", "lua":
+		return "-- ", ""
+	case "css":
+		return "/* ", " */"
+	case "html", "markdown", "xml":
+		return "<!-- ", " -->"
+	}
+	return "", ""
+}
+
+// writeContents copies file content from r to w byte for byte. If the content doesn't end
+// with a newline, one is added so that a closing code fence starts on its own line.
+func writeContents(r io.Reader, w io.Writer) error {
+	tw := &tailWriter{w: w}
+	if _, err := io.Copy(tw, r); err != nil {
+		return err
+	}
+	if tw.wrote && tw.last != '\n' {
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// tailWriter passes writes through to w, remembering the last byte written.
+type tailWriter struct {
+	w     io.Writer
+	wrote bool
+	last  byte
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if n > 0 {
+		t.wrote, t.last = true, p[n-1]
+	}
+	return n, err
+}
+
+// writePreview copies at most limit bytes from r, whose content is size bytes long, to w.
+// If there is more, the preview is cut back to the end of the last complete line (when
+// that keeps at least half of it), and never in the middle of a UTF-8 character, followed
+// by a marker with the full size. Only one byte past the limit is read, to tell whether
+// there is more; the rest of r is left unread.
+func writePreview(r io.Reader, w io.Writer, limit, size int64) error {
+	head, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return err
+	}
+
+	if int64(len(head)) <= limit {
+		writeWithNewline(w, head)
+		return nil
+	}
+	head = head[:limit]
+	writeWithNewline(w, head[:previewCut(head)])
+	fmt.Fprintf(unnumbered(w), "... [truncated, %d bytes total]\n", max(size, limit+1))
+	return nil
+}
+
+// previewCut picks where to cut a truncated preview: after the last newline if that keeps
+// at least half of b, otherwise at the last complete UTF-8 character.
+func previewCut(b []byte) int {
+	if i := bytes.LastIndexByte(b, '\n'); i >= len(b)/2 {
+		return i + 1
+	}
+	// Back off over a trailing partial character (at most utf8.UTFMax-1 bytes)
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(b)
+}
+
+// writeWithNewline writes b, adding a final newline if it doesn't already end with one.
+func writeWithNewline(w io.Writer, b []byte) {
+	fmt.Fprintf(w, "%s", b)
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		fmt.Fprintln(w)
+	}
+}
+
+// hexPreviewBytes bounds how much of a binary file -binary-hex-preview shows.
+const hexPreviewBytes = 64
+
+// printHexPreview prints a hex+ASCII dump (in the style of `hexdump -C`) of the first
+// hexPreviewBytes of a file, noting the full size if there is more.
+func printHexPreview(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := make([]byte, hexPreviewBytes)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	fmt.Fprint(w, hex.Dump(buf[:n]))
+
+	if info, err := f.Stat(); err == nil && info.Size() > int64(n) {
+		fmt.Fprintf(w, "... (%d bytes total)\n", info.Size())
+	}
+	return nil
+}
@@ -0,0 +1,1515 @@
+// cb2md_test.go
+package cb2md
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// TestLoadIgnorePatterns ensures patterns are loaded from .ignore correctly.
+func TestLoadIgnorePatterns(t *testing.T) {
+	tmpDir := t.TempDir()
+	ignoreFile := filepath.Join(tmpDir, ".ignore")
+
+	content := []byte(`
+# This is a comment
+*.log
+secret.txt
+
+build/
+`)
+	if err := os.WriteFile(ignoreFile, content, 0o644); err != nil {
+		t.Fatalf("Failed to write .ignore: %v", err)
+	}
+
+	patterns := loadIgnorePatterns(ignoreFile)
+	want := []string{"*.log", "secret.txt", "build/"}
+	if !reflect.DeepEqual(patterns, want) {
+		t.Errorf("loadIgnorePatterns got %v, want %v", patterns, want)
+	}
+}
+
+// TestMatchesAnyPattern checks that a pattern ending in "/" matches everything below the
+// directories it names, but not a file of that name.
+func TestMatchesAnyPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		relPath string
+		want    bool
+	}{
+		{"build/", "build/index.js", true},
+		{"build/", "build/sub/deep.js", true},
+		{"build/", "build", false}, // only a directory, which the caller has to tell
+		{"build/", "src/build/index.js", false},
+		{"build/", "buildx/index.js", false},
+		{"build/sub/", "build/sub/a.js", true},
+		{"build/sub/", "build/other/a.js", false},
+		{"**/build/", "src/build/index.js", true},
+		{"build", "build", true},
+		{"*.log", "debug.log", true},
+	}
+	for _, tt := range tests {
+		if got := matchesAnyPattern(filepath.FromSlash(tt.relPath), []string{tt.pattern}); got != tt.want {
+			t.Errorf("matchesAnyPattern(%q, %q) = %v; want %v", tt.relPath, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+// TestIgnoreDirPattern checks that during the walk, "build/" ignores the build directory
+// and "build/sub/" a directory below it, while a file named build is kept.
+func TestIgnoreDirPattern(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		".ignore":            "build/\nlib/sub/\n",
+		"build/index.js":     "ignored\n",
+		"lib/sub/a.js":       "ignored\n",
+		"lib/keep.js":        "kept\n",
+		"src/build":          "kept: a file, not a directory\n",
+		"src/build.gradle":   "kept\n",
+		"lib/other/sub/b.js": "kept: sub/ is relative to the root\n",
+	})
+
+	s, err := run(tmp, Options{IgnoreFile: ".ignore"}, io.Discard)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	want := []string{
+		filepath.Join("lib", "keep.js"),
+		filepath.Join("lib", "other", "sub", "b.js"),
+		filepath.Join("src", "build"),
+		filepath.Join("src", "build.gradle"),
+	}
+	if !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+}
+
+// TestIgnoreGlobstar checks that "**" in .ignore patterns crosses directory levels during
+// the walk, while a single "*" stays within one.
+func TestIgnoreGlobstar(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		".ignore":                    "**/node_modules\na/**/b\n**/testdata/**\n*.log\n",
+		"node_modules/x/index.js":    "ignored\n",
+		"web/node_modules/y.js":      "ignored\n",
+		"a/b/one.txt":                "ignored: a/**/b matches a/b\n",
+		"a/x/y/b/two.txt":            "ignored\n",
+		"a/x/c.txt":                  "kept\n",
+		"pkg/testdata/golden.txt":    "ignored\n",
+		"pkg/main.go":                "kept\n",
+		"debug.log":                  "ignored\n",
+		"logs/debug.log":             "kept: *.log doesn't cross directories\n",
+		"web/node_modules_notes.txt": "kept\n",
+	})
+
+	s, err := run(tmp, Options{IgnoreFile: ".ignore"}, io.Discard)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	want := []string{
+		filepath.Join("a", "x", "c.txt"),
+		filepath.Join("logs", "debug.log"),
+		filepath.Join("pkg", "main.go"),
+		filepath.Join("web", "node_modules_notes.txt"),
+	}
+	if !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+}
+
+// TestMatchesAnySkipContent checks we do case-insensitive filename-only match.
+func TestMatchesAnySkipContent(t *testing.T) {
+	patterns := []string{
+		"*.png", "*.jpg", "*.jpeg", "*.gif", "*.svg", "*.webp",
+		"package-lock.json", "composer.lock",
+	}
+	tests := []struct {
+		relPath string
+		want    bool
+	}{
+		{"photo.JPG", true}, // baseName=photo.jpg, match *.jpg
+		{"photo.jpeg", true},
+		{"photo.JPEg", true},
+		{"image.png", true},
+		{"image.PNG", true},
+		{"composer.lock", true},
+		{"COMPOSER.LOCK", true}, // baseName=composer.lock
+		{"package-lock.JSON", true},
+		{"photo.txt", false},
+		{"photo.jpg.bak", false}, // baseName=photo.jpg.bak; doesn't match *.jpg
+	}
+	for _, tt := range tests {
+		got := matchesAnySkipContent(tt.relPath, patterns)
+		if got != tt.want {
+			t.Errorf("matchesAnySkipContent(%q) = %v; want %v", tt.relPath, got, tt.want)
+		}
+	}
+}
+
+// TestGuessLanguage verifies file name and extension to language mapping.
+func TestGuessLanguage(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"main.go", "go"},
+		{"script.js", "javascript"},
+		{"script.JS", "javascript"}, // checks case-insensitivity of extension
+		{"styles.css", "css"},
+		{"readme.md", "markdown"},
+		{"data.json", "json"},
+		{"unknownfile.xyz", ""},
+		{"Dockerfile", "dockerfile"},
+		{"build/dockerfile", "dockerfile"}, // file names are matched case-insensitively too
+		{"Makefile", "makefile"},
+		{"CMakeLists.txt", "cmake"},
+		{"notes.txt", ""},
+		{".gitignore", "gitignore"},
+		{"go.mod", "go.mod"},
+		{"sub/go.sum", "go.sum"},
+		{"main.tf", "hcl"},
+		{"main.c", "c"},
+		{"main.h", "c"},
+		{"main.cpp", "cpp"},
+		{"schema.sql", "sql"},
+		{"Cargo.toml", "toml"},
+		{"pom.xml", "xml"},
+		{"App.kt", "kotlin"},
+		{"App.swift", "swift"},
+		{"main.dart", "dart"},
+		{"init.lua", "lua"},
+	}
+	for _, tt := range tests {
+		got := guessLanguage(tt.filename)
+		if got != tt.want {
+			t.Errorf("guessLanguage(%q) = %q; want %q", tt.filename, got, tt.want)
+		}
+	}
+}
+
+// TestGuessLanguageFromShebang verifies interpreter-to-language mapping of shebang lines.
+func TestGuessLanguageFromShebang(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"#!/bin/bash\n", "bash"},
+		{"#!/usr/bin/env python\n", "python"},
+		{"#!/usr/bin/env python3", "python"},
+		{"#!/usr/bin/python3.11 -u\n", "python"},
+		{"#! /bin/sh\n", "sh"},
+		{"#!/usr/bin/env -S node --no-warnings\n", "javascript"},
+		{"#!/usr/bin/perl -w\n", "perl"},
+		{"#!/usr/bin/env ruby\n", "ruby"},
+		{"#!/usr/bin/env unknown-interpreter\n", ""},
+		{"echo no shebang\n", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := guessLanguageFromShebang(tt.line); got != tt.want {
+			t.Errorf("guessLanguageFromShebang(%q) = %q; want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+// TestShebangCodeFence checks that an extension-less script gets the language of its
+// shebang for its code block, while a file without one stays unlabeled.
+func TestShebangCodeFence(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"bin/deploy": "#!/usr/bin/env python3\nprint('hi')\n",
+		"bin/run":    "#!/bin/bash\necho hi\n",
+		"VERSION":    "1.2.3\n",
+	})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true})
+	for _, want := range []string{
+		"### " + filepath.Join("bin", "deploy") + "\n```python\n",
+		"### " + filepath.Join("bin", "run") + "\n```bash\n",
+		"### VERSION\n```\n1.2.3\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q:\n%s", want, got)
+		}
+	}
+}
+
+// TestPrintFileContents ensures file contents are printed as expected.
+func TestPrintFileContents(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{"hello.txt": "Hello\nWorld"})
+
+	out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true})
+	if want := "```\nHello\nWorld\n```\n"; !strings.Contains(out, want) {
+		t.Errorf("output should contain %q:\n%s", want, out)
+	}
+}
+
+// TestPrintFileContentsExact checks that content is copied byte for byte, with a newline
+// added only when needed to close the code fence.
+func TestPrintFileContentsExact(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"no newline", "no newline\n"},
+		{"two newlines\n\n", "two newlines\n\n"},
+		{"crlf\r\nline\r\n", "crlf\r\nline\r\n"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		var buf strings.Builder
+		if err := writeContents(strings.NewReader(tt.content), &buf); err != nil {
+			t.Fatalf("writeContents error: %v", err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("writeContents(%q) = %q; want %q", tt.content, buf.String(), tt.want)
+		}
+	}
+}
+
+// TestPrintFileContentsLongLine checks that a single line far beyond bufio.Scanner's 64KB limit is kept whole.
+func TestPrintFileContentsLongLine(t *testing.T) {
+	tmp := t.TempDir()
+	line := strings.Repeat("var a=1;", 200*1024/8) // 200KB, no newline
+	writeFiles(t, tmp, map[string]string{"bundle.min.js": line})
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := "```javascript\n" + line + "\n```\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("the long line didn't round-trip into the code fence (output is %d bytes)", buf.Len())
+	}
+}
+
+// TestListOnly checks that -list-only prints file headings with their language but no code fences.
+func TestListOnly(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "notes.xyz"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, ListOnly: true})
+
+	for _, want := range []string{"### main.go (go)\n", "### notes.xyz\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "```") {
+		t.Errorf("expected no code fences with -list-only, got:\n%s", got)
+	}
+	if strings.Contains(got, "package main") {
+		t.Errorf("expected no file contents with -list-only, got:\n%s", got)
+	}
+}
+
+// TestTreeOnlyNoTree checks that -tree-only prints just the tree, even for a Markdown file,
+// that -no-tree prints just the file list, and that the two can't be combined.
+func TestTreeOnlyNoTree(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{"main.go": "package main\n"})
+	treeName := filepath.Base(tmp)
+
+	outFile := filepath.Join(t.TempDir(), "tree.md")
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, OutFile: outFile, TreeOnly: true}, io.Discard); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if want := "```\n└── " + treeName + "\n    └── main.go\n```\n"; string(got) != want {
+		t.Errorf("-tree-only output:\n%s\nwant:\n%s", got, want)
+	}
+
+	out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, NoTree: true})
+	if want := "## Full File List\n\n### main.go\n```go\npackage main\n```\n\n"; out != want {
+		t.Errorf("-no-tree output:\n%s\nwant:\n%s", out, want)
+	}
+
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, TreeOnly: true, NoTree: true}, io.Discard); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("expected an error combining -tree-only and -no-tree, got %v", err)
+	}
+}
+
+// TestDepthHeadings checks that with -depth-headings, the file headings get a level
+// deeper for each directory, stopping at ######.
+func TestDepthHeadings(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":             "package main\n",
+		"cmd/run.go":          "package cmd\n",
+		"pkg/a/b/c/d/deep.go": "package d\n",
+	})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, ListOnly: true, DepthHeadings: true})
+	for _, want := range []string{
+		"\n### main.go (go)\n",
+		"\n#### " + filepath.Join("cmd", "run.go") + " (go)\n",
+		"\n###### " + filepath.Join("pkg", "a", "b", "c", "d", "deep.go") + " (go)\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q:\n%s", want, got)
+		}
+	}
+}
+
+// TestHeadingLevel checks that HeadingLevel sets the level of the file headings, with the
+// Full File List's heading one above, clamped to the levels Markdown has.
+func TestHeadingLevel(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{"main.go": "package main\n"})
+
+	for _, tt := range []struct {
+		level      int
+		list, file string
+	}{
+		{0, "## Full File List", "### main.go"},
+		{4, "### Full File List", "#### main.go"},
+		{9, "##### Full File List", "###### main.go"},
+		{1, "# Full File List", "# main.go"},
+	} {
+		out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, HeadingLevel: tt.level})
+		if want := "\n" + tt.list + "\n\n" + tt.file + "\n"; !strings.Contains(out, want) {
+			t.Errorf("HeadingLevel %d: output should contain %q:\n%s", tt.level, want, out)
+		}
+	}
+}
+
+// TestHeadingMeta checks that HeadingMeta adds each file's size and line count to its
+// heading, and so to the anchors the table of contents links to.
+func TestHeadingMeta(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":   "package main\n\nfunc main() {}\n",
+		"README.md": "# Demo",
+	})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, HeadingMeta: true, TOC: true})
+	for _, want := range []string{
+		"\n### main.go (29 B, 3 lines)\n",
+		"\n### README.md (6 B, 1 line)\n",
+		"[main.go](#maingo-29-b-3-lines)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q:\n%s", want, got)
+		}
+	}
+}
+
+// TestRelativeTo checks that RelativeTo shows the paths of the files in a scanned
+// subdirectory relative to its parent, or absolute if the root isn't below it, while
+// still reading them from where they are.
+func TestRelativeTo(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"pkg/api/handler.go": "package api\n",
+		"other/x.go":         "package other\n",
+	})
+	sub := filepath.Join(tmp, "pkg", "api")
+
+	var buf strings.Builder
+	if _, err := run(sub, Options{IgnoreFile: ".ignore", Markdown: true, RelativeTo: tmp}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"└── " + filepath.Join("pkg", "api") + "\n",
+		"\n### " + filepath.Join("pkg", "api", "handler.go") + "\n```go\npackage api\n```\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q:\n%s", want, got)
+		}
+	}
+
+	buf.Reset()
+	if _, err := run(sub, Options{IgnoreFile: ".ignore", Markdown: true, RelativeTo: filepath.Join(tmp, "other")}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := "\n### " + filepath.Join(sub, "handler.go") + "\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("outside -relative-to, output should contain %q:\n%s", want, buf.String())
+	}
+}
+
+// TestStable checks that with Stable, changing a file only changes the lines of its own
+// section of the output, which ends with a single newline.
+func TestStable(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a.go":       "package a\n",
+		"b/b.go":     "package b\n",
+		"c/d/c.go":   "package c\n",
+		"c/d/doc.md": "# C\n",
+	})
+
+	opts := Options{IgnoreFile: ".ignore", Markdown: true, TOC: true, Stable: true, HeadingMeta: true}
+	var before, after strings.Builder
+	if _, err := run(tmp, opts, &before); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	writeFiles(t, tmp, map[string]string{"b/b.go": "package b\n\n// B does more now.\nfunc B() {}\n"})
+	if _, err := run(tmp, opts, &after); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	// The lines that differ sit between the common start and end of the two outputs
+	was, now := strings.Split(before.String(), "\n"), strings.Split(after.String(), "\n")
+	start := 0
+	for start < len(was) && start < len(now) && was[start] == now[start] {
+		start++
+	}
+	end := 0
+	for end < len(was)-start && end < len(now)-start && was[len(was)-1-end] == now[len(now)-1-end] {
+		end++
+	}
+	section := strings.Join(now[:start], "\n")
+	if i := strings.LastIndex(section, "\n### "); i < 0 || !strings.HasPrefix(section[i:], "\n### "+filepath.Join("b", "b.go")+"\n") {
+		t.Errorf("changes should start in b/b.go's section, after:\n%s", section)
+	}
+	if changed := strings.Join(now[start:len(now)-end], "\n"); strings.Contains(changed, "###") {
+		t.Errorf("changes should stay in b/b.go's section, got:\n%s", changed)
+	}
+	if got := after.String(); !strings.HasSuffix(got, "```\n") || strings.HasSuffix(got, "\n\n") {
+		t.Errorf("output should end with a single newline: %q", got[max(len(got)-10, 0):])
+	}
+
+	for _, sortBy := range []string{"size", "mtime"} {
+		opts.SortBy = sortBy
+		if _, err := run(tmp, opts, &after); err == nil || !strings.Contains(err.Error(), "-sort="+sortBy) {
+			t.Errorf("-stable with -sort=%s: got error %v; want one naming it", sortBy, err)
+		}
+	}
+	opts.SortBy, opts.OrderDirs = "name", "count"
+	if _, err := run(tmp, opts, &after); err == nil || !strings.Contains(err.Error(), "-order-dirs=count") {
+		t.Errorf("-stable with -order-dirs=count: got error %v; want one naming it", err)
+	}
+}
+
+// TestSingleFile checks that scanning a file gives a one-line tree and its contents, with
+// its name as the path and its language, without the rest of its directory.
+func TestSingleFile(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":  "package main\n",
+		"other.go": "package main\n",
+	})
+
+	var buf strings.Builder
+	if _, err := run(filepath.Join(tmp, "main.go"), Options{IgnoreFile: ".ignore", Markdown: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	want := "└── main.go\n\n## Full File List\n\n### main.go\n```go\npackage main\n```\n\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestSingleFileLeftOut checks that a single file left out of the tree altogether gets an
+// error saying why: being the output file, or filtered out.
+func TestSingleFileLeftOut(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{"main.go": "package main\n", "out.md": "# old dump\n"})
+	main := filepath.Join(tmp, "main.go")
+
+	for _, tt := range []struct {
+		file string
+		opts Options
+		want string
+	}{
+		{"out.md", Options{OutFile: filepath.Join(tmp, "out.md")}, "out.md is the output file"},
+		{"main.go", Options{Include: []string{"*.py"}, IncludeTree: true}, "main.go is filtered out by -include"},
+		{"main.go", Options{ModifiedSince: time.Now().Add(time.Hour), ModifiedSinceTree: true}, "main.go is filtered out by -modified-since"},
+	} {
+		tt.opts.IgnoreFile, tt.opts.Markdown = ".ignore", true
+		_, err := run(filepath.Join(tmp, tt.file), tt.opts, new(strings.Builder))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("run(%s) error = %v; want %q", tt.file, err, tt.want)
+		}
+	}
+	if _, err := run(main, Options{IgnoreFile: ".ignore", Include: []string{"*.go"}, IncludeTree: true}, new(strings.Builder)); err != nil {
+		t.Errorf("run with a matching -include: %v", err)
+	}
+}
+
+// TestSingleFileSkipContent checks that a single skip-content file given to scan gets
+// a note in place of its contents, and a binary one the usual note, instead of garbage.
+func TestSingleFileSkipContent(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"logo.png": "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"data.bin": "abc\x00\x01\x02",
+	})
+
+	for file, want := range map[string]string{
+		"logo.png": "\n### logo.png (16 B)\n_skip-content file, contents omitted_\n",
+		"data.bin": "\n### data.bin\n_binary file, contents omitted_\n",
+	} {
+		var buf strings.Builder
+		opts := Options{IgnoreFile: ".ignore", Markdown: true, HeadingMeta: file == "logo.png"}
+		if _, err := run(filepath.Join(tmp, file), opts, &buf); err != nil {
+			t.Fatalf("run error: %v", err)
+		}
+		if got := buf.String(); !strings.Contains(got, want) || strings.Contains(got, "\x00") || strings.Contains(got, "PNG") {
+			t.Errorf("%s: output should contain %q, and no contents:\n%q", file, want, got)
+		}
+	}
+}
+
+// TestTreeJSON checks that -tree-json writes the directory structure, with file hashes, which unmarshals back into Nodes.
+func TestTreeJSON(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "project")
+	if err := os.MkdirAll(filepath.Join(root, "src"), 0o755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	for _, name := range []string{"README.md", "src/main.go"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x\n"), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	jsonPath := filepath.Join(tmp, "tree.json")
+	runOutput(t, root, Options{IgnoreFile: ".ignore", Markdown: true, TreeJSON: jsonPath})
+
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	var got Node
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	hash := "73cb3858a687a8494ca3323053016282f3dad39d42cf62ca4e79dda2aac7d9ac" // SHA-256 of "x\n"
+	want := Node{
+		Name:  "project",
+		IsDir: true,
+		Children: []*Node{
+			{Name: "README.md", Hash: hash},
+			{Name: "src", IsDir: true, Children: []*Node{{Name: "main.go", Hash: hash}}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tree JSON mismatch:\ngot  %s\nwant %+v", data, want)
+	}
+}
+
+// TestPathComment checks that -path-comment puts the file path in a comment on the first fenced line.
+func TestPathComment(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmp, "src"), 0o755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "src", "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, PathComment: true})
+
+	want := "```go\n// " + filepath.Join("src", "main.go") + "\npackage main\n```"
+	if !strings.Contains(out, want) {
+		t.Errorf("expected path comment as first fenced line, got:\n%s", out)
+	}
+
+	// Languages without comment syntax get no comment at all
+	if got := pathComment("data.json", "json"); got != "" {
+		t.Errorf("pathComment for json = %q; want empty", got)
+	}
+	if got := pathComment("run.sh", "bash"); got != "# run.sh" {
+		t.Errorf("pathComment for bash = %q; want %q", got, "# run.sh")
+	}
+}
+
+// TestEncodeJSONPretty checks that pretty output is indented but decodes to the same value as compact output.
+func TestEncodeJSONPretty(t *testing.T) {
+	root := &Node{
+		Name:  "project",
+		IsDir: true,
+		Children: []*Node{
+			{Name: "main.go"},
+			{Name: "src", IsDir: true, Children: []*Node{{Name: "util.go"}}},
+		},
+	}
+
+	var compact, pretty strings.Builder
+	if err := encodeJSON(&compact, root, false); err != nil {
+		t.Fatalf("compact encode failed: %v", err)
+	}
+	if err := encodeJSON(&pretty, root, true); err != nil {
+		t.Fatalf("pretty encode failed: %v", err)
+	}
+
+	if strings.Count(compact.String(), "\n") != 1 {
+		t.Errorf("expected compact output on a single line, got:\n%s", compact.String())
+	}
+	if !strings.Contains(pretty.String(), "\n  \"name\": \"project\"") {
+		t.Errorf("expected indented pretty output, got:\n%s", pretty.String())
+	}
+
+	var fromCompact, fromPretty Node
+	if err := json.Unmarshal([]byte(compact.String()), &fromCompact); err != nil {
+		t.Fatalf("Unmarshal compact failed: %v", err)
+	}
+	if err := json.Unmarshal([]byte(pretty.String()), &fromPretty); err != nil {
+		t.Fatalf("Unmarshal pretty failed: %v", err)
+	}
+	if !reflect.DeepEqual(fromCompact, fromPretty) {
+		t.Errorf("pretty and compact decode differently:\n%+v\n%+v", fromCompact, fromPretty)
+	}
+}
+
+// TestSortBySize checks that -sort=size orders files largest first, breaking ties by path.
+func TestSortBySize(t *testing.T) {
+	tmp := t.TempDir()
+	files := map[string]int{
+		"small.txt":  1,
+		"big.txt":    100,
+		"b-mid.txt":  10,
+		"a-mid.txt":  10,
+		"sub/z.txt":  50,
+		"sub/tie.go": 10,
+	}
+	for name, size := range files {
+		p := filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(strings.Repeat("x", size)), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	var buf strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, SortBy: "size", ListOnly: true}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	want := []string{"big.txt", filepath.Join("sub", "z.txt"), "a-mid.txt", "b-mid.txt", filepath.Join("sub", "tie.go"), "small.txt"}
+	if !reflect.DeepEqual(s.included, want) {
+		t.Errorf("size order got %v, want %v", s.included, want)
+	}
+}
+
+// TestSortModes checks that each -sort mode, and its reverse, orders both the Full File
+// List and every directory of the tree, going by the size and mtime of a directory's files.
+func TestSortModes(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a.txt":   strings.Repeat("a", 30),
+		"b.txt":   strings.Repeat("b", 10),
+		"c/d.txt": strings.Repeat("d", 20),
+	})
+	base := time.Now().Add(-24 * time.Hour)
+	for name, age := range map[string]time.Duration{"a.txt": 0, "c/d.txt": time.Hour, "b.txt": 2 * time.Hour} {
+		mtime := base.Add(age)
+		if err := os.Chtimes(filepath.Join(tmp, name), mtime, mtime); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+	}
+	d := filepath.Join("c", "d.txt")
+
+	for _, tt := range []struct {
+		sort     string
+		reverse  bool
+		files    []string
+		topLevel []string
+	}{
+		{"name", false, []string{"a.txt", "b.txt", d}, []string{"a.txt", "b.txt", "c"}},
+		{"size", false, []string{"a.txt", d, "b.txt"}, []string{"a.txt", "c", "b.txt"}},
+		{"mtime", false, []string{"b.txt", d, "a.txt"}, []string{"b.txt", "c", "a.txt"}},
+		{"name", true, []string{d, "b.txt", "a.txt"}, []string{"c", "b.txt", "a.txt"}},
+		{"size", true, []string{"b.txt", d, "a.txt"}, []string{"b.txt", "c", "a.txt"}},
+		{"mtime", true, []string{"a.txt", d, "b.txt"}, []string{"a.txt", "c", "b.txt"}},
+	} {
+		var buf strings.Builder
+		s, err := run(tmp, Options{IgnoreFile: ".ignore", SortBy: tt.sort, SortReverse: tt.reverse}, &buf)
+		if err != nil {
+			t.Fatalf("run error: %v", err)
+		}
+		if !reflect.DeepEqual(s.included, tt.files) {
+			t.Errorf("-sort=%s (reverse %v): files %v; want %v", tt.sort, tt.reverse, s.included, tt.files)
+		}
+
+		// The entries at the top of the tree are indented once below the root
+		var topLevel []string
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if name, ok := strings.CutPrefix(line, "    ├── "); ok {
+				topLevel = append(topLevel, name)
+			} else if name, ok := strings.CutPrefix(line, "    └── "); ok {
+				topLevel = append(topLevel, name)
+			}
+		}
+		if !reflect.DeepEqual(topLevel, tt.topLevel) {
+			t.Errorf("-sort=%s (reverse %v): tree %v; want %v", tt.sort, tt.reverse, topLevel, tt.topLevel)
+		}
+	}
+
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", SortBy: "age"}, &strings.Builder{}); err == nil {
+		t.Error("expected an error for an unknown -sort value")
+	}
+}
+
+// TestOrderDirsByCount checks that -order-dirs=count puts the directories holding the most
+// included files first, at every level, ties by name, ahead of the files by name.
+func TestOrderDirsByCount(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a.txt":          "a",
+		"z.txt":          "z",
+		"few/one.go":     "package few",
+		"tie_b/one.go":   "package tie",
+		"tie_b/two.go":   "package tie",
+		"tie_a/one.go":   "package tie",
+		"tie_a/two.go":   "package tie",
+		"many/m.go":      "package many",
+		"many/sub1/x.go": "package sub",
+		"many/sub2/x.go": "package sub",
+		"many/sub2/y.go": "package sub",
+	})
+
+	s, err := newScan(tmp, Options{IgnoreFile: ".ignore"})
+	if err != nil {
+		t.Fatalf("newScan error: %v", err)
+	}
+	root, err := s.buildRootTree(s.loadRules())
+	if err != nil {
+		t.Fatalf("buildRootTree error: %v", err)
+	}
+	orderDirsByCount(root)
+
+	names := func(node *Node) []string {
+		var names []string
+		for _, child := range node.Children {
+			names = append(names, child.Name)
+		}
+		return names
+	}
+	if got, want := names(root), []string{"many", "tie_a", "tie_b", "few", "a.txt", "z.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("root ordered %v; want %v", got, want)
+	}
+	if got, want := names(root.Children[0]), []string{"sub2", "sub1", "m.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("many/ ordered %v; want %v", got, want)
+	}
+}
+
+// TestDelimiter checks that the Delimiter line separates the files' sections, so the
+// output splits into one chunk per file, and that a line of a file that is the marker is
+// escaped and reported, while one merely containing it is left alone.
+func TestDelimiter(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a.go":     "package a\n",
+		"b.md":     "# B\n",
+		"c/c.go":   "package c\n",
+		"d/sep.md": "A line with <<<file>>> inside.\n",
+		"e/own.md": "Before\n<<<file>>>\nafter.\n",
+	})
+
+	var buf, stderr strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, Delimiter: "<<<file>>>", Stderr: &stderr}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	chunks := strings.Split(buf.String(), "\n<<<file>>>\n")
+	if len(chunks) != 5 {
+		t.Fatalf("got %d chunks; want one per file:\n%s", len(chunks), buf.String())
+	}
+	for i, chunk := range chunks {
+		if n := strings.Count("\n"+chunk, "\n### "); n != 1 {
+			t.Errorf("chunk %d has %d file headings; want 1:\n%s", i, n, chunk)
+		}
+	}
+	if !strings.Contains(buf.String(), "A line with <<<file>>> inside.\n") || !strings.Contains(buf.String(), "Before\n\\<<<file>>>\nafter.\n") {
+		t.Errorf("expected only the line that is the marker escaped:\n%s", buf.String())
+	}
+	if want := filepath.Join("e", "own.md") + " has a line that is the -delimiter marker"; stderr.String() != "cb2md: "+want+"; escaped it with a backslash\n" {
+		t.Errorf("stderr should only warn %q, got %q", want, stderr.String())
+	}
+
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, Delimiter: "a\nb"}, &buf); err == nil {
+		t.Error("expected an error for a multi-line delimiter")
+	}
+}
+
+// TestFormatSize checks human-readable size formatting.
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{512, "512 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{2150, "2.1 KB"},
+		{3 * 1024 * 1024, "3.0 MB"},
+		{5 * 1024 * 1024 * 1024, "5.0 GB"},
+	}
+	for _, tt := range tests {
+		if got := formatSize(tt.n); got != tt.want {
+			t.Errorf("formatSize(%d) = %q; want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+// TestTreeSizes checks that -tree-sizes annotates files, and directories only with -tree-sizes-dirs.
+func TestTreeSizes(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmp, "src"), 0o755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "main.go"), []byte(strings.Repeat("x", 2150)), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "src", "util.go"), []byte(strings.Repeat("x", 100)), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, TreeSizes: true, ListOnly: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got := buf.String()
+	for _, want := range []string{"├── main.go (2.1 KB)\n", "└── src\n", "└── util.go (100 B)\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("tree missing %q:\n%s", want, got)
+		}
+	}
+
+	buf.Reset()
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, TreeSizes: true, DirSizes: true, ListOnly: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "└── src (100 B)\n") {
+		t.Errorf("expected directory total with -tree-sizes-dirs:\n%s", buf.String())
+	}
+}
+
+// TestSizeBars checks that -size-bars follows each tree node with a bar as long as its
+// share of the whole tree, directories counting everything below them.
+func TestSizeBars(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"big.txt":       strings.Repeat("x", 600),
+		"small.txt":     strings.Repeat("x", 100),
+		"lib/mid.txt":   strings.Repeat("x", 200),
+		"lib/tiny.txt":  strings.Repeat("x", 100),
+		"lib/empty.txt": "",
+	})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", SizeBars: true})
+	// 1000 bytes in all: a full bar is 20 '#', so 50 bytes each
+	for _, want := range []string{
+		" " + strings.Repeat("#", 20) + "\n",
+		"├── big.txt " + strings.Repeat("#", 12) + "\n",
+		"├── lib " + strings.Repeat("#", 6) + "\n",
+		"│   ├── empty.txt\n",
+		"│   ├── mid.txt " + strings.Repeat("#", 4) + "\n",
+		"│   └── tiny.txt ##\n",
+		"└── small.txt ##\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("tree missing %q:\n%s", want, got)
+		}
+	}
+}
+
+// TestPrintFilePreview checks truncation at the preview size, the marker, and UTF-8 validity.
+func TestPrintFilePreview(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		preview int64
+		want    string
+	}{
+		// One long line of 2-byte characters: the cut can't use a newline and must not split a character
+		{"runes", strings.Repeat("é", 100), 51, strings.Repeat("é", 25) + "\n... [truncated, 200 bytes total]\n"},
+		// Several lines: the cut falls back to the end of the last complete line
+		{"lines", "line one\nline two\nline three\n", 22, "line one\nline two\n... [truncated, 29 bytes total]\n"},
+		// A file within the limit is printed whole, without a marker
+		{"whole", "line one\nline two\nline three\n", 1024, "line one\nline two\nline three\n"},
+	}
+	for _, tt := range tests {
+		tmp := t.TempDir()
+		writeFiles(t, tmp, map[string]string{"file.txt": tt.content})
+
+		out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, Preview: tt.preview})
+		if want := "```\n" + tt.want + "```\n"; !strings.Contains(out, want) {
+			t.Errorf("%s: output should contain %q:\n%s", tt.name, want, out)
+		}
+		if !utf8.ValidString(out) {
+			t.Errorf("%s: preview is not valid UTF-8: %q", tt.name, out)
+		}
+	}
+}
+
+// TestPreviewStripLicense checks that the preview marker gives the file's size, not that
+// of what's left once its license header is stripped.
+func TestPreviewStripLicense(t *testing.T) {
+	tmp := t.TempDir()
+	content := "// Copyright 2024 Example\n// Licensed under MIT.\n\npackage main\n\nfunc main() {\n\tprintln(\"hello, world\")\n}\n"
+	writeFiles(t, tmp, map[string]string{"main.go": content})
+
+	out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, StripLicense: true, Preview: 20})
+	if want := fmt.Sprintf("[truncated, %d bytes total]", len(content)); !strings.Contains(out, want) {
+		t.Errorf("output should contain %q:\n%s", want, out)
+	}
+	if strings.Contains(out, "Copyright") {
+		t.Errorf("license header wasn't stripped:\n%s", out)
+	}
+}
+
+// TestWritePreviewReadsLittle checks that a preview reads no more than a byte past its
+// limit, taking the total for the marker from the size it's given.
+func TestWritePreviewReadsLittle(t *testing.T) {
+	r := &countingReader{r: strings.NewReader(strings.Repeat("x", 10000))}
+	var buf strings.Builder
+	if err := writePreview(r, &buf, 100, 10000); err != nil {
+		t.Fatalf("writePreview error: %v", err)
+	}
+	if r.n > 101 {
+		t.Errorf("read %d bytes for a 100-byte preview", r.n)
+	}
+	if want := strings.Repeat("x", 100) + "\n... [truncated, 10000 bytes total]\n"; buf.String() != want {
+		t.Errorf("preview got %q, want %q", buf.String(), want)
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// TestSymlinkOutsideRoot checks that symlinks leading out of the root are listed but not followed by default.
+func TestSymlinkOutsideRoot(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "root")
+	outside := filepath.Join(tmp, "outside")
+	writeFiles(t, root, map[string]string{"main.go": "package main\n"})
+	writeFiles(t, outside, map[string]string{"secret.txt": "top secret\n"})
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "secret-link.txt")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	var buf strings.Builder
+	s, err := run(root, Options{IgnoreFile: ".ignore", Markdown: true}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got := buf.String()
+	for _, want := range []string{"link (outside root, skipped)\n", "secret-link.txt (outside root, skipped)\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("tree missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "top secret") || !reflect.DeepEqual(s.included, []string{"main.go"}) {
+		t.Errorf("expected outside files to be skipped, included %v:\n%s", s.included, got)
+	}
+
+	// Explicitly allowing it follows the links as before
+	buf.Reset()
+	if _, err := run(root, Options{IgnoreFile: ".ignore", Markdown: true, FollowOutside: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "top secret") {
+		t.Errorf("expected outside content when following is allowed:\n%s", buf.String())
+	}
+}
+
+// TestBinaryHexPreview checks that skip-content files get a bounded hex dump with -binary-hex-preview.
+func TestBinaryHexPreview(t *testing.T) {
+	tmp := t.TempDir()
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 200)...)
+	if err := os.WriteFile(filepath.Join(tmp, "logo.png"), png, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if strings.Contains(buf.String(), "### logo.png") {
+		t.Errorf("expected no section for logo.png by default:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, HexPreview: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got := buf.String()
+	want := "### logo.png (binary, hex preview)\n```\n" +
+		"00000000  89 50 4e 47 0d 0a 1a 0a  00 00 00 00 00 00 00 00  |.PNG............|\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("expected hex preview for logo.png:\n%s", got)
+	}
+	if strings.Contains(got, "00000040") {
+		t.Errorf("expected the dump to stop after %d bytes:\n%s", hexPreviewBytes, got)
+	}
+	if !strings.Contains(got, "... (208 bytes total)\n```") {
+		t.Errorf("expected the total size after the dump:\n%s", got)
+	}
+	if !strings.Contains(got, "### main.go\n```go\npackage main\n```") {
+		t.Errorf("expected regular files to be unaffected:\n%s", got)
+	}
+}
+
+// TestOutputInMissingDirectory checks that missing parent directories of -o are created.
+func TestOutputInMissingDirectory(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{"main.go": "package main\n"})
+
+	outFile := filepath.Join(t.TempDir(), "out", "nested", "dump.md")
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, OutFile: outFile}, nil); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("output file not written: %v", err)
+	}
+	if !strings.Contains(string(data), "### main.go") {
+		t.Errorf("output missing file section; got:\n%s", data)
+	}
+}
+
+// TestGenerate checks the library entry point: the Markdown output comes back as a string,
+// and runs don't leak state into each other.
+func TestGenerate(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	writeFiles(t, a, map[string]string{"main.go": "package main\n"})
+	writeFiles(t, b, map[string]string{"lib/util.py": "pass\n"})
+
+	got, err := Generate(a, Options{Markdown: true})
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	want := "└── " + filepath.Base(a) + "\n    └── main.go\n" +
+		"\n## Full File List\n\n### main.go\n```go\npackage main\n```\n\n"
+	if got != want {
+		t.Errorf("Generate got:\n%q\nwant:\n%q", got, want)
+	}
+
+	got, err = Generate(b, Options{Markdown: true})
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if strings.Contains(got, "main.go") || !strings.Contains(got, "### lib/util.py\n```python\npass\n```") {
+		t.Errorf("second run should only see its own files:\n%s", got)
+	}
+
+	// Without Markdown, only the tree is produced
+	if got, err := Generate(a, Options{}); err != nil || strings.Contains(got, "Full File List") {
+		t.Errorf("Generate without Markdown = %q, %v; want just the tree", got, err)
+	}
+}
+
+// TestBuildTree checks that the exported tree builder and printer work without a full run.
+func TestBuildTree(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"src/a.go":    "package src\n",
+		"src/b.log":   "x\n",
+		"README.md":   "# Hi\n",
+		".hidden/sec": "x\n",
+	})
+
+	root, err := BuildTree(tmp, Options{IgnorePatterns: []string{"**/*.log"}})
+	if err != nil {
+		t.Fatalf("BuildTree error: %v", err)
+	}
+	var buf strings.Builder
+	PrintTree(&buf, root, Options{})
+	want := "└── " + filepath.Base(tmp) + "\n    ├── README.md\n    └── src\n        └── a.go\n"
+	if buf.String() != want {
+		t.Errorf("PrintTree got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+// TestAnnotateEmptyDirs checks that directories without children after filtering are marked as empty.
+func TestAnnotateEmptyDirs(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"src/main.go":    "package main\n",
+		"logs/debug.log": "x\n",
+		".ignore":        "**/*.log\n",
+	})
+	if err := os.Mkdir(filepath.Join(tmp, "empty"), 0o755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", AnnotateEmptyDirs: true})
+	for _, want := range []string{"├── empty (empty)\n", "├── logs (empty)\n", "└── src\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("tree missing %q:\n%s", want, got)
+		}
+	}
+}
+
+// TestMaxDirs checks that the walk stops descending at the directory cap and reports it.
+func TestMaxDirs(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"top.go":     "package top\n",
+		"a/x/one.go": "package x\n",
+		"a/y/two.go": "package y\n",
+		"b/three.go": "package b\n",
+	})
+
+	var buf, stderr strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", MaxDirs: 3, Stderr: &stderr}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	// The root, a and a/x are scanned; a/y and b are not
+	want := []string{filepath.Join("a", "x", "one.go"), "top.go"}
+	if !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+	for _, note := range []string{"y (not scanned, -max-dirs reached)\n", "b (not scanned, -max-dirs reached)\n"} {
+		if !strings.Contains(buf.String(), note) {
+			t.Errorf("tree missing %q:\n%s", note, buf.String())
+		}
+	}
+	if want := "stopped descending after 3 directories (-max-dirs); 2 more were not scanned"; !strings.Contains(stderr.String(), want) {
+		t.Errorf("stderr got %q, want it to contain %q", stderr.String(), want)
+	}
+}
+
+// TestMaxDepth checks that directories at the depth limit are shown without their
+// contents, which stay out of the file list, while everything above is scanned.
+func TestMaxDepth(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"top.go":         "package top\n",
+		"a/one.go":       "package a\n",
+		"a/deep/two.go":  "package deep\n",
+		"a/deep/x/y.go":  "package x\n",
+		"b/three.go":     "package b\n",
+		"empty/.gitkeep": "",
+	})
+
+	var buf strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", LimitDepth: true, MaxDepth: 1, AnnotateEmptyDirs: true}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := []string{"top.go"}; !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+	want := "└── " + filepath.Base(tmp) + "\n" +
+		"    ├── a\n" +
+		"    ├── b\n" +
+		"    ├── empty\n" +
+		"    └── top.go\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	s, err = run(tmp, Options{IgnoreFile: ".ignore", LimitDepth: true, MaxDepth: 2}, io.Discard)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	want2 := []string{filepath.Join("a", "one.go"), filepath.Join("b", "three.go"), "top.go"}
+	if !reflect.DeepEqual(s.included, want2) {
+		t.Errorf("included files got %v, want %v", s.included, want2)
+	}
+
+	root, err := BuildTree(tmp, Options{IgnoreFile: ".ignore", LimitDepth: true, MaxDepth: 0})
+	if err != nil {
+		t.Fatalf("BuildTree error: %v", err)
+	}
+	if len(root.Children) != 0 || !root.Truncated {
+		t.Errorf("depth 0 should list the root only; got %d children", len(root.Children))
+	}
+}
+
+// TestFoldChains checks that a chain of single-child directories is printed as one node,
+// while a directory with several entries, or
+// a file, ends the chain.
+func TestFoldChains(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"src/main/java/com/example/app/App.java":    "class App {}\n",
+		"src/main/java/com/example/app/util/U.java": "class U {}\n",
+		"src/test/AppTest.java":                     "class AppTest {}\n",
+	})
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", FoldChains: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	want := "" +
+		"    └── src\n" +
+		"        ├── main/java/com/example/app\n" +
+		"        │   ├── App.java\n" +
+		"        │   └── util\n" +
+		"        │       └── U.java\n" +
+		"        └── test\n" +
+		"            └── AppTest.java\n"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("tree got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+// TestDanglingSymlink checks that a broken symlink is reported and left out, while the
+// rest of the tree is still built.
+func TestDanglingSymlink(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a/one.go": "package a\n",
+		"z/two.go": "package z\n",
+	})
+	if err := os.Symlink(filepath.Join(tmp, "missing.go"), filepath.Join(tmp, "a", "broken.go")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	var buf, stderr strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Stderr: &stderr}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	want := []string{filepath.Join("a", "one.go"), filepath.Join("z", "two.go")}
+	if !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+	if strings.Contains(buf.String(), "broken.go") {
+		t.Errorf("the broken symlink should be left out of the tree:\n%s", buf.String())
+	}
+	if !strings.Contains(stderr.String(), "cb2md: skipping "+filepath.Join("a", "broken.go")+": ") {
+		t.Errorf("expected a warning about the broken symlink, got %q", stderr.String())
+	}
+}
+
+// TestMaxSymlinks checks that once -max-symlinks links have been resolved, the rest are
+// left out of the tree, each with a warning.
+func TestMaxSymlinks(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{"target.txt": "hello\n"})
+	for i := 1; i <= 5; i++ {
+		if err := os.Symlink(filepath.Join(tmp, "target.txt"), filepath.Join(tmp, fmt.Sprintf("link%d.txt", i))); err != nil {
+			t.Fatalf("Symlink failed: %v", err)
+		}
+	}
+
+	var buf, stderr strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", MaxSymlinks: 2, Stderr: &stderr}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		name := fmt.Sprintf("link%d.txt", i)
+		warning := "cb2md: skipping " + name + ": -max-symlinks (2) reached\n"
+		if i <= 2 {
+			if strings.Contains(stderr.String(), warning) {
+				t.Errorf("%s is within the cap and shouldn't be skipped: %q", name, stderr.String())
+			}
+			continue
+		}
+		if strings.Contains(buf.String(), name) {
+			t.Errorf("%s is over the cap and should be left out of the tree:\n%s", name, buf.String())
+		}
+		if !strings.Contains(stderr.String(), warning) {
+			t.Errorf("expected warning %q, got %q", warning, stderr.String())
+		}
+	}
+
+	// Ignored links don't use up the cap
+	tmp = t.TempDir()
+	for i := 1; i <= 5; i++ {
+		target := filepath.Join("targets", fmt.Sprintf("t%d.txt", i))
+		writeFiles(t, tmp, map[string]string{target: "hello\n"})
+		if err := os.Symlink(filepath.Join(tmp, target), filepath.Join(tmp, fmt.Sprintf("link%d.txt", i))); err != nil {
+			t.Fatalf("Symlink failed: %v", err)
+		}
+	}
+	buf.Reset()
+	stderr.Reset()
+	opts := Options{IgnoreFile: ".ignore", IgnorePatterns: []string{"link1.txt", "link2.txt"}, MaxSymlinks: 2, Stderr: &stderr}
+	if _, err := run(tmp, opts, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	for _, name := range []string{"link3.txt", "link4.txt"} {
+		if !strings.Contains(buf.String(), name) {
+			t.Errorf("%s is within the cap once link1 and link2 are ignored:\n%s", name, buf.String())
+		}
+	}
+	if want := "cb2md: skipping link5.txt: -max-symlinks (2) reached\n"; stderr.String() != want {
+		t.Errorf("stderr = %q; want only %q", stderr.String(), want)
+	}
+}
+
+// TestUnreadableDir checks that a directory that can't be read is reported and left out,
+// while its siblings are still scanned.
+func TestUnreadableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any directory")
+	}
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"locked/secret.go": "package locked\n",
+		"open/main.go":     "package open\n",
+	})
+	locked := filepath.Join(tmp, "locked")
+	if err := os.Chmod(locked, 0o000); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0o755) })
+
+	var buf, stderr strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Stderr: &stderr}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := []string{filepath.Join("open", "main.go")}; !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+	if !strings.Contains(stderr.String(), "cb2md: skipping locked: ") {
+		t.Errorf("expected a warning about the unreadable directory, got %q", stderr.String())
+	}
+}
+
+// TestInclude checks that -include acts as a whitelist after the ignore rules: only the Go
+// files are listed, while the tree still shows the rest, unless IncludeTree is set.
+func TestInclude(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":           "package main\n",
+		"README.md":         "# Readme\n",
+		"web/app.ts":        "let x = 1;\n",
+		"pkg/util.go":       "package pkg\n",
+		"pkg/util_gen.go":   "package pkg\n",
+		"vendor/lib/lib.go": "package lib\n",
+		".ignore":           "vendor\n**/*_gen.go\n",
+	})
+
+	var buf strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, Include: []string{"*.go"}}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	want := []string{"main.go", filepath.Join("pkg", "util.go")}
+	if !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+	got := buf.String()
+	if !strings.Contains(got, "├── README.md\n") || !strings.Contains(got, "app.ts\n") {
+		t.Errorf("the tree should still show the other files:\n%s", got)
+	}
+	if strings.Contains(got, "### README.md") {
+		t.Errorf("README.md should not be in the Full File List:\n%s", got)
+	}
+
+	buf.Reset()
+	s, err = run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, Include: []string{"go"}, IncludeTree: true}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files with IncludeTree got %v, want %v", s.included, want)
+	}
+	if got := buf.String(); strings.Contains(got, "README.md") || strings.Contains(got, "web") {
+		t.Errorf("the tree should only show the Go files:\n%s", got)
+	}
+}
+
+// TestModifiedSince checks that files modified before -modified-since stay in the tree
+// but out of the file list, and with -modified-since-tree, out of the tree too.
+func TestModifiedSince(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"new.go":     "package main\n",
+		"old/old.go": "package old\n",
+	})
+	since := time.Now().Add(-24 * time.Hour)
+	for name, mtime := range map[string]time.Time{
+		"new.go":     since.Add(time.Minute),
+		"old/old.go": since.Add(-time.Minute),
+	} {
+		if err := os.Chtimes(filepath.Join(tmp, name), mtime, mtime); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+	}
+
+	var buf strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", ModifiedSince: since}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := []string{"new.go"}; !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+	if !strings.Contains(buf.String(), "old.go") {
+		t.Errorf("old.go should still be in the tree:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", ModifiedSince: since, ModifiedSinceTree: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if strings.Contains(buf.String(), "old") {
+		t.Errorf("old.go and its directory should be left out of the tree:\n%s", buf.String())
+	}
+}
+
+// TestIncludeHidden checks that hidden files and directories are skipped by default, that
+// IncludeHidden lists them (but never .git or the ignore file), and that HiddenAllow lets
+// only the matching ones through.
+func TestIncludeHidden(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":                  "package main\n",
+		".github/workflows/ci.yml": "on: push\n",
+		".env.example":             "PORT=8080\n",
+		".eslintrc":                "{}\n",
+		".ignore":                  "**/*.log\n",
+		".git/HEAD":                "ref: refs/heads/main\n",
+		".cache/debug.log":         "x\n",
+	})
+
+	for _, tt := range []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"default", Options{}, []string{"main.go"}},
+		{"include hidden", Options{IncludeHidden: true}, []string{".env.example", ".eslintrc", filepath.Join(".github", "workflows", "ci.yml"), "main.go"}},
+		{"hidden allow", Options{HiddenAllow: []string{".github", ".env.*"}}, []string{".env.example", filepath.Join(".github", "workflows", "ci.yml"), "main.go"}},
+	} {
+		tt.opts.IgnoreFile = ".ignore"
+		var buf strings.Builder
+		s, err := run(tmp, tt.opts, &buf)
+		if err != nil {
+			t.Fatalf("%s: run error: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(s.included, tt.want) {
+			t.Errorf("%s: included files got %v, want %v", tt.name, s.included, tt.want)
+		}
+		if got := buf.String(); strings.Contains(got, ".git\n") || strings.Contains(got, ".ignore") {
+			t.Errorf("%s: .git and .ignore should never be listed:\n%s", tt.name, got)
+		}
+	}
+}
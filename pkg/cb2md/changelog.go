@@ -0,0 +1,138 @@
+package cb2md
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+)
+
+// ReadTreeJSON reads a tree written with -tree-json.
+func ReadTreeJSON(path string) (*Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var root Node
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("error parsing tree JSON '%s': %w", path, err)
+	}
+	return &root, nil
+}
+
+// treeFiles returns the hash of every file below root, keyed by its slash-separated path
+// relative to root.
+func treeFiles(root *Node) map[string]string {
+	files := make(map[string]string)
+	var walk func(node *Node, relPath string)
+	walk = func(node *Node, relPath string) {
+		for _, child := range node.Children {
+			childPath := path.Join(relPath, child.Name)
+			if child.IsDir {
+				walk(child, childPath)
+			} else {
+				files[childPath] = child.Hash
+			}
+		}
+	}
+	walk(root, "")
+	return files
+}
+
+// structureChange is a file added, removed or renamed between two trees.
+type structureChange struct {
+	kind     string // "added", "removed" or "renamed"
+	path     string // the file's path: the new one, except for removed files
+	fromPath string // for renamed files, the old path
+}
+
+// diffTrees compares two trees and returns the files added, removed and renamed between
+// them, sorted by path. A removed and an added file with the same content hash count as
+// a rename; with several candidates, they are paired in path order.
+func diffTrees(oldTree, newTree *Node) []structureChange {
+	oldFiles, newFiles := treeFiles(oldTree), treeFiles(newTree)
+
+	var added, removed []string
+	for p := range newFiles {
+		if _, ok := oldFiles[p]; !ok {
+			added = append(added, p)
+		}
+	}
+	for p := range oldFiles {
+		if _, ok := newFiles[p]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	// Pair up removed and added files by content hash
+	removedByHash := make(map[string][]string)
+	for _, p := range removed {
+		if h := oldFiles[p]; h != "" {
+			removedByHash[h] = append(removedByHash[h], p)
+		}
+	}
+	renamedFrom := make(map[string]bool)
+	var changes []structureChange
+	for _, p := range added {
+		if candidates := removedByHash[newFiles[p]]; newFiles[p] != "" && len(candidates) > 0 {
+			removedByHash[newFiles[p]] = candidates[1:]
+			renamedFrom[candidates[0]] = true
+			changes = append(changes, structureChange{kind: "renamed", path: p, fromPath: candidates[0]})
+		} else {
+			changes = append(changes, structureChange{kind: "added", path: p})
+		}
+	}
+	for _, p := range removed {
+		if !renamedFrom[p] {
+			changes = append(changes, structureChange{kind: "removed", path: p})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].path < changes[j].path })
+	return changes
+}
+
+// WriteChangelog writes a Markdown changelog of the files added, removed and renamed
+// between two trees (as read with ReadTreeJSON), grouped by directory.
+func WriteChangelog(w io.Writer, oldTree, newTree *Node) {
+	changes := diffTrees(oldTree, newTree)
+	counts := make(map[string]int)
+	byDir := make(map[string][]structureChange)
+	for _, c := range changes {
+		counts[c.kind]++
+		byDir[path.Dir(c.path)] = append(byDir[path.Dir(c.path)], c)
+	}
+
+	fmt.Fprintln(w, "# Structure Changelog")
+	fmt.Fprintln(w)
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No structural changes.")
+		return
+	}
+	fmt.Fprintf(w, "%d added, %d removed, %d renamed.\n", counts["added"], counts["removed"], counts["renamed"])
+
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		fmt.Fprintln(w)
+		if dir == "." {
+			fmt.Fprintln(w, "## (root)")
+		} else {
+			fmt.Fprintf(w, "## %s/\n", dir)
+		}
+		fmt.Fprintln(w)
+		for _, c := range byDir[dir] {
+			if c.kind == "renamed" {
+				fmt.Fprintf(w, "- renamed `%s` → `%s`\n", c.fromPath, c.path)
+			} else {
+				fmt.Fprintf(w, "- %s `%s`\n", c.kind, c.path)
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package cb2md
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestChangelog checks the classification of files between two JSON snapshots: a moved
+// file with unchanged content is a rename, anything else is added or removed.
+func TestChangelog(t *testing.T) {
+	dir := t.TempDir()
+	oldJSON := `{"name":"app","isDir":true,"children":[
+		{"name":"README.md","hash":"r1"},
+		{"name":"src","isDir":true,"children":[
+			{"name":"old.go","hash":"o1"},
+			{"name":"util.go","hash":"u1"},
+			{"name":"same.go","hash":"s1"}
+		]}
+	]}`
+	newJSON := `{"name":"app","isDir":true,"children":[
+		{"name":"README.md","hash":"r2"},
+		{"name":"lib","isDir":true,"children":[
+			{"name":"util.go","hash":"u1"}
+		]},
+		{"name":"src","isDir":true,"children":[
+			{"name":"new.go","hash":"n1"},
+			{"name":"same.go","hash":"s1"}
+		]}
+	]}`
+	oldPath, newPath := filepath.Join(dir, "old.json"), filepath.Join(dir, "new.json")
+	for p, data := range map[string]string{oldPath: oldJSON, newPath: newJSON} {
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	oldTree, err := ReadTreeJSON(oldPath)
+	if err != nil {
+		t.Fatalf("ReadTreeJSON error: %v", err)
+	}
+	newTree, err := ReadTreeJSON(newPath)
+	if err != nil {
+		t.Fatalf("ReadTreeJSON error: %v", err)
+	}
+
+	want := []structureChange{
+		{kind: "renamed", path: "lib/util.go", fromPath: "src/util.go"},
+		{kind: "added", path: "src/new.go"},
+		{kind: "removed", path: "src/old.go"},
+	}
+	if got := diffTrees(oldTree, newTree); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffTrees = %+v; want %+v", got, want)
+	}
+
+	var buf strings.Builder
+	WriteChangelog(&buf, oldTree, newTree)
+	wantMD := "# Structure Changelog\n\n" +
+		"1 added, 1 removed, 1 renamed.\n\n" +
+		"## lib/\n\n" +
+		"- renamed `src/util.go` → `lib/util.go`\n\n" +
+		"## src/\n\n" +
+		"- added `src/new.go`\n" +
+		"- removed `src/old.go`\n"
+	if buf.String() != wantMD {
+		t.Errorf("changelog:\n%s\nwant:\n%s", buf.String(), wantMD)
+	}
+}
+
+// TestChangelogFromDumps checks that two -tree-json dumps of a directory before and after
+// moving a file show it as renamed.
+func TestChangelogFromDumps(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{"a/config.go": "package a\n", "main.go": "package main\n"})
+	oldPath, newPath := filepath.Join(t.TempDir(), "old.json"), filepath.Join(t.TempDir(), "new.json")
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", TreeJSON: oldPath}, new(strings.Builder)); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if err := os.Rename(filepath.Join(tmp, "a"), filepath.Join(tmp, "b")); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", TreeJSON: newPath}, new(strings.Builder)); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	oldTree, _ := ReadTreeJSON(oldPath)
+	newTree, _ := ReadTreeJSON(newPath)
+	want := []structureChange{{kind: "renamed", path: "b/config.go", fromPath: "a/config.go"}}
+	if got := diffTrees(oldTree, newTree); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffTrees = %+v; want %+v", got, want)
+	}
+}
+
+// TestConcurrentHashes checks that hashing the files of a -tree-json dump with several
+// workers gives every file the same hash as hashing them one at a time.
+func TestConcurrentHashes(t *testing.T) {
+	tmp := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 40; i++ {
+		files[fmt.Sprintf("dir%d/file%02d.txt", i%4, i)] = strings.Repeat(fmt.Sprintf("line %d\n", i), i)
+	}
+	writeFiles(t, tmp, files)
+
+	trees := make(map[int]*Node)
+	for _, jobs := range []int{1, 8} {
+		path := filepath.Join(t.TempDir(), "tree.json")
+		if _, err := run(tmp, Options{IgnoreFile: ".ignore", TreeJSON: path, Jobs: jobs}, io.Discard); err != nil {
+			t.Fatalf("run error: %v", err)
+		}
+		tree, err := ReadTreeJSON(path)
+		if err != nil {
+			t.Fatalf("ReadTreeJSON failed: %v", err)
+		}
+		trees[jobs] = tree
+	}
+
+	hashes := treeFiles(trees[8])
+	if len(hashes) != len(files) {
+		t.Fatalf("got %d hashed files, want %d", len(hashes), len(files))
+	}
+	if seq := treeFiles(trees[1]); !reflect.DeepEqual(hashes, seq) {
+		t.Errorf("concurrent hashes %v differ from sequential ones %v", hashes, seq)
+	}
+	for name, content := range files {
+		sum := sha256.Sum256([]byte(content))
+		if want := hex.EncodeToString(sum[:]); hashes[name] != want {
+			t.Errorf("hash of %s = %q; want %q", name, hashes[name], want)
+		}
+	}
+}
+
+// TestHashSkipsNotedNodes checks that a symlink out of the root, listed in the tree with a
+// note, isn't opened to hash it, while the files in the root are hashed.
+func TestHashSkipsNotedNodes(t *testing.T) {
+	tmp, outside := t.TempDir(), t.TempDir()
+	writeFiles(t, tmp, map[string]string{"a.txt": "inside\n"})
+	writeFiles(t, outside, map[string]string{"secret.txt": "outside\n"})
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(tmp, "link.txt")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	var opened []string
+	defer func(orig func(string) (fs.File, error)) { osOpen = orig }(osOpen)
+	osOpen = func(name string) (fs.File, error) {
+		opened = append(opened, filepath.Base(name))
+		return os.Open(name)
+	}
+
+	path := filepath.Join(t.TempDir(), "tree.json")
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", TreeJSON: path, Jobs: 1}, io.Discard); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	tree, err := ReadTreeJSON(path)
+	if err != nil {
+		t.Fatalf("ReadTreeJSON failed: %v", err)
+	}
+	sum := sha256.Sum256([]byte("inside\n"))
+	want := map[string]string{"a.txt": hex.EncodeToString(sum[:]), "link.txt": ""}
+	if got := treeFiles(tree); !reflect.DeepEqual(got, want) {
+		t.Errorf("hashes = %v; want %v", got, want)
+	}
+	if !reflect.DeepEqual(opened, []string{"a.txt"}) {
+		t.Errorf("opened %v; want only a.txt", opened)
+	}
+}
+
+// BenchmarkHashFiles compares hashing a synthetic tree of files for -tree-json one at a
+// time and with a worker per CPU (at least two).
+func BenchmarkHashFiles(b *testing.B) {
+	tmp := writeBenchTree(b, "txt", func(i int) string {
+		return strings.Repeat(fmt.Sprintf("row %d\n", i), 2000)
+	})
+
+	for _, jobs := range []int{1, max(2, runtime.NumCPU())} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			s, err := newScan(tmp, Options{IgnoreFile: ".ignore", Jobs: jobs, TreeJSON: filepath.Join(b.TempDir(), "tree.json")})
+			if err != nil {
+				b.Fatalf("newScan failed: %v", err)
+			}
+			root, err := s.buildTree(s.root, s.loadRules(), 0)
+			if err != nil {
+				b.Fatalf("buildTree failed: %v", err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.readFiles(root, nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package cb2md
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// sectionMarks records where each file's section of the file list starts and ends in
+// body, as printFileList writes it, so the output can be cut between files.
+type sectionMarks struct {
+	body  *bytes.Buffer
+	spans [][2]int
+	open  bool
+}
+
+// start ends the section being written, if any, and starts the next one.
+func (m *sectionMarks) start() {
+	m.end()
+	m.spans = append(m.spans, [2]int{m.body.Len(), 0})
+	m.open = true
+}
+
+// end ends the section being written, if any.
+func (m *sectionMarks) end() {
+	if m.open {
+		m.spans[len(m.spans)-1][1] = m.body.Len()
+		m.open = false
+	}
+}
+
+// outputChunk is one part of a split output: the file sections it holds, as indexes into
+// the marked spans, with whatever comes before each of them in the output.
+type outputChunk struct {
+	from, to int // spans[from:to] belong to this chunk
+	size     int // in estimated tokens or bytes, whichever the output is split by
+}
+
+// countTokens estimates the number of LLM tokens in text; see estimateTokens.
+func countTokens(text []byte) int {
+	var c charCounter
+	fmt.Fprintf(&c, "%s", text)
+	return c.tokens()
+}
+
+// chunkSpans packs the file sections marked in body into chunks of at most budget each,
+// as measured by size (estimated tokens or bytes), keeping the sections whole and in
+// order. Whatever precedes a section (the tree, headings) goes with it, and a section too
+// big for the budget gets a chunk of its own. The overlap (in tokens) each chunk after the
+// first starts with counts against its budget, too.
+func chunkSpans(body []byte, spans [][2]int, budget, overlap int, size func([]byte) int) []outputChunk {
+	var chunks []outputChunk
+	cur := outputChunk{}
+	prevEnd := 0
+	for i, span := range spans {
+		n := size(body[prevEnd:span[1]])
+		if cur.to > cur.from && cur.size+n > budget {
+			chunks = append(chunks, cur)
+			cur = outputChunk{from: i, to: i}
+			cur.size = size(overlapText(body, spans, chunks[len(chunks)-1], overlap))
+		}
+		cur.to = i + 1
+		cur.size += n
+		prevEnd = span[1]
+	}
+	return append(chunks, cur)
+}
+
+// byteLen is a chunkSpans measure for splitting by bytes.
+func byteLen(text []byte) int { return len(text) }
+
+// overlapText returns the sections at the end of chunk c to repeat at the start of the
+// next chunk: as many of its last sections as fit in overlap tokens, but at least the
+// last one, so a chunk boundary never cuts a file in half. It returns nil if overlap is 0.
+func overlapText(body []byte, spans [][2]int, c outputChunk, overlap int) []byte {
+	if overlap <= 0 || c.to == c.from {
+		return nil
+	}
+	from, tokens := c.to-1, countTokens(body[spans[c.to-1][0]:spans[c.to-1][1]])
+	for from > c.from {
+		n := countTokens(body[spans[from-1][0]:spans[from-1][1]])
+		if tokens+n > overlap {
+			break
+		}
+		from, tokens = from-1, tokens+n
+	}
+
+	var text []byte
+	for _, span := range spans[from:c.to] {
+		text = append(text, body[span[0]:span[1]]...)
+	}
+	return text
+}
+
+// writeChunks writes the output as numbered parts next to opts.OutFile, e.g.
+// "tree.part1.md", "tree.part2.md", each of about opts.SplitTokens estimated tokens or
+// opts.SplitSize bytes, never cutting a file's section in two. The first part starts with
+// the tree; with opts.Overlap, each later part with the last opts.Overlap tokens' worth of
+// files of the part before it, so a reader fed one part at a time keeps some context.
+func (s *scan) writeChunks(rootNode *Node, files []string) error {
+	opts := s.opts
+
+	// Render the whole output first, noting where each file's section is
+	var body bytes.Buffer
+	s.marks = &sectionMarks{body: &body}
+	s.printOutput(&body, rootNode, files)
+	spans := s.marks.spans
+	s.marks = nil
+
+	out := body.Bytes()
+	var chunks []outputChunk
+	if opts.SplitSize > 0 {
+		chunks = chunkSpans(out, spans, int(opts.SplitSize), opts.Overlap, byteLen)
+	} else {
+		chunks = chunkSpans(out, spans, opts.SplitTokens, opts.Overlap, countTokens)
+	}
+	outDir := filepath.Dir(opts.OutFile)
+	for i, c := range chunks {
+		// A chunk runs from the end of the last section before it to the end of its own
+		// last section; the last chunk also gets whatever follows the file list
+		start, end := 0, len(out)
+		if c.from > 0 {
+			start = spans[c.from-1][1]
+		}
+		if i < len(chunks)-1 {
+			end = spans[c.to-1][1]
+		}
+
+		partPath := filepath.Join(outDir, splitPartName(opts.OutFile, fmt.Sprintf("part%d", i+1)))
+		if err := s.writeFile(partPath, func(w io.Writer) {
+			if i > 0 {
+				fmt.Fprintf(w, "## Part %d of %d\n\n", i+1, len(chunks))
+				if overlap := overlapText(out, spans, chunks[i-1], opts.Overlap); overlap != nil {
+					fmt.Fprintf(w, "> Repeated from the end of part %d\n\n", i)
+					fmt.Fprintf(w, "%s", overlap)
+					fmt.Fprintln(w, "---")
+					fmt.Fprintln(w)
+				}
+			}
+			fmt.Fprintf(w, "%s", out[start:end])
+		}); err != nil {
+			return fmt.Errorf("error writing part '%s': %w", partPath, err)
+		}
+	}
+	return nil
+}
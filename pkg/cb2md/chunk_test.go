@@ -0,0 +1,138 @@
+package cb2md
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSplitTokensOverlap checks that -split-tokens cuts the output into numbered parts
+// between files, and that with -overlap each part starts with the last file of the part
+// before it.
+func TestSplitTokensOverlap(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "repo")
+	files := make(map[string]string)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		// About 100 tokens each
+		files[name+".txt"] = strings.Repeat(name+"xxxxxxxxx ", 40) + "\n"
+	}
+	writeFiles(t, root, files)
+
+	outFile := filepath.Join(tmp, "out", "tree.md")
+	if _, err := run(root, Options{IgnoreFile: ".ignore", Markdown: true, OutFile: outFile, SplitTokens: 300, Overlap: 150}, os.Stdout); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	parts, err := filepath.Glob(filepath.Join(tmp, "out", "tree.part*.md"))
+	if err != nil {
+		t.Fatalf("Glob failed: %v", err)
+	}
+	if len(parts) < 3 {
+		t.Fatalf("expected at least 3 parts, got %d: %v", len(parts), parts)
+	}
+	if _, err := os.Stat(outFile); !os.IsNotExist(err) {
+		t.Errorf("%s should not be written, only its parts", outFile)
+	}
+
+	var prev string
+	for i := range parts {
+		data, err := os.ReadFile(filepath.Join(tmp, "out", fmt.Sprintf("tree.part%d.md", i+1)))
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		part := string(data)
+		if i == 0 {
+			if !strings.HasPrefix(part, "```\n└── repo\n") {
+				t.Errorf("part 1 should start with the tree:\n%s", part)
+			}
+			prev = part
+			continue
+		}
+
+		// The last file section of the previous part comes first, marked as repeated
+		last := prev[strings.LastIndex(prev, "### "):]
+		wantStart := fmt.Sprintf("## Part %d of %d\n\n> Repeated from the end of part %d\n\n%s---\n\n", i+1, len(parts), i, last)
+		if !strings.HasPrefix(part, wantStart) {
+			t.Errorf("part %d should start with the end of part %d:\n%s\nwant prefix:\n%s", i+1, i, part, wantStart)
+		}
+		if n := countTokens(data); n > 300 {
+			t.Errorf("part %d has %d tokens; want at most 300", i+1, n)
+		}
+		prev = part
+	}
+}
+
+// TestSplitTokensNoOverlap checks that without -overlap each file is in exactly one part.
+func TestSplitTokensNoOverlap(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "repo")
+	writeFiles(t, root, map[string]string{
+		"a.txt": strings.Repeat("ax ", 200) + "\n",
+		"b.txt": strings.Repeat("bx ", 200) + "\n",
+	})
+
+	outFile := filepath.Join(tmp, "tree.md")
+	if _, err := run(root, Options{IgnoreFile: ".ignore", Markdown: true, OutFile: outFile, SplitTokens: 200}, os.Stdout); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	var all string
+	for i := 1; i <= 2; i++ {
+		data, err := os.ReadFile(filepath.Join(tmp, fmt.Sprintf("tree.part%d.md", i)))
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		all += string(data)
+	}
+	for _, heading := range []string{"### a.txt\n", "### b.txt\n"} {
+		if n := strings.Count(all, heading); n != 1 {
+			t.Errorf("%q appears %d times across parts; want 1", heading, n)
+		}
+	}
+}
+
+// TestSplitSize checks that -split-size starts a new part once the output reaches the
+// size, with the tree in part 1 and each file's section whole in exactly one part.
+func TestSplitSize(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "repo")
+	files := make(map[string]string)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		files[name+".txt"] = strings.Repeat(name, 300) + "\n"
+	}
+	writeFiles(t, root, files)
+
+	outFile := filepath.Join(tmp, "tree.md")
+	if _, err := run(root, Options{IgnoreFile: ".ignore", Markdown: true, OutFile: outFile, SplitSize: 700}, os.Stdout); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	parts, err := filepath.Glob(filepath.Join(tmp, "tree.part*.md"))
+	if err != nil {
+		t.Fatalf("Glob failed: %v", err)
+	}
+	if len(parts) < 2 {
+		t.Fatalf("expected several parts, got %d: %v", len(parts), parts)
+	}
+	var all string
+	for i := range parts {
+		data, err := os.ReadFile(filepath.Join(tmp, fmt.Sprintf("tree.part%d.md", i+1)))
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		part := string(data)
+		if hasTree := strings.HasPrefix(part, "```\n└── repo\n"); hasTree != (i == 0) {
+			t.Errorf("only part 1 should start with the tree:\n%s", part)
+		}
+		all += part
+	}
+	for name, content := range files {
+		section := "### " + name + "\n```\n" + content + "```\n"
+		if n := strings.Count(all, section); n != 1 {
+			t.Errorf("the whole section of %s appears %d times across parts; want 1", name, n)
+		}
+	}
+}
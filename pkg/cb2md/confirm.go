@@ -0,0 +1,50 @@
+package cb2md
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCanceled is returned when the output would be larger than Options.ConfirmOver and
+// Options.Confirm declined to write it.
+var ErrCanceled = errors.New("canceled: output not written")
+
+// confirmOutput asks s.opts.Confirm whether to go ahead if the estimated size of the
+// output for files exceeds s.opts.ConfirmOver, returning ErrCanceled if not. Without a
+// Confirm function there's nobody to ask, and the output is written.
+func (s *scan) confirmOutput(files []string) error {
+	if s.opts.ConfirmOver <= 0 || s.opts.Confirm == nil {
+		return nil
+	}
+	size := s.estimateOutputSize(files)
+	if size <= s.opts.ConfirmOver {
+		return nil
+	}
+	if !s.opts.Confirm(fmt.Sprintf("Output will be ~%s, continue? [y/N] ", formatSize(size))) {
+		return ErrCanceled
+	}
+	return nil
+}
+
+// estimateOutputSize estimates the size in bytes of the output for files, without reading
+// any of them: a tree line and a heading per file, plus the size of those whose contents
+// get dumped, as far as -max-file-size and -preview let them.
+func (s *scan) estimateOutputSize(files []string) int64 {
+	var total int64
+	for _, f := range files {
+		// The tree line, the heading and the code fences
+		total += int64(2*len(f) + 32)
+		if !s.opts.Markdown || s.opts.TreeOnly || s.opts.ListOnly || s.contentSkipped[f] || s.filtered[f] {
+			continue
+		}
+		size := s.fileSize(f)
+		switch {
+		case s.opts.MaxFileSize > 0 && size > s.opts.MaxFileSize:
+			size = 0
+		case s.opts.Preview > 0 && size > s.opts.Preview:
+			size = s.opts.Preview
+		}
+		total += size
+	}
+	return total
+}
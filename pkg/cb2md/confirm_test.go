@@ -0,0 +1,86 @@
+package cb2md
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestConfirmOver checks that declining the confirmation aborts before anything is
+// written, and that the question is only asked above the threshold.
+func TestConfirmOver(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"big.txt":   strings.Repeat("x", 4096),
+		"small.txt": "hi\n",
+	})
+	outFile := filepath.Join(t.TempDir(), "out.md")
+
+	var questions []string
+	decline := func(q string) bool {
+		questions = append(questions, q)
+		return false
+	}
+	var buf strings.Builder
+	opts := Options{IgnoreFile: ".ignore", Markdown: true, OutFile: outFile, TreeJSON: outFile + ".json", ConfirmOver: 1024, Confirm: decline}
+	if _, err := run(tmp, opts, &buf); !errors.Is(err, ErrCanceled) {
+		t.Fatalf("run error = %v; want ErrCanceled", err)
+	}
+	if len(questions) != 1 || !strings.HasPrefix(questions[0], "Output will be ~4.") || !strings.HasSuffix(questions[0], " KB, continue? [y/N] ") {
+		t.Errorf("questions asked: %q", questions)
+	}
+	for _, f := range []string{outFile, outFile + ".json"} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("%s should not have been written (stat error %v)", f, err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("nothing should have been written, got:\n%s", buf.String())
+	}
+
+	// Under the threshold nobody is asked
+	questions = nil
+	opts.ConfirmOver = 1 << 20
+	if _, err := run(tmp, opts, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if len(questions) != 0 {
+		t.Errorf("no question should be asked under the threshold, got %q", questions)
+	}
+	if _, err := os.Stat(outFile); err != nil {
+		t.Errorf("output should have been written: %v", err)
+	}
+}
+
+// TestEstimateOutputSize checks that the estimate follows the size limits applied to
+// file contents.
+func TestEstimateOutputSize(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a.txt": strings.Repeat("a", 1000),
+		"b.txt": strings.Repeat("b", 5000),
+	})
+	perFile := int64(2*len("a.txt") + 32)
+
+	for _, tt := range []struct {
+		name string
+		opts Options
+		want int64
+	}{
+		{"whole files", Options{Markdown: true}, 6000 + 2*perFile},
+		{"preview", Options{Markdown: true, Preview: 2000}, 3000 + 2*perFile},
+		{"max file size", Options{Markdown: true, MaxFileSize: 2000}, 1000 + 2*perFile},
+		{"tree only", Options{}, 2 * perFile},
+	} {
+		tt.opts.IgnoreFile = ".ignore"
+		s, err := run(tmp, tt.opts, new(strings.Builder))
+		if err != nil {
+			t.Fatalf("%s: run error: %v", tt.name, err)
+		}
+		if got := s.estimateOutputSize(s.included); got != tt.want {
+			t.Errorf("%s: estimate = %d; want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package cb2md
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// printContent prints a file's content, read from r, as configured by opts: stripped of
+// its license header, smart-trimmed, cut down to a preview and/or with line numbers. size
+// is the size of the file, as reported in the marker of a preview, however much of it is
+// stripped or trimmed.
+func printContent(r io.Reader, size int64, language string, w io.Writer, opts Options) error {
+	if opts.StripLicense {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		data = stripLicenseHeader(data, language)
+		r = bytes.NewReader(data)
+	}
+	if opts.SmartTrim > 0 && language == "go" {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		data = smartTrimGo(data, opts.SmartTrim)
+		r = bytes.NewReader(data)
+	}
+
+	if opts.LineNumbers {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		w = &lineNumberWriter{w: w, width: len(strconv.Itoa(countLines(data))), atLineStart: true}
+		r = bytes.NewReader(data)
+	}
+
+	if opts.Preview > 0 {
+		return writePreview(r, w, opts.Preview, size)
+	}
+	// JSON has no fence to close, so the content is kept byte for byte
+	if opts.Format == "json" {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	return writeContents(r, w)
+}
+
+// lineNumberWriter passes writes through to w, starting each line with its number, right
+// aligned to width, and a "|" separator.
+type lineNumberWriter struct {
+	w           io.Writer
+	width       int
+	line        int
+	atLineStart bool
+}
+
+func (lw *lineNumberWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if lw.atLineStart {
+			lw.line++
+			// No trailing space on empty lines
+			sep := " | "
+			if p[0] == '\n' {
+				sep = " |"
+			}
+			if _, err := fmt.Fprintf(lw.w, "%*d%s", lw.width, lw.line, sep); err != nil {
+				return 0, err
+			}
+		}
+		end := bytes.IndexByte(p, '\n') + 1
+		if end == 0 {
+			end = len(p)
+		}
+		if _, err := lw.w.Write(p[:end]); err != nil {
+			return 0, err
+		}
+		lw.atLineStart = p[end-1] == '\n'
+		p = p[end:]
+	}
+	return n, nil
+}
+
+// unnumbered returns the writer below w if it numbers lines, for notes that aren't part of
+// the file's content.
+func unnumbered(w io.Writer) io.Writer {
+	if lw, ok := w.(*lineNumberWriter); ok {
+		return lw.w
+	}
+	return w
+}
+
+// binarySampleSize is how much of a file looksBinary gets to see.
+const binarySampleSize = 8 << 10
+
+// looksBinary guesses whether sample, the start of a file, is binary rather than text: it
+// is if it contains a NUL byte, or if more than 30% of it is control characters or invalid
+// UTF-8. A multi-byte character cut off at the end of the sample doesn't count.
+func looksBinary(sample []byte) bool {
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+	odd := 0
+	for i := 0; i < len(sample); {
+		r, size := utf8.DecodeRune(sample[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			if !utf8.FullRune(sample[i:]) {
+				i = len(sample)
+				continue
+			}
+			odd++
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f' && r != '\b' && r != 0x1b, r == 0x7f:
+			odd++
+		}
+		i += size
+	}
+	return odd*10 > len(sample)*3
+}
+
+// defaultMIMEAllow are the non-text MIME types dumped with -mime-detect, unless
+// Options.MIMEAllow says otherwise.
+var defaultMIMEAllow = []string{"application/json", "application/xml"}
+
+// sniffMIMEType returns the MIME type of sample, the start of a file, as sniffed by
+// http.DetectContentType, without parameters such as the charset.
+func sniffMIMEType(sample []byte) string {
+	mimeType, _, _ := strings.Cut(http.DetectContentType(sample), ";")
+	return strings.TrimSpace(mimeType)
+}
+
+// mimeAllowed reports whether files of mimeType get dumped with -mime-detect: text/* always
+// does, anything else only if it's in the allowlist (entries like image/* match a whole type).
+func (s *scan) mimeAllowed(mimeType string) bool {
+	if strings.HasPrefix(mimeType, "text/") {
+		return true
+	}
+	allow := s.opts.MIMEAllow
+	if allow == nil {
+		allow = defaultMIMEAllow
+	}
+	for _, a := range allow {
+		if prefix, ok := strings.CutSuffix(a, "*"); ok && strings.HasPrefix(mimeType, prefix) || strings.EqualFold(a, mimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+// minBlobRun is the length from which a run of base64 characters counts towards a data
+// blob. That is shorter than the lines of wrapped base64 (64 or 76 characters), and much
+// longer than real identifiers.
+const minBlobRun = 60
+
+// looksLikeDataBlob guesses whether sample, the start of a text file, is mostly encoded
+// data, like base64 blobs or data URIs: it is if more than half of it is made of runs of
+// at least minBlobRun base64 characters (letters, digits, +, /, -, _ and =) that look
+// random. Code, even minified, breaks such runs with spaces and punctuation; a run looks
+// random if it mixes upper case, lower case and digits (unlike hex hashes) and switches
+// between them on at least 40% of its characters (unlike long CamelCase identifiers).
+func looksLikeDataBlob(sample []byte) bool {
+	blob, run, switches := 0, 0, 0
+	var seen [4]bool
+	prev := -1
+	for i, b := range sample {
+		if class := base64Class(b); class >= 0 {
+			run++
+			seen[class] = true
+			if prev >= 0 && class != prev {
+				switches++
+			}
+			prev = class
+			if i < len(sample)-1 {
+				continue
+			}
+		}
+		if run >= minBlobRun && seen[0] && seen[1] && seen[2] && switches*5 >= run*2 {
+			blob += run
+		}
+		run, switches, seen, prev = 0, 0, [4]bool{}, -1
+	}
+	return blob*2 > len(sample)
+}
+
+// base64Class returns the class of b in the standard or URL-safe base64 alphabet: 0 for
+// upper case letters, 1 for lower case, 2 for digits and 3 for the rest (+, /, -, _ and =),
+// or -1 if b isn't part of it.
+func base64Class(b byte) int {
+	switch {
+	case 'A' <= b && b <= 'Z':
+		return 0
+	case 'a' <= b && b <= 'z':
+		return 1
+	case '0' <= b && b <= '9':
+		return 2
+	case b == '+' || b == '/' || b == '-' || b == '_' || b == '=':
+		return 3
+	}
+	return -1
+}
+
+// codeFence returns a backtick fence for a code block holding the given text: at least three
+// backticks, and longer than the longest run of backticks inside, as CommonMark requires.
+func codeFence(texts ...[]byte) string {
+	longest := 0
+	for _, text := range texts {
+		run := 0
+		for _, b := range text {
+			if b == '`' {
+				run++
+				longest = max(longest, run)
+			} else {
+				run = 0
+			}
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// licensePhrases identify a comment block as a license header (matched case-insensitively).
+var licensePhrases = []string{
+	"spdx-license-identifier",
+	"licensed under",
+	"copyright",
+	"all rights reserved",
+	"permission is hereby granted",
+	"apache license",
+	"gnu general public license",
+	"gnu lesser general public license",
+	"mozilla public license",
+	"mit license",
+	"bsd license",
+}
+
+// stripLicenseHeader replaces a license comment block at the very top of content (after an
+// optional shebang and blank lines) with a one-line note. To avoid eating real comments it only
+// considers the first comment block, and only if it mentions one of licensePhrases; anything else
+// is returned unchanged.
+func stripLicenseHeader(content []byte, language string) []byte {
+	lines := strings.SplitAfter(string(content), "\n")
+
+	start := 0
+	if start < len(lines) && strings.HasPrefix(lines[start], "#!") {
+		start++
+	}
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	if start >= len(lines) {
+		return content
+	}
+
+	first := strings.TrimSpace(lines[start])
+	end, note := -1, ""
+	switch {
+	case strings.HasPrefix(first, "/*"):
+		end = blockEnd(lines, start, "/*", "*/")
+		note = "/* license header omitted */"
+	case strings.HasPrefix(first, "<!--"):
+		end = blockEnd(lines, start, "<!--", "-->")
+		note = "<!-- license header omitted -->"
+	case strings.HasPrefix(first, "//"):
+		end = lineCommentEnd(lines, start, "//")
+		note = "// license header omitted"
+	case strings.HasPrefix(first, "#") && hashComments(language):
+		end = lineCommentEnd(lines, start, "#")
+		note = "# license header omitted"
+	}
+	if end < 0 || !mentionsLicense(strings.Join(lines[start:end], "")) {
+		return content
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Join(lines[:start], ""))
+	b.WriteString(note + "\n")
+	b.WriteString(strings.Join(lines[end:], ""))
+	return []byte(b.String())
+}
+
+// hashComments reports whether "#" starts a comment in the given language
+// (it doesn't in e.g. C, where it starts a preprocessor directive).
+func hashComments(language string) bool {
+	open, _ := commentSyntax(language)
+	return open == "# "
+}
+
+// blockEnd returns the index just past the line that closes a block comment opened at start,
+// or -1 if it is never closed.
+func blockEnd(lines []string, start int, opener, closer string) int {
+	for i := start; i < len(lines); i++ {
+		text := lines[i]
+		if i == start {
+			// Only look for the closer after the opener, so "/*/" isn't taken as closed
+			text = text[strings.Index(text, opener)+len(opener):]
+		}
+		if strings.Contains(text, closer) {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// lineCommentEnd returns the index just past a run of consecutive line comments starting at start.
+func lineCommentEnd(lines []string, start int, prefix string) int {
+	i := start
+	for i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), prefix) {
+		i++
+	}
+	return i
+}
+
+// mentionsLicense reports whether text contains any of licensePhrases.
+func mentionsLicense(text string) bool {
+	text = strings.ToLower(text)
+	for _, phrase := range licensePhrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
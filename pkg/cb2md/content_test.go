@@ -0,0 +1,409 @@
+package cb2md
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStripLicenseHeader checks that leading license blocks are replaced and ordinary comments kept.
+func TestStripLicenseHeader(t *testing.T) {
+	apache := `/*
+ * Copyright 2024 The Example Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ */
+
+package main
+
+func main() {}
+`
+	tests := []struct {
+		name     string
+		content  string
+		language string
+		want     string
+	}{
+		{
+			name:     "apache block comment",
+			content:  apache,
+			language: "go",
+			want:     "/* license header omitted */\n\npackage main\n\nfunc main() {}\n",
+		},
+		{
+			name:     "spdx line comments",
+			content:  "// SPDX-License-Identifier: MIT\n// Copyright (c) 2024 Someone\n\n// Package util helps.\npackage util\n",
+			language: "go",
+			want:     "// license header omitted\n\n// Package util helps.\npackage util\n",
+		},
+		{
+			name:     "hash comments after a shebang",
+			content:  "#!/usr/bin/env python3\n# Copyright 2024 Someone\n# Licensed under the MIT License\nprint('hi')\n",
+			language: "python",
+			want:     "#!/usr/bin/env python3\n# license header omitted\nprint('hi')\n",
+		},
+		{
+			name:     "ordinary leading comment is kept",
+			content:  "// Package util contains helpers.\npackage util\n",
+			language: "go",
+			want:     "// Package util contains helpers.\npackage util\n",
+		},
+		{
+			name:     "license text later in the file is kept",
+			content:  "package main\n\n// Copyright notice printed by --version\nconst notice = \"Copyright 2024\"\n",
+			language: "go",
+			want:     "package main\n\n// Copyright notice printed by --version\nconst notice = \"Copyright 2024\"\n",
+		},
+		{
+			name:     "hash is not a comment in unknown languages",
+			content:  "# Copyright 2024\nbody\n",
+			language: "",
+			want:     "# Copyright 2024\nbody\n",
+		},
+	}
+	for _, tt := range tests {
+		got := string(stripLicenseHeader([]byte(tt.content), tt.language))
+		if got != tt.want {
+			t.Errorf("%s: got\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestLargeWarning checks that only files over the -large-warning size get the inline warning.
+func TestLargeWarning(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"big.txt":   strings.Repeat("x", 3000),
+		"small.txt": "x\n",
+	})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, LargeWarning: 2048})
+	if !strings.Contains(got, "### big.txt\n> ⚠️ Large file (2.9 KB)\n\n```\n") {
+		t.Errorf("expected a warning above big.txt:\n%s", got)
+	}
+	if !strings.Contains(got, "### small.txt\n```\n") {
+		t.Errorf("expected no warning above small.txt:\n%s", got)
+	}
+}
+
+// TestCodeFence checks that fences outgrow any backtick run in the content.
+func TestCodeFence(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"plain", "```"},
+		{"inline `code` and ``more``", "```"},
+		{"```go\nx\n```\n", "````"},
+		{"`````", "``````"},
+	}
+	for _, tt := range tests {
+		if got := codeFence([]byte(tt.content)); got != tt.want {
+			t.Errorf("codeFence(%q) = %q; want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+// TestFenceAroundEmbeddedCodeBlock checks that a Markdown file with its own code block is fenced safely.
+func TestFenceAroundEmbeddedCodeBlock(t *testing.T) {
+	tmp := t.TempDir()
+	doc := "# Usage\n\n```bash\ncb2md .\n```\n"
+	writeFiles(t, tmp, map[string]string{"README.md": doc})
+
+	out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true})
+	if want := "### README.md\n````markdown\n" + doc + "````\n"; !strings.Contains(out, want) {
+		t.Errorf("expected a four-backtick fence around README.md:\n%s", out)
+	}
+}
+
+// TestLooksBinary checks the binary sniffing heuristic on typical text and binary samples.
+func TestLooksBinary(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample string
+		want   bool
+	}{
+		{"empty", "", false},
+		{"ascii", "package main\n\nfunc main() {}\n", false},
+		{"utf8", "héllo wörld — ünïcödé ✓\n", false},
+		{"cut rune", "naïve ✓"[:len("naïve ✓")-1], false},
+		{"ansi colors", "\x1b[31mred\x1b[0m\n", false},
+		{"nul", "ELF\x00\x01\x02", true},
+		{"control bytes", "\x01\x02\x03\x04abc", true},
+		{"latin1", "\xe9\xe8\xe0\xf9\xff\xfe", true},
+	}
+	for _, tt := range tests {
+		if got := looksBinary([]byte(tt.sample)); got != tt.want {
+			t.Errorf("looksBinary(%s) = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestBinaryContentOmitted checks that a file with NUL bytes gets a note instead of its
+// contents, unless IncludeBinary is set, while UTF-8 text is dumped as usual.
+func TestBinaryContentOmitted(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"app.bin":  "\x7fELF\x02\x01\x01\x00\x00\x00",
+		"notes.md": "# Notes — ünïcödé\n",
+	})
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got := buf.String()
+	if !strings.Contains(got, "### app.bin\n_binary file, contents omitted_\n\n") {
+		t.Errorf("expected a note instead of app.bin's contents:\n%s", got)
+	}
+	if strings.Contains(got, "ELF") {
+		t.Errorf("app.bin's contents should be omitted:\n%s", got)
+	}
+	if !strings.Contains(got, "### notes.md\n```markdown\n# Notes — ünïcödé\n```\n") {
+		t.Errorf("expected notes.md's contents:\n%s", got)
+	}
+
+	buf.Reset()
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, IncludeBinary: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "### app.bin\n```\n\x7fELF") {
+		t.Errorf("expected app.bin's contents with IncludeBinary:\n%q", buf.String())
+	}
+}
+
+// TestMaxFileSize checks that a file just over the limit keeps its place in the tree and
+// the file list, with a note instead of its contents, while one just under is dumped.
+func TestMaxFileSize(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"over.sql":  strings.Repeat("x", 1025),
+		"under.sql": strings.Repeat("y", 1024),
+	})
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, MaxFileSize: 1024}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got := buf.String()
+	if !strings.Contains(got, "├── over.sql\n") {
+		t.Errorf("over.sql should still be in the tree:\n%s", got)
+	}
+	if !strings.Contains(got, "### over.sql\n_file too large (1.0 KB), contents omitted_\n\n") {
+		t.Errorf("expected a note instead of over.sql's contents:\n%s", got)
+	}
+	if strings.Contains(got, "xxx") {
+		t.Errorf("over.sql's contents should be omitted:\n%s", got)
+	}
+	if !strings.Contains(got, "### under.sql\n```sql\n"+strings.Repeat("y", 1024)+"\n```\n") {
+		t.Errorf("expected under.sql's contents:\n%s", got)
+	}
+}
+
+// TestContentLimitsGrownFile checks that the content limits go by a file's size when it's
+// read, not when the tree was built: a file that has grown since is left out with its
+// current size, or previewed with its current total.
+func TestContentLimitsGrownFile(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{"log.txt": "start\n"})
+	grown := map[string]string{"log.txt": strings.Repeat("x", 2048)}
+
+	got := runChangedAfterWalk(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, MaxFileSize: 1024}, grown)
+	if !strings.Contains(got, "### log.txt\n_file too large (2.0 KB), contents omitted_\n") {
+		t.Errorf("expected a note with the grown size instead of log.txt's contents:\n%s", got)
+	}
+	if strings.Contains(got, "xxx") {
+		t.Errorf("log.txt's contents should be omitted:\n%s", got)
+	}
+
+	writeFiles(t, tmp, map[string]string{"log.txt": "start\n"})
+	got = runChangedAfterWalk(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, Preview: 100}, grown)
+	if !strings.Contains(got, strings.Repeat("x", 100)+"\n... [truncated, 2048 bytes total]\n") {
+		t.Errorf("expected log.txt previewed with its grown total:\n%s", got)
+	}
+}
+
+// TestLooksLikeDataBlob checks the data blob heuristic against encoded data and code
+// that shouldn't trip it.
+func TestLooksLikeDataBlob(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef, 0x42}, 300))
+	tests := []struct {
+		name   string
+		sample string
+		want   bool
+	}{
+		{"base64", b64, true},
+		{"wrapped base64", wrapLines(b64, 64), true},
+		{"data uri", "const logo = \"data:image/png;base64," + b64 + "\";\n", true},
+		{"code", strings.Repeat("func main() { fmt.Println(\"hello, world\") }\n", 50), false},
+		{"minified", strings.Repeat("function(a,b){return a+b};var x=document.getElementById('app');", 50), false},
+		{"hashes", strings.Repeat("sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\n", 40), false},
+		{"long identifiers", strings.Repeat("TestParseConfigurationFileWithNestedSectionsAndOverrides2Levels(t)\n", 40), false},
+		{"one uri in a big file", strings.Repeat("let x = 1;\n", 200) + "img.src = \"data:image/png;base64," + b64[:500] + "\";\n", false},
+	}
+	for _, tt := range tests {
+		if got := looksLikeDataBlob([]byte(tt.sample)); got != tt.want {
+			t.Errorf("looksLikeDataBlob(%s) = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// wrapLines breaks s into lines of n characters.
+func wrapLines(s string, n int) string {
+	var b strings.Builder
+	for len(s) > n {
+		b.WriteString(s[:n] + "\n")
+		s = s[n:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// TestSkipDataBlobs checks that with SkipDataBlobs a base64-heavy file gets a note instead
+// of its contents, while a normal file is kept.
+func TestSkipDataBlobs(t *testing.T) {
+	blob := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("fixture data "), 200))
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"fixture.json": "{\"payload\": \"" + blob + "\"}\n",
+		"main.go":      "package main\n\nfunc main() {}\n",
+	})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, SkipDataBlobs: true})
+	if !strings.Contains(got, "### fixture.json\n_encoded data (base64-like), contents omitted_\n\n") || strings.Contains(got, blob) {
+		t.Errorf("expected a note instead of fixture.json's contents:\n%s", got)
+	}
+	if !strings.Contains(got, "### main.go\n```go\npackage main\n") {
+		t.Errorf("expected main.go's contents:\n%s", got)
+	}
+}
+
+// TestCollapsible checks that each file's code block is wrapped in a <details> element,
+// with blank lines around the fence so GitHub renders it.
+func TestCollapsible(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":     "package main\n\nfunc main() {}\n",
+		"a&b/one.txt": "no trailing newline",
+	})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, Collapsible: true})
+	for _, want := range []string{
+		"### main.go\n<details><summary>main.go (3 lines)</summary>\n\n```go\npackage main\n\nfunc main() {}\n```\n\n</details>\n\n",
+		"<details><summary>" + filepath.Join("a&amp;b", "one.txt") + " (1 line)</summary>\n\n```\nno trailing newline\n```\n\n</details>\n\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, "</details>"); n != 2 {
+		t.Errorf("expected 2 </details>, got %d", n)
+	}
+}
+
+// TestCollapsibleRelativeTo checks that the summary of a collapsible file shows its path
+// as its heading does, relative to -relative-to.
+func TestCollapsibleRelativeTo(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{"sub/main.go": "package main\n"})
+
+	got := runOutput(t, filepath.Join(tmp, "sub"), Options{IgnoreFile: ".ignore", Markdown: true, Collapsible: true, RelativeTo: tmp})
+	want := "<details><summary>" + filepath.Join("sub", "main.go") + " (1 line)</summary>"
+	if !strings.Contains(got, want) {
+		t.Errorf("output should contain %q:\n%s", want, got)
+	}
+}
+
+// TestMIMEDetect checks that with MIMEDetect, a file sniffed as an image gets a note giving
+// its MIME type even though it passes the binary heuristic, while text is dumped, and that
+// MIMEAllow lets other types through.
+func TestMIMEDetect(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"logo.dat":  "\x89PNG\r\n\x1a\nnot really pixels, but no NUL bytes either\n",
+		"notes.txt": "plain text\n",
+		"doc.dat":   "%PDF-1.7 pretend document\n",
+	})
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, MIMEDetect: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"### logo.dat\n_image/png file, contents omitted_\n\n",
+		"### doc.dat\n_application/pdf file, contents omitted_\n\n",
+		"### notes.txt\n```\nplain text\n```\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "pixels") {
+		t.Errorf("logo.dat's contents should be omitted:\n%s", got)
+	}
+
+	// Without sniffing, the fake PNG passes for text
+	buf.Reset()
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "pixels") {
+		t.Errorf("expected logo.dat's contents without MIMEDetect:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	opts := Options{IgnoreFile: ".ignore", Markdown: true, MIMEDetect: true, MIMEAllow: []string{"application/*"}}
+	if _, err := run(tmp, opts, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got = buf.String()
+	if !strings.Contains(got, "%PDF-1.7 pretend document") {
+		t.Errorf("expected doc.dat's contents with application/* allowed:\n%s", got)
+	}
+	if !strings.Contains(got, "_image/png file, contents omitted_") {
+		t.Errorf("logo.dat should still be omitted:\n%s", got)
+	}
+}
+
+// TestLineNumbers checks that -line-numbers prefixes each line with its number, right
+// aligned to the width of the file's line count, including a last line with no newline.
+func TestLineNumbers(t *testing.T) {
+	tmp := t.TempDir()
+	var lines []string
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	lines[4] = ""
+	writeFiles(t, tmp, map[string]string{
+		"ten.txt": strings.Join(lines, "\n"),
+		"one.txt": "only\n",
+	})
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, LineNumbers: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"### ten.txt\n```\n 1 | line 1\n 2 | line 2\n 3 | line 3\n 4 | line 4\n 5 |\n 6 | line 6\n 7 | line 7\n 8 | line 8\n 9 | line 9\n10 | line 10\n```\n",
+		"### one.txt\n```\n1 | only\n```\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q:\n%s", want, got)
+		}
+	}
+
+	// The preview's truncation note isn't a line of the file
+	buf.Reset()
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, LineNumbers: true, Preview: 20}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := " 2 | line 2\n... [truncated"; !strings.Contains(buf.String(), want) {
+		t.Errorf("output should contain %q:\n%s", want, buf.String())
+	}
+}
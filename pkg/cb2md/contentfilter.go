@@ -0,0 +1,104 @@
+package cb2md
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// todoPattern is the content match used by -only-todos.
+const todoPattern = `\b(TODO|FIXME|XXX)\b`
+
+// generatedMarker matches the lines marking a file as generated: Go's "// Code generated
+// ... DO NOT EDIT." convention (https://go.dev/s/generatedcode), and the @generated tag
+// used by Facebook's tools, protoc plugins and others.
+var generatedMarker = regexp.MustCompile(`^\s*(//|#|--|/?\*)?\s*Code generated .* DO NOT EDIT\.|@generated\b`)
+
+// generatedHeadLines is how many lines at the top of a file looksGenerated checks.
+const generatedHeadLines = 20
+
+// looksGenerated reports whether one of the first lines of the file at relative path fpath
+// carries a generated-code marker. Files that can't be read don't.
+func (s *scan) looksGenerated(fpath string) bool {
+	r, err := s.openContent(fpath)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+	sc := bufio.NewScanner(r)
+	for i := 0; i < generatedHeadLines && sc.Scan(); i++ {
+		if generatedMarker.Match(sc.Bytes()) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterByContent returns the files among files whose content matches s.contentMatch, in
+// the same order, noting the others in s.filtered. Files that can't be read are kept, so
+// the error shows up in the output.
+func (s *scan) filterByContent(files []string) []string {
+	var kept []string
+	for _, f := range files {
+		content, err := s.readContent(f)
+		if err != nil || s.contentMatch.Match(content) {
+			kept = append(kept, f)
+		} else {
+			s.filtered[f] = true
+		}
+	}
+	return kept
+}
+
+// matchExcerpt returns the lines of content matching re, each with up to context lines
+// before and after it. Where lines are left out between two excerpts, a "..." line
+// takes their place.
+func matchExcerpt(content []byte, re *regexp.Regexp, context int) []byte {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	if n := len(lines); n > 0 && len(lines[n-1]) == 0 {
+		lines = lines[:n-1]
+	}
+
+	keep := make([]bool, len(lines))
+	for i, line := range lines {
+		if re.Match(line) {
+			for j := max(0, i-context); j <= min(len(lines)-1, i+context); j++ {
+				keep[j] = true
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	last := -1
+	for i, line := range lines {
+		if !keep[i] {
+			continue
+		}
+		if last >= 0 && i > last+1 {
+			out.WriteString("...\n")
+		}
+		out.Write(line)
+		last = i
+	}
+	return out.Bytes()
+}
+
+// compileContentMatch compiles the content match configured by opts, if any.
+func compileContentMatch(opts Options) (*regexp.Regexp, error) {
+	pattern := opts.ContentMatch
+	if opts.OnlyTODOs {
+		if pattern != "" {
+			return nil, fmt.Errorf("-only-todos can't be combined with -content-match")
+		}
+		pattern = todoPattern
+	}
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -content-match pattern: %w", err)
+	}
+	return re, nil
+}
@@ -0,0 +1,122 @@
+package cb2md
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestOnlyTODOs checks that only files with a TODO-style marker are dumped, while the
+// others stay in the tree.
+func TestOnlyTODOs(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a.go":        "package a\n\n// TODO: handle errors\nfunc A() {}\n",
+		"b.go":        "package b\n\nfunc B() {}\n",
+		"c.py":        "# FIXME later\n",
+		"todolist.md": "Not a TODOS marker, nor a XXXL one\n",
+	})
+
+	var buf strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, OnlyTODOs: true}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := []string{"a.go", "c.py"}; !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+	if got := buf.String(); !strings.Contains(got, "├── b.go\n") || strings.Contains(got, "### b.go") {
+		t.Errorf("b.go should be in the tree but not dumped:\n%s", got)
+	}
+}
+
+// TestPlaceholder checks that with -placeholder, the files in the tree that -include or a
+// content filter left out still get a heading, with a note instead of their contents.
+func TestPlaceholder(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a.go":      "package a\n\n// TODO: handle errors\n",
+		"b.go":      "package b\n",
+		"notes.txt": "TODO: not a Go file\n",
+		"logo.png":  "\x89PNG",
+	})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, OnlyTODOs: true, Include: []string{"go", "png"}, Placeholder: true})
+	want := "### a.go\n```go\npackage a\n\n// TODO: handle errors\n```\n\n" +
+		"### b.go\n_content excluded by filter_\n\n" +
+		"### notes.txt\n_content excluded by filter_\n\n"
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("file list should end with:\n%s\ngot:\n%s", want, got)
+	}
+	// Skip-content files weren't filtered, so they get no section
+	if strings.Contains(got, "### logo.png") {
+		t.Errorf("logo.png should only be in the tree:\n%s", got)
+	}
+}
+
+// TestMatchExcerpt checks that only matching lines and their context are kept, with
+// gaps marked.
+func TestMatchExcerpt(t *testing.T) {
+	content := "1\n2 TODO\n3\n4\n5\n6\n7 XXX\n8"
+	re := regexp.MustCompile(todoPattern)
+
+	tests := []struct {
+		context int
+		want    string
+	}{
+		{0, "2 TODO\n...\n7 XXX\n"},
+		{1, "1\n2 TODO\n3\n...\n6\n7 XXX\n8"},
+		{2, "1\n2 TODO\n3\n4\n5\n6\n7 XXX\n8"},
+	}
+	for _, tt := range tests {
+		if got := string(matchExcerpt([]byte(content), re, tt.context)); got != tt.want {
+			t.Errorf("matchExcerpt(context %d) = %q; want %q", tt.context, got, tt.want)
+		}
+	}
+}
+
+// TestSkipGenerated checks that files carrying a generated-code marker near the top stay
+// in the tree, annotated, but out of the Full File List, while a marker further down, or
+// a mere mention, doesn't count.
+func TestSkipGenerated(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"api.pb.go":   "// Code generated by protoc-gen-go. DO NOT EDIT.\n// source: api.proto\n\npackage api\n",
+		"schema.ts":   "/**\n * @generated by graphql-codegen\n */\nexport type Q = {};\n",
+		"main.go":     "package main\n\n// Files starting with \"// Code generated\" are skipped.\n",
+		"late.go":     "package late\n" + strings.Repeat("\n", generatedHeadLines) + "// Code generated by hand. DO NOT EDIT.\n",
+		"gen/mock.py": "# Code generated by mockgen. DO NOT EDIT.\n",
+	})
+
+	var buf strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, SkipGenerated: true}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := []string{"late.go", "main.go"}; !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+	got := buf.String()
+	for _, want := range []string{"├── api.pb.go (generated)\n", "mock.py (generated)\n", "└── schema.ts (generated)\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("tree should contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "package api") {
+		t.Errorf("api.pb.go's contents should be left out:\n%s", got)
+	}
+}
+
+// TestSkipGeneratedContentRef checks that with -content-ref, -skip-generated goes by the
+// file as it is at that ref, not in the working tree.
+func TestSkipGeneratedContentRef(t *testing.T) {
+	tmp := t.TempDir()
+	initGitRepo(t, tmp, map[string]string{"api.go": "// Code generated by hand. DO NOT EDIT.\n\npackage api\n"})
+	writeFiles(t, tmp, map[string]string{"api.go": "package api\n"})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, SkipGenerated: true, ContentRef: "HEAD"})
+	if !strings.Contains(got, "api.go (generated)\n") {
+		t.Errorf("expected api.go marked generated as of HEAD:\n%s", got)
+	}
+}
@@ -0,0 +1,39 @@
+package cb2md
+
+// dirEmoji prefixes directories in the tree with -emoji.
+const dirEmoji = "📁"
+
+// languageEmoji maps languages from guessLanguage to the emoji prefixing their files in
+// the tree with -emoji. Files of other languages get defaultFileEmoji.
+var languageEmoji = map[string]string{
+	"go":         "🐹",
+	"python":     "🐍",
+	"javascript": "📜",
+	"jsx":        "📜",
+	"typescript": "📘",
+	"tsx":        "📘",
+	"html":       "🌐",
+	"css":        "🎨",
+	"scss":       "🎨",
+	"java":       "☕",
+	"rust":       "🦀",
+	"bash":       "🐚",
+	"ruby":       "💎",
+	"php":        "🐘",
+	"yaml":       "🔧",
+	"json":       "🔧",
+	"markdown":   "📝",
+}
+
+const defaultFileEmoji = "📄"
+
+// nodeEmoji returns the emoji prefixing node's label with -emoji.
+func nodeEmoji(node *Node) string {
+	if node.IsDir {
+		return dirEmoji
+	}
+	if e, ok := languageEmoji[guessLanguage(node.Name)]; ok {
+		return e
+	}
+	return defaultFileEmoji
+}
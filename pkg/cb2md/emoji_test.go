@@ -0,0 +1,37 @@
+package cb2md
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEmojiTree checks that -emoji prefixes directories with a folder and files with
+// their language's emoji, falling back to a page.
+func TestEmojiTree(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"cmd/main.go": "package main\n",
+		"notes.txt":   "hi\n",
+	})
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Emoji: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	want := "└── 📁 " + filepath.Base(tmp) + "\n" +
+		"    ├── 📁 cmd\n" +
+		"    │   └── 🐹 main.go\n" +
+		"    └── 📄 notes.txt\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore"}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if strings.Contains(buf.String(), "📁") {
+		t.Errorf("no emoji expected by default:\n%s", buf.String())
+	}
+}
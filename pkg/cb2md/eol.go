@@ -0,0 +1,58 @@
+package cb2md
+
+import (
+	"bytes"
+	"io"
+)
+
+// crlfWriter passes writes through to w with every line feed turned into CRLF. Line feeds
+// that already follow a carriage return (e.g. in a file with Windows line endings) are
+// left alone, so they don't end up as CR CR LF.
+type crlfWriter struct {
+	w      io.Writer
+	lastCR bool
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p)+len(p)/16)
+	for _, b := range p {
+		if b == '\n' && !c.lastCR {
+			out = append(out, '\r')
+		}
+		out = append(out, b)
+		c.lastCR = b == '\r'
+	}
+	if _, err := c.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// finalNewlineWriter passes writes through to w, except for the newlines at the end of the
+// output: Flush ends it with exactly one, however many were written.
+type finalNewlineWriter struct {
+	w       io.Writer
+	pending int // newlines held back, as they may be the last
+	written bool
+}
+
+func (f *finalNewlineWriter) Write(p []byte) (int, error) {
+	body := bytes.TrimRight(p, "\n")
+	if len(body) > 0 {
+		if _, err := f.w.Write(append(bytes.Repeat([]byte("\n"), f.pending), body...)); err != nil {
+			return 0, err
+		}
+		f.pending, f.written = 0, true
+	}
+	f.pending += len(p) - len(body)
+	return len(p), nil
+}
+
+// Flush ends the output with a single newline, unless nothing was written.
+func (f *finalNewlineWriter) Flush() error {
+	if !f.written {
+		return nil
+	}
+	_, err := io.WriteString(f.w, "\n")
+	return err
+}
@@ -0,0 +1,80 @@
+package cb2md
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCRLFOutput checks that with EOL "crlf" every line of the output ends in CRLF,
+// including lines of file contents that already did.
+func TestCRLFOutput(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"unix.txt":    "one\ntwo\n",
+		"windows.txt": "three\r\nfour\r\n",
+	})
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, EOL: "crlf"}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got := buf.String()
+	if strings.Count(got, "\n") != strings.Count(got, "\r\n") {
+		t.Errorf("every line should end in CRLF:\n%q", got)
+	}
+	if strings.Contains(got, "\r\r\n") {
+		t.Errorf("existing CRLF line endings should be kept as they are:\n%q", got)
+	}
+	for _, want := range []string{"## Full File List\r\n", "### unix.txt\r\n```\r\none\r\ntwo\r\n```\r\n", "three\r\nfour\r\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q:\n%q", want, got)
+		}
+	}
+
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", EOL: "cr"}, &buf); err == nil {
+		t.Error("expected an error for an unknown EOL value")
+	}
+}
+
+// TestFinalNewlineWriter checks that however many newlines end the output, across writes,
+// exactly one is left, while those before other text are kept.
+func TestFinalNewlineWriter(t *testing.T) {
+	for _, tt := range []struct {
+		writes []string
+		want   string
+	}{
+		{[]string{"a\n\n", "\n"}, "a\n"},
+		{[]string{"a\n\n", "b"}, "a\n\nb\n"},
+		{[]string{"a", "\n", "\nb\n\n"}, "a\n\nb\n"},
+		{[]string{"\n"}, ""},
+	} {
+		var buf strings.Builder
+		w := &finalNewlineWriter{w: &buf}
+		for _, p := range tt.writes {
+			if _, err := w.Write([]byte(p)); err != nil {
+				t.Fatalf("Write error: %v", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("Flush error: %v", err)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("writes %q gave %q; want %q", tt.writes, got, tt.want)
+		}
+	}
+}
+
+// TestCRLFWriterSplitWrites checks that a CRLF already in the input is recognized even
+// when split across two writes.
+func TestCRLFWriterSplitWrites(t *testing.T) {
+	var buf strings.Builder
+	w := &crlfWriter{w: &buf}
+	for _, p := range []string{"a\r", "\nb\n", "\n"} {
+		if _, err := w.Write([]byte(p)); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+	}
+	if got, want := buf.String(), "a\r\nb\r\n\r\n"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
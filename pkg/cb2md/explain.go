@@ -0,0 +1,66 @@
+package cb2md
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// explainPath reports which rules match relPath and whether it would end up excluded,
+// shown in the tree only, or included with its contents. Since the walk checks every
+// directory on the way down, the parent directories are checked too, picking up their
+// ignore files (and .gitignore files, when -gitignore is on) along the way. Hidden
+// entries are treated as opts says.
+func explainPath(w io.Writer, absRoot, relPath string, rules ruleSet, opts Options) {
+	relPath = filepath.Clean(relPath)
+	fmt.Fprintf(w, "path: %s\n", relPath)
+
+	rules = rules.enter(absRoot, "")
+
+	matchedAny := false
+	segs := strings.Split(relPath, string(filepath.Separator))
+	for i := range segs {
+		prefix := filepath.Join(segs[:i+1]...)
+		last := i == len(segs)-1
+
+		if skipHidden(segs[i], opts) {
+			fmt.Fprintf(w, "hidden: %s\n", prefix)
+			fmt.Fprintln(w, "decision: excluded (hidden)")
+			return
+		}
+
+		// Parent directories are directories; the path itself may be either
+		isDir := !last
+		if last {
+			info, err := os.Stat(filepath.Join(absRoot, prefix))
+			isDir = err == nil && info.IsDir()
+		}
+
+		for _, r := range rules.matching(prefix, isDir) {
+			matchedAny = true
+			fmt.Fprintf(w, "%s: %q matched %s (%s)\n", r.action, r.pattern, prefix, r.source)
+		}
+
+		action, decider := rules.decide(prefix, isDir)
+		if action == actionExclude {
+			fmt.Fprintf(w, "decision: excluded (ignored by %q from %s)\n", decider.pattern, decider.source)
+			return
+		}
+		if last {
+			if !matchedAny {
+				fmt.Fprintln(w, "rules: no match")
+			}
+			if action == actionSkipContent {
+				fmt.Fprintf(w, "decision: tree only (content skipped by %q from %s)\n", decider.pattern, decider.source)
+			} else {
+				fmt.Fprintln(w, "decision: included")
+			}
+			return
+		}
+
+		// Descend: the directory's own ignore files apply below it
+		rules = rules.enter(filepath.Join(absRoot, prefix), prefix)
+	}
+}
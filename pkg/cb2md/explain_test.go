@@ -0,0 +1,35 @@
+package cb2md
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExplainPath checks the reported matching pattern and decision for sample paths.
+func TestExplainPath(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{".ignore": "*.log\nbuild\n"})
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"debug.log", []string{`ignore: "*.log" matched debug.log (.ignore)`, `decision: excluded (ignored by "*.log" from .ignore)`}},
+		{"build/out.js", []string{`ignore: "build" matched build (.ignore)`, `decision: excluded (ignored by "build" from .ignore)`}},
+		{"assets/logo.PNG", []string{`skip-content: "*.png" matched assets/logo.PNG (defaults)`, `decision: tree only (content skipped by "*.png" from defaults)`}},
+		{".github/ci.yml", []string{"hidden: .github", "decision: excluded (hidden)"}},
+		{"src/main.go", []string{"rules: no match", "decision: included"}},
+	}
+	for _, tt := range tests {
+		var buf strings.Builder
+		if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, TestPattern: filepath.FromSlash(tt.path)}, &buf); err != nil {
+			t.Fatalf("run error: %v", err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(buf.String(), filepath.FromSlash(want)) {
+				t.Errorf("explain %q missing %q:\n%s", tt.path, want, buf.String())
+			}
+		}
+	}
+}
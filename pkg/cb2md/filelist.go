@@ -0,0 +1,170 @@
+package cb2md
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// readFileList reads newline-separated relative paths, such as the output of
+// `git ls-files`, skipping empty lines and "#" comments. Paths are cleaned and
+// duplicates dropped, keeping the order of first appearance.
+func readFileList(r io.Reader) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := filepath.Clean(filepath.FromSlash(line))
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		paths = append(paths, p)
+	}
+	return paths, scanner.Err()
+}
+
+// readFileListFrom reads the file list at path, as readFileList does, or from stdin
+// (os.Stdin if nil) if path is "-".
+func readFileListFrom(path string, stdin io.Reader) ([]string, error) {
+	if path == "-" {
+		if stdin == nil {
+			stdin = os.Stdin
+		}
+		paths, err := readFileList(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("error reading file list from stdin: %w", err)
+		}
+		return paths, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file list: %w", err)
+	}
+	defer f.Close()
+	paths, err := readFileList(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file list '%s': %w", path, err)
+	}
+	return paths, nil
+}
+
+// TreeFromPaths builds a tree from newline-separated relative paths read from r, as
+// accepted by -from-file, without looking at the disk: every path with others below it is
+// a directory, and every other one a file. Paths leading out of the root are dropped. The
+// root node is called rootName.
+func TreeFromPaths(r io.Reader, rootName string) (*Node, error) {
+	paths, err := readFileList(r)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &Node{Name: rootName, IsDir: true}
+	dirs := map[string]*Node{".": root}
+	var files []*Node
+	for _, p := range paths {
+		if p == "." || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) || filepath.IsAbs(p) {
+			continue
+		}
+		parent := root
+		segs := strings.Split(p, string(filepath.Separator))
+		for i, seg := range segs {
+			dirPath := filepath.Join(segs[:i+1]...)
+			if d, ok := dirs[dirPath]; ok {
+				parent = d
+				continue
+			}
+			child := &Node{Name: seg, IsDir: i < len(segs)-1}
+			parent.Children = append(parent.Children, child)
+			dirs[dirPath] = child
+			if !child.IsDir {
+				files = append(files, child)
+			}
+			parent = child
+		}
+	}
+
+	// A path listed on its own and with others below it is a directory after all
+	for _, f := range files {
+		f.IsDir = len(f.Children) > 0
+		if !f.IsDir {
+			f.FileCount = 1
+		}
+	}
+	sortTree(root)
+	countFiles(root)
+	return root, nil
+}
+
+// sortTree orders the children of every directory below node by name, as buildTree does.
+func sortTree(node *Node) {
+	sort.Slice(node.Children, func(i, j int) bool {
+		return node.Children[i].Name < node.Children[j].Name
+	})
+	for _, child := range node.Children {
+		sortTree(child)
+	}
+}
+
+// countFiles fills in the FileCount of every directory below node, and returns node's.
+func countFiles(node *Node) int {
+	if !node.IsDir {
+		return node.FileCount
+	}
+	node.FileCount = 0
+	for _, child := range node.Children {
+		node.FileCount += countFiles(child)
+	}
+	return node.FileCount
+}
+
+// restrictTo narrows the set of files the walk may include to paths, intersecting it with
+// any restriction already in place (e.g. from -changed-since-commit).
+func restrictTo(only map[string]bool, paths []string) map[string]bool {
+	restricted := make(map[string]bool)
+	for _, p := range paths {
+		if only == nil || only[p] {
+			restricted[p] = true
+		}
+	}
+	return restricted
+}
+
+// parentDirs returns every directory with one of files below it, as relative paths.
+func parentDirs(files map[string]bool) map[string]bool {
+	dirs := make(map[string]bool)
+	for f := range files {
+		for dir := filepath.Dir(f); dir != "." && !dirs[dir]; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	return dirs
+}
+
+// sortByList orders files as they appear in list. Files missing from list go last, by path.
+func sortByList(files, list []string) {
+	index := make(map[string]int, len(list))
+	for i, p := range list {
+		index[p] = i
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		a, aok := index[files[i]]
+		b, bok := index[files[j]]
+		if aok != bok {
+			return aok
+		}
+		if !aok {
+			return files[i] < files[j]
+		}
+		return a < b
+	})
+}
@@ -0,0 +1,109 @@
+package cb2md
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestReadFileList checks that paths are cleaned, deduplicated and kept in order.
+func TestReadFileList(t *testing.T) {
+	in := "b.go\n\n# a comment\n./src/a.go\n  c.go  \nb.go\n"
+	got, err := readFileList(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("readFileList error: %v", err)
+	}
+	want := []string{"b.go", filepath.Join("src", "a.go"), "c.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestFromFilePreservesOrder checks that -from-file keeps the list's order and only includes listed files.
+func TestFromFilePreservesOrder(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a.go":       "package a\n",
+		"m.go":       "package m\n",
+		"z.go":       "package z\n",
+		"src/b.go":   "package src\n",
+		"unused.go":  "package unused\n",
+		"ignored.go": "package ignored\n",
+		".ignore":    "ignored.go\n",
+	})
+	list := filepath.Join(t.TempDir(), "files.txt")
+	if err := os.WriteFile(list, []byte("z.go\nsrc/b.go\nignored.go\na.go\nm.go\nmissing.go\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, FromFile: list, ListOnly: true}, io.Discard)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	want := []string{"z.go", filepath.Join("src", "b.go"), "a.go", "m.go"}
+	if !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+}
+
+// TestFromStdin checks that a file list read from stdin selects exactly the listed files,
+// in the tree and in the file list, with the ignore rules still applied.
+func TestFromStdin(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		".ignore":       "secret.go\n",
+		"README.md":     "# App\n",
+		"main.go":       "package main\n",
+		"secret.go":     "package main\n",
+		"src/app.go":    "package src\n",
+		"src/other.go":  "package src\n",
+		"docs/guide.md": "# Guide\n",
+	})
+
+	stdin := strings.NewReader("src/app.go\nREADME.md\nsecret.go\nmain.go\n")
+	out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, FromFile: "-", Stdin: stdin, ListOnly: true})
+	want := "└── " + filepath.Base(tmp) + "\n" +
+		"    ├── README.md\n" +
+		"    ├── main.go\n" +
+		"    └── src\n" +
+		"        └── app.go\n" +
+		"\n## Full File List\n\n" +
+		"### src/app.go (go)\n" +
+		"### README.md (markdown)\n" +
+		"### main.go (go)\n"
+	if got := out; got != filepath.FromSlash(want) {
+		t.Errorf("output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestTreeFromPaths checks that a tree is rebuilt from a path list alone: directories
+// implied by the paths, sorted children, and a path listed both alone and as a parent
+// turned into a directory.
+func TestTreeFromPaths(t *testing.T) {
+	list := "src/main.go\nREADME.md\n# comment\nsrc/util/strings.go\n\ndocs\ndocs/guide.md\n../outside.go\nsrc/main.go\n"
+	root, err := TreeFromPaths(strings.NewReader(list), ".")
+	if err != nil {
+		t.Fatalf("TreeFromPaths error: %v", err)
+	}
+
+	var buf strings.Builder
+	PrintTree(&buf, root, Options{})
+	want := "" +
+		"└── .\n" +
+		"    ├── README.md\n" +
+		"    ├── docs\n" +
+		"    │   └── guide.md\n" +
+		"    └── src\n" +
+		"        ├── main.go\n" +
+		"        └── util\n" +
+		"            └── strings.go\n"
+	if buf.String() != want {
+		t.Errorf("tree got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	if root.FileCount != 4 {
+		t.Errorf("root.FileCount = %d; want 4", root.FileCount)
+	}
+}
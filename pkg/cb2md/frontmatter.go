@@ -0,0 +1,50 @@
+package cb2md
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// printFrontMatter prints a YAML front matter block saying where the output came from:
+// the number of files listed, when it was generated (unless opts.Stable), the scanned
+// directory (or file, or a list of them, with several roots) and the version of cb2md.
+// With opts.Stable, the source is only given by its base name, which doesn't change with
+// where it's checked out. The keys are always in the same, sorted, order.
+func (s *scan) printFrontMatter(w io.Writer, files []string) {
+	version := s.opts.Version
+	if version == "" {
+		version = "unknown"
+	}
+
+	fmt.Fprintln(w, "---")
+	fmt.Fprintf(w, "files: %d\n", len(files))
+	if !s.opts.Stable {
+		fmt.Fprintf(w, "generated: %s\n", time.Now().UTC().Format(time.RFC3339))
+	}
+	shown := func(path string) string {
+		if s.opts.Stable {
+			return filepath.Base(path)
+		}
+		return path
+	}
+	if s.mounts == nil {
+		fmt.Fprintf(w, "source: %s\n", strconv.Quote(shown(filepath.Join(s.root, s.file))))
+	} else {
+		sources := make([]string, 0, len(s.mounts))
+		for _, path := range s.mounts {
+			sources = append(sources, shown(path))
+		}
+		sort.Strings(sources)
+		fmt.Fprintln(w, "source:")
+		for _, path := range sources {
+			fmt.Fprintf(w, "  - %s\n", strconv.Quote(path))
+		}
+	}
+	fmt.Fprintf(w, "version: %s\n", strconv.Quote(version))
+	fmt.Fprintln(w, "---")
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,68 @@
+package cb2md
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFrontMatter checks that FrontMatter starts the output with a YAML block of sorted
+// keys, whose timestamp Stable leaves out, and whose source it cuts down to a base name.
+func TestFrontMatter(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":   "package main\n",
+		"README.md": "# Demo\n",
+	})
+
+	for _, stable := range []bool{false, true} {
+		var buf strings.Builder
+		s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, FrontMatter: true, Stable: stable, Version: "v1.2.3"}, &buf)
+		if err != nil {
+			t.Fatalf("run error: %v", err)
+		}
+		block, rest, ok := strings.Cut(strings.TrimPrefix(buf.String(), "---\n"), "---\n")
+		if !ok || !strings.HasPrefix(buf.String(), "---\n") || !strings.HasPrefix(rest, "\n└── ") {
+			t.Fatalf("output should start with a front matter block, then the tree:\n%s", buf.String())
+		}
+
+		var keys []string
+		values := make(map[string]string)
+		for _, line := range strings.Split(strings.TrimSuffix(block, "\n"), "\n") {
+			key, value, _ := strings.Cut(line, ": ")
+			keys = append(keys, key)
+			values[key] = value
+		}
+		want := []string{"files", "generated", "source", "version"}
+		if stable {
+			want = []string{"files", "source", "version"}
+		}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("Stable %v: keys %v; want %v", stable, keys, want)
+		}
+
+		if values["files"] != "2" {
+			t.Errorf("files: %s; want 2", values["files"])
+		}
+		wantSource := s.root
+		if stable {
+			wantSource = filepath.Base(s.root)
+		}
+		if source, err := strconv.Unquote(values["source"]); err != nil || source != wantSource {
+			t.Errorf("Stable %v: source: %s; want %q", stable, values["source"], wantSource)
+		}
+		if values["version"] != `"v1.2.3"` {
+			t.Errorf("version: %s; want \"v1.2.3\"", values["version"])
+		}
+		if _, err := time.Parse(time.RFC3339, values["generated"]); !stable && err != nil {
+			t.Errorf("generated: %v", err)
+		}
+	}
+
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, FrontMatter: true, Format: "xml"}, &strings.Builder{}); err == nil {
+		t.Error("expected an error for -front-matter with -format=xml")
+	}
+}
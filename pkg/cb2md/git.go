@@ -0,0 +1,65 @@
+package cb2md
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitChangedFiles returns the paths (relative to dir) that differ between the
+// working tree and the given commit, as reported by `git diff --name-only`.
+func gitChangedFiles(dir, commit string) (map[string]bool, error) {
+	if err := checkGitRev(commit); err != nil {
+		return nil, err
+	}
+	out, err := gitOutput(dir, "diff", "--name-only", "--relative", commit, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		changed[filepath.FromSlash(line)] = true
+	}
+	return changed, nil
+}
+
+// gitShow returns the content of the file at relPath (relative to dir) as of the given
+// commit, as printed by `git show commit:path`.
+func gitShow(dir, commit, relPath string) ([]byte, error) {
+	if err := checkGitRev(commit); err != nil {
+		return nil, err
+	}
+	out, err := gitOutput(dir, "show", commit+":./"+filepath.ToSlash(relPath))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+// checkGitRev rejects a revision git would parse as an option (e.g. "--output=file"),
+// since it may come from a config file rather than the command line.
+func checkGitRev(rev string) error {
+	if strings.HasPrefix(rev, "-") {
+		return fmt.Errorf("invalid git revision %q: must not start with '-'", rev)
+	}
+	return nil
+}
+
+// gitOutput runs git with the given arguments inside dir and returns its stdout.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,106 @@
+package cb2md
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initGitRepo creates a git repository in dir with the given files committed, and returns the commit SHA.
+func initGitRepo(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	writeFiles(t, dir, files)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "baseline"},
+	} {
+		if _, err := gitOutput(dir, args...); err != nil {
+			t.Fatalf("git setup failed: %v", err)
+		}
+	}
+	sha, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatalf("rev-parse failed: %v", err)
+	}
+	return strings.TrimSpace(sha)
+}
+
+// TestChangedSinceCommit checks that only files modified after the baseline commit are dumped.
+func TestChangedSinceCommit(t *testing.T) {
+	tmp := t.TempDir()
+	sha := initGitRepo(t, tmp, map[string]string{
+		"main.go":          "package main\n",
+		"pkg/util.go":      "package pkg\n",
+		"docs/guide.md":    "# Guide\n",
+		"pkg/unchanged.go": "package pkg\n",
+	})
+
+	// Modify one file after the baseline commit
+	writeFiles(t, tmp, map[string]string{"pkg/util.go": "package pkg\n\nfunc Util() {}\n"})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, ChangedSince: sha})
+
+	if !strings.Contains(got, "### "+filepath.Join("pkg", "util.go")) {
+		t.Errorf("expected changed file in output:\n%s", got)
+	}
+	for _, unwanted := range []string{"main.go", "unchanged.go", "docs", "guide.md"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("unexpected %q in output:\n%s", unwanted, got)
+		}
+	}
+}
+
+// TestContentRef checks that -content-ref dumps the committed content rather than the dirty working copy.
+func TestContentRef(t *testing.T) {
+	tmp := t.TempDir()
+	initGitRepo(t, tmp, map[string]string{
+		"main.go":     "package main // committed\n",
+		"pkg/util.go": "package pkg // committed\n",
+	})
+	writeFiles(t, tmp, map[string]string{
+		"main.go": "package main // dirty\n",
+		"new.go":  "package main // untracked\n",
+	})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, ContentRef: "HEAD"})
+	for _, want := range []string{
+		"### main.go\n```go\npackage main // committed\n```",
+		"### " + filepath.Join("pkg", "util.go") + "\n```go\npackage pkg // committed\n```",
+		"### new.go\n```go\nError reading file: ",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "dirty") || strings.Contains(got, "untracked") {
+		t.Errorf("expected no working-tree content:\n%s", got)
+	}
+}
+
+// TestGitRevOption checks that a revision starting with "-" is rejected instead of being
+// passed to git as an option.
+func TestGitRevOption(t *testing.T) {
+	tmp := t.TempDir()
+	initGitRepo(t, tmp, map[string]string{"main.go": "package main\n"})
+
+	pwned := filepath.Join(t.TempDir(), "pwned")
+	for _, opts := range []Options{
+		{IgnoreFile: ".ignore", ChangedSince: "--output=" + pwned},
+		{IgnoreFile: ".ignore", ContentRef: "--output=" + pwned},
+	} {
+		if _, err := run(tmp, opts, io.Discard); err == nil || !strings.Contains(err.Error(), "must not start with '-'") {
+			t.Errorf("run(%+v) error = %v; want a rejected revision", opts, err)
+		}
+		if _, err := os.Stat(pwned); err == nil {
+			t.Fatalf("git wrote %s", pwned)
+		}
+	}
+}
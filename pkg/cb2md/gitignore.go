@@ -0,0 +1,119 @@
+package cb2md
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gitignoreRule is one pattern line from a .gitignore file.
+type gitignoreRule struct {
+	line     string // the line as written
+	pattern  string // glob with the "!", leading "/" and trailing "/" removed
+	base     string // directory of the .gitignore, relative to the scan root ("" for the root)
+	negate   bool   // "!pattern" re-includes what an earlier rule excluded
+	dirOnly  bool   // "pattern/" only matches directories
+	anchored bool   // a slash at the start or in the middle ties the pattern to base
+}
+
+// findNestedFiles lists the files called name below root (excluding root's own), relative
+// to root, skipping hidden directories just like the walk does.
+func findNestedFiles(root, name string) []string {
+	var found []string
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && d.Name() == name && filepath.Dir(path) != root {
+			if rel, err := filepath.Rel(root, path); err == nil {
+				found = append(found, rel)
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// loadGitignore parses the .gitignore in dir (if any). base is dir relative to the scan root.
+func loadGitignore(dir, base string) []gitignoreRule {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		// If not found, no rules
+		return nil
+	}
+	defer f.Close()
+
+	var rules []gitignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseGitignoreLine(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parseGitignoreLine turns one .gitignore line into a rule; ok is false for blanks and comments.
+func parseGitignoreLine(line, base string) (rule gitignoreRule, ok bool) {
+	// Trailing spaces are dropped unless escaped with a backslash
+	line = strings.TrimRight(line, "\r")
+	trimmed := strings.TrimRight(line, " \t")
+	if strings.HasSuffix(trimmed, `\`) && len(trimmed) < len(line) {
+		trimmed = trimmed[:len(trimmed)-1] + " "
+	}
+	line = trimmed
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+
+	rule.line = line
+	rule.base = filepath.ToSlash(base)
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		// Escaped leading "!" or "#" is literal
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+	rule.pattern = line
+	return rule, true
+}
+
+// matches reports whether the rule applies to relPath (relative to the scan root).
+func (r gitignoreRule) matches(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	// Rules only apply inside the directory holding their .gitignore
+	rel := filepath.ToSlash(relPath)
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(rel, r.base+"/")
+	}
+
+	if r.anchored {
+		return matchGlob(r.pattern, rel)
+	}
+	// Without a slash, the pattern matches the name at any depth
+	return matchGlob(r.pattern, rel[strings.LastIndex(rel, "/")+1:])
+}
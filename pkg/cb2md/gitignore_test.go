@@ -0,0 +1,108 @@
+package cb2md
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestNestedGitignore checks that a root .gitignore and a nested one both apply, each to its own scope.
+func TestNestedGitignore(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		".gitignore":     "*.log\n/dist\nbuild/\n",
+		"src/.gitignore": "!keep.log\ngenerated/\n",
+
+		"app.log":            "ignored by root *.log\n",
+		"main.go":            "kept\n",
+		"dist/bundle.js":     "ignored by anchored /dist\n",
+		"build/out.txt":      "ignored by build/\n",
+		"src/keep.log":       "re-included by nested negation\n",
+		"src/other.log":      "still ignored by root *.log\n",
+		"src/dist/page.js":   "kept: /dist is anchored to the root\n",
+		"src/build":          "kept: build/ only matches directories\n",
+		"src/generated/z.go": "ignored by nested generated/\n",
+		"lib/generated/w.go": "kept: nested rule doesn't reach lib\n",
+	})
+
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, Gitignore: true, ListOnly: true}, io.Discard)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	want := []string{
+		filepath.Join("lib", "generated", "w.go"),
+		"main.go",
+		filepath.Join("src", "build"),
+		filepath.Join("src", "dist", "page.js"),
+		filepath.Join("src", "keep.log"),
+	}
+	if !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+}
+
+// TestGitignoreNotUsedByDefault checks that .gitignore files are ignored unless -gitignore is set.
+func TestGitignoreNotUsedByDefault(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{".gitignore": "*.log\n", "app.log": "x\n"})
+
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, ListOnly: true}, io.Discard)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if !reflect.DeepEqual(s.included, []string{"app.log"}) {
+		t.Errorf("included files got %v, want [app.log]", s.included)
+	}
+}
+
+// TestGitignoreSemantics checks precedence within one .gitignore, anchoring, directory-only
+// patterns and "**", against paths relative to the root.
+func TestGitignoreSemantics(t *testing.T) {
+	var local []gitignoreRule
+	for _, line := range []string{
+		"*.log",
+		"!important.log",
+		"/dist",
+		"build/",
+		"**/node_modules",
+		"docs/**/*.tmp",
+		`trailing\ `,
+		"# a comment",
+		"",
+	} {
+		if r, ok := parseGitignoreLine(line, ""); ok {
+			local = append(local, r)
+		}
+	}
+	rs := ruleSet{}.withGitignore(local, ".gitignore")
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  ruleAction
+	}{
+		{"debug.log", false, actionExclude},
+		{"logs/app.log", false, actionExclude},
+		{"important.log", false, actionInclude}, // the later negation overrides *.log
+		{"sub/important.log", false, actionInclude},
+		{"dist", true, actionExclude},
+		{"web/dist", true, actionNone}, // "/dist" only matches at the root
+		{"build", true, actionExclude},
+		{"build", false, actionNone}, // "build/" only matches directories
+		{"src/build", true, actionExclude},
+		{"node_modules", true, actionExclude},
+		{"a/b/c/node_modules", true, actionExclude},
+		{"docs/x.tmp", false, actionExclude},
+		{"docs/a/b/x.tmp", false, actionExclude},
+		{"src/x.tmp", false, actionNone},
+		{"trailing ", false, actionExclude},
+		{"trailing", false, actionNone},
+	}
+	for _, tt := range tests {
+		if got, _ := rs.decide(filepath.FromSlash(tt.path), tt.isDir); got != tt.want {
+			t.Errorf("decide(%q, dir=%v) = %v; want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package cb2md
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// printRepoHeader prints a short summary of the scanned repository: its name, how many files
+// the tree holds and their total size, the most common language among the dumped files and,
+// when the root is inside a git repository, the current branch and commit.
+func (s *scan) printRepoHeader(w io.Writer, rootNode *Node, files []string) {
+	name := filepath.Base(s.root)
+	if s.mounts != nil {
+		names := make([]string, len(rootNode.Children))
+		for i, child := range rootNode.Children {
+			names[i] = child.Name
+		}
+		name = strings.Join(names, " + ")
+	}
+	fmt.Fprintf(w, "# %s\n\n", name)
+	fmt.Fprintf(w, "- **Files:** %d (%s)\n", len(s.fileInfos), formatSize(rootNode.Size))
+	if lang, n := dominantLanguage(files); lang != "" {
+		fmt.Fprintf(w, "- **Dominant language:** %s (%d files)\n", lang, n)
+	}
+	if branch, commit := gitHead(s.root); commit != "" {
+		if branch == "" || branch == "HEAD" {
+			branch = "detached"
+		}
+		fmt.Fprintf(w, "- **Git:** `%s` @ `%s`\n", branch, commit)
+	}
+	fmt.Fprintln(w)
+}
+
+// dominantLanguage returns the language most files are written in, with its file count.
+// Ties go to the alphabetically first language; files of unknown language don't count.
+func dominantLanguage(files []string) (string, int) {
+	counts := make(map[string]int)
+	for _, f := range files {
+		if lang := guessLanguage(f); lang != "" {
+			counts[lang]++
+		}
+	}
+	best, bestN := "", 0
+	for lang, n := range counts {
+		if n > bestN || (n == bestN && lang < best) {
+			best, bestN = lang, n
+		}
+	}
+	return best, bestN
+}
+
+// gitHead returns the current branch and abbreviated commit of the repository containing
+// dir, or two empty strings if dir isn't in a git repository (or git isn't available).
+func gitHead(dir string) (branch, commit string) {
+	out, err := gitOutput(dir, "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return "", ""
+	}
+	commit = strings.TrimSpace(out)
+	if out, err = gitOutput(dir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil {
+		branch = strings.TrimSpace(out)
+	}
+	return branch, commit
+}
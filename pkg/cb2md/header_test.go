@@ -0,0 +1,51 @@
+package cb2md
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRepoHeader checks the summary of a known tree, outside of git.
+func TestRepoHeader(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":      "package main\n",
+		"util/a.go":    "package util\n",
+		"util/b.go":    "package util\n",
+		"web/app.js":   "let x\n",
+		"web/logo.png": "png",
+	})
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, RepoHeader: true, ListOnly: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "# "+filepath.Base(tmp)+"\n") {
+		t.Errorf("header should start with the root name; got:\n%s", out)
+	}
+	for _, want := range []string{"- **Files:** 5 (", "- **Dominant language:** go (3 files)\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("header missing %q; got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "**Git:**") {
+		t.Errorf("header shouldn't have git fields outside a repository; got:\n%s", out)
+	}
+}
+
+// TestRepoHeaderGit checks that the header shows the commit inside a git repository.
+func TestRepoHeaderGit(t *testing.T) {
+	tmp := t.TempDir()
+	sha := initGitRepo(t, tmp, map[string]string{"main.go": "package main\n"})
+
+	out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, RepoHeader: true, ListOnly: true})
+	branch, commit := gitHead(tmp)
+	if !strings.HasPrefix(sha, commit) || commit == "" {
+		t.Fatalf("gitHead commit %q isn't a prefix of %q", commit, sha)
+	}
+	if want := "- **Git:** `" + branch + "` @ `" + commit + "`\n"; !strings.Contains(out, want) {
+		t.Errorf("header missing %q; got:\n%s", want, out)
+	}
+}
@@ -0,0 +1,46 @@
+package cb2md
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates each file (and its parent directories) under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+}
+
+// runOutput returns what a run over dir with opts writes to stdout.
+func runOutput(t *testing.T, dir string, opts Options) string {
+	t.Helper()
+	var buf strings.Builder
+	if _, err := run(dir, opts, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	return buf.String()
+}
+
+// readOutput returns what a run over dir writes to an output file in the given format.
+func readOutput(t *testing.T, dir, format string) string {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "out."+format)
+	if _, err := run(dir, Options{IgnoreFile: ".ignore", Markdown: true, Format: format, OutFile: out}, nil); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	return string(data)
+}
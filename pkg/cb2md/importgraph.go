@@ -0,0 +1,260 @@
+package cb2md
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// importGraph records which listed files import which others. Imports that don't resolve
+// to a listed file (third-party packages, excluded files, ...) are kept separately.
+type importGraph struct {
+	edges      map[string][]string // file -> files it imports
+	unresolved map[string][]string // file -> import paths as written
+}
+
+// jsImportRE matches the module specifier of ES module imports and re-exports, dynamic
+// imports and CommonJS require calls.
+var jsImportRE = regexp.MustCompile(`(?m)(?:^\s*import\s+(?:[\w*{}\s,$]+\s+from\s+)?|^\s*export\s+[\w*{}\s,$]+\s+from\s+|\bimport\s*\(\s*|\brequire\s*\(\s*)['"]([^'"]+)['"]`)
+
+// jsExtensions are tried, in order, when resolving a JS/TS import without an extension.
+var jsExtensions = []string{".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs"}
+
+// buildImportGraph parses the imports of the Go and JS/TS files among files and resolves
+// them against files. Go imports are resolved through the module path in the root's (or
+// with merged roots, each root's) go.mod; JS/TS imports relative to the importing file.
+func (s *scan) buildImportGraph(files []string) *importGraph {
+	g := &importGraph{edges: make(map[string][]string), unresolved: make(map[string][]string)}
+
+	// Index the listed files by slash-separated path, and the Go files by directory
+	bySlash := make(map[string]string, len(files))
+	goDirs := make(map[string][]string)
+	for _, f := range files {
+		p := filepath.ToSlash(f)
+		bySlash[p] = f
+		if guessLanguage(f) == "go" && !strings.HasSuffix(p, "_test.go") {
+			goDirs[path.Dir(p)] = append(goDirs[path.Dir(p)], f)
+		}
+	}
+
+	// The Go module of each root, keyed by the directory its files are listed under
+	modules := map[string]string{".": goModulePath(filepath.Join(s.root, "go.mod"))}
+	if s.mounts != nil {
+		modules = make(map[string]string, len(s.mounts))
+		for name, root := range s.mounts {
+			modules[filepath.ToSlash(name)] = goModulePath(filepath.Join(root, "go.mod"))
+		}
+	}
+
+	for _, f := range files {
+		language := guessLanguage(f)
+		if language != "go" && !isJSLanguage(language) {
+			continue
+		}
+		content, err := s.readContent(f)
+		if err != nil {
+			continue
+		}
+
+		p := filepath.ToSlash(f)
+		var imports []string
+		if language == "go" {
+			imports = goImports(content)
+		} else {
+			imports = jsImports(content)
+		}
+		for _, imp := range imports {
+			var targets []string
+			if language == "go" {
+				// The module's own packages first: its path may have no dot either
+				var inModule bool
+				targets, inModule = resolveGoImport(imp, modules, goDirs)
+				if !inModule && isGoStdlib(imp) {
+					continue
+				}
+			} else if target, ok := resolveJSImport(p, imp, bySlash); ok {
+				targets = []string{target}
+			}
+
+			if len(targets) == 0 {
+				g.unresolved[f] = appendUnique(g.unresolved[f], imp)
+			}
+			for _, t := range targets {
+				if t != f {
+					g.edges[f] = appendUnique(g.edges[f], t)
+				}
+			}
+		}
+	}
+	for _, targets := range g.edges {
+		sort.Strings(targets)
+	}
+	return g
+}
+
+// readContent reads the whole content of the file at relative path fpath, from wherever
+// its code block would come from.
+func (s *scan) readContent(fpath string) ([]byte, error) {
+	r, err := s.openContent(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// isJSLanguage reports whether language is one of the JavaScript/TypeScript dialects.
+func isJSLanguage(language string) bool {
+	switch language {
+	case "javascript", "jsx", "typescript", "tsx":
+		return true
+	}
+	return false
+}
+
+// goImports returns the import paths of a Go source file, or nil if it doesn't parse.
+func goImports(src []byte) []string {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+	var imports []string
+	for _, spec := range f.Imports {
+		if imp, err := strconv.Unquote(spec.Path.Value); err == nil {
+			imports = append(imports, imp)
+		}
+	}
+	return imports
+}
+
+// isGoStdlib reports whether a Go import path belongs to the standard library, whose
+// first element, unlike that of any module path that can be fetched, has no dot. Local
+// modules like "app" don't need one, so check those first.
+func isGoStdlib(imp string) bool {
+	first, _, _ := strings.Cut(imp, "/")
+	return !strings.Contains(first, ".")
+}
+
+// resolveGoImport returns the listed (non-test) Go files of the package imp, and whether
+// it lies within one of modules (module paths keyed by the directory their files are
+// listed under) at all.
+func resolveGoImport(imp string, modules map[string]string, goDirs map[string][]string) ([]string, bool) {
+	for dir, modulePath := range modules {
+		if modulePath == "" {
+			continue
+		}
+		if imp == modulePath {
+			return goDirs[dir], true
+		}
+		if rest, ok := strings.CutPrefix(imp, modulePath+"/"); ok {
+			return goDirs[path.Join(dir, rest)], true
+		}
+	}
+	return nil, false
+}
+
+// goModulePath returns the module path declared in the go.mod file at gomod, or "" if
+// there is none.
+func goModulePath(gomod string) string {
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return ""
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "module"); ok {
+			return strings.Trim(strings.TrimSpace(rest), `"`)
+		}
+	}
+	return ""
+}
+
+// jsImports returns the module specifiers imported or required by a JS/TS source file.
+func jsImports(src []byte) []string {
+	var imports []string
+	for _, m := range jsImportRE.FindAllSubmatch(src, -1) {
+		imports = append(imports, string(m[1]))
+	}
+	return imports
+}
+
+// resolveJSImport resolves a relative specifier imported by the file at slash path from
+// to one of the listed files, trying the usual extensions and index files. Package imports
+// don't resolve.
+func resolveJSImport(from, spec string, bySlash map[string]string) (string, bool) {
+	if !strings.HasPrefix(spec, "./") && !strings.HasPrefix(spec, "../") {
+		return "", false
+	}
+	base := path.Join(path.Dir(from), spec)
+	candidates := []string{base}
+	for _, ext := range jsExtensions {
+		candidates = append(candidates, base+ext)
+	}
+	for _, ext := range jsExtensions {
+		candidates = append(candidates, base+"/index"+ext)
+	}
+	for _, c := range candidates {
+		if f, ok := bySlash[c]; ok {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// appendUnique appends v to list unless it's already there.
+func appendUnique(list []string, v string) []string {
+	for _, x := range list {
+		if x == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// printImportGraph prints the “Import Graph” section: each file in files that imports
+// other listed files, followed by those files, and then the imports left unresolved.
+func printImportGraph(w io.Writer, g *importGraph, files []string) {
+	fmt.Fprintln(w, "## Import Graph")
+	fmt.Fprintln(w)
+	if len(g.edges) == 0 {
+		fmt.Fprintln(w, "_No imports between the listed files._")
+		fmt.Fprintln(w)
+	}
+	for _, f := range files {
+		if targets := g.edges[f]; len(targets) > 0 {
+			fmt.Fprintf(w, "- `%s`\n", f)
+			for _, t := range targets {
+				fmt.Fprintf(w, "  - `%s`\n", t)
+			}
+		}
+	}
+	if len(g.edges) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	if len(g.unresolved) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "### Unresolved Imports")
+	fmt.Fprintln(w)
+	for _, f := range files {
+		if imports := g.unresolved[f]; len(imports) > 0 {
+			quoted := make([]string, len(imports))
+			for i, imp := range imports {
+				quoted[i] = "`" + imp + "`"
+			}
+			fmt.Fprintf(w, "- `%s`: %s\n", f, strings.Join(quoted, ", "))
+		}
+	}
+	fmt.Fprintln(w)
+}
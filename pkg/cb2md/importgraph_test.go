@@ -0,0 +1,101 @@
+package cb2md
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestImportGraphGo checks that an import of another package in the module becomes an
+// edge to that package's files, while third-party imports are reported as unresolved.
+func TestImportGraphGo(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"go.mod":            "module example.com/app\n\ngo 1.22\n",
+		"main.go":           "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/app/util\"\n\t\"github.com/other/lib\"\n)\n\nfunc main() { fmt.Println(util.Name, lib.X) }\n",
+		"util/util.go":      "package util\n\nconst Name = \"util\"\n",
+		"util/util_test.go": "package util\n\nimport \"testing\"\n",
+	})
+
+	var buf strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, ListOnly: true, ImportGraph: true}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	g := s.buildImportGraph(s.included)
+	if want := map[string][]string{"main.go": {"util/util.go"}}; !reflect.DeepEqual(g.edges, want) {
+		t.Errorf("edges = %v; want %v", g.edges, want)
+	}
+	if want := map[string][]string{"main.go": {"github.com/other/lib"}}; !reflect.DeepEqual(g.unresolved, want) {
+		t.Errorf("unresolved = %v; want %v", g.unresolved, want)
+	}
+
+	want := "## Import Graph\n\n" +
+		"- `main.go`\n" +
+		"  - `util/util.go`\n\n" +
+		"### Unresolved Imports\n\n" +
+		"- `main.go`: `github.com/other/lib`\n\n"
+	if !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("output should end with the import graph; got:\n%s\nwant suffix:\n%s", buf.String(), want)
+	}
+}
+
+// TestImportGraphDotlessModule checks that a module path without a dot, like "app", isn't
+// mistaken for the standard library: its packages' imports become edges, and those of its
+// packages with no files listed are unresolved rather than dropped.
+func TestImportGraphDotlessModule(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"go.mod":       "module app\n\ngo 1.22\n",
+		"main.go":      "package main\n\nimport (\n\t\"fmt\"\n\n\t\"app/gone\"\n\t\"app/util\"\n)\n\nfunc main() { fmt.Println(util.Name, gone.X) }\n",
+		"util/util.go": "package util\n\nconst Name = \"util\"\n",
+	})
+
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, ListOnly: true}, new(strings.Builder))
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	g := s.buildImportGraph(s.included)
+	if want := map[string][]string{"main.go": {"util/util.go"}}; !reflect.DeepEqual(g.edges, want) {
+		t.Errorf("edges = %v; want %v", g.edges, want)
+	}
+	if want := map[string][]string{"main.go": {"app/gone"}}; !reflect.DeepEqual(g.unresolved, want) {
+		t.Errorf("unresolved = %v; want %v", g.unresolved, want)
+	}
+}
+
+// TestImportGraphJS checks that relative JS/TS imports resolve with or without an
+// extension, and to index files, while package imports stay unresolved.
+func TestImportGraphJS(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"src/app.ts":            "import { api } from './api';\nimport React from 'react';\nimport './styles/index.js';\nconst cfg = require(\"../config.js\");\n",
+		"src/api.ts":            "export const api = {};\n",
+		"src/styles/index.js":   "export default {};\n",
+		"config.js":             "module.exports = {};\n",
+		"src/lazy.js":           "const m = import('./missing');\n",
+		"src/reexport/index.ts": "export * from '../api';\n",
+	})
+
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, ListOnly: true}, new(strings.Builder))
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	g := s.buildImportGraph(s.included)
+	wantEdges := map[string][]string{
+		"src/app.ts":            {"config.js", "src/api.ts", "src/styles/index.js"},
+		"src/reexport/index.ts": {"src/api.ts"},
+	}
+	if !reflect.DeepEqual(g.edges, wantEdges) {
+		t.Errorf("edges = %v; want %v", g.edges, wantEdges)
+	}
+	wantUnresolved := map[string][]string{
+		"src/app.ts":  {"react"},
+		"src/lazy.js": {"./missing"},
+	}
+	if !reflect.DeepEqual(g.unresolved, wantUnresolved) {
+		t.Errorf("unresolved = %v; want %v", g.unresolved, wantUnresolved)
+	}
+}
@@ -0,0 +1,93 @@
+package cb2md
+
+import (
+	"bytes"
+	"io"
+)
+
+// jsonOutput is the document -format=json prints: the tree, and the files of the Full
+// File List.
+type jsonOutput struct {
+	Tree  *Node      `json:"tree,omitempty"`
+	Files []jsonFile `json:"files"`
+}
+
+// jsonFile is a file of the Full File List in -format=json output. Omitted says why
+// Content is missing, if it is, and Error why it may be incomplete.
+type jsonFile struct {
+	Path     string `json:"path"`
+	Language string `json:"language,omitempty"`
+	Size     int64  `json:"size"`
+	Lines    int    `json:"lines"`
+	Content  string `json:"content,omitempty"`
+	Preview  string `json:"preview,omitempty"`
+	Omitted  string `json:"omitted,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// printJSON prints the output for -format=json: the tree at rootNode as nested objects
+// and, in Markdown mode, an entry for each of files with its contents.
+func (s *scan) printJSON(w io.Writer, rootNode *Node, files []string) {
+	opts := s.opts
+	out := jsonOutput{Files: []jsonFile{}}
+	if !opts.NoTree {
+		out.Tree = rootNode
+	}
+
+	if opts.Markdown && !opts.TreeOnly {
+		for _, fpath := range files {
+			out.Files = append(out.Files, s.jsonFile(fpath))
+		}
+	}
+
+	// There's nowhere to report an error to but the output itself, which is gone by then
+	_ = encodeJSON(w, out, opts.JSONPretty)
+}
+
+// jsonFile returns the entry for the file at relative path fpath in the -format=json output.
+func (s *scan) jsonFile(fpath string) jsonFile {
+	opts := s.opts
+	f := jsonFile{Path: s.shownPath(fpath), Language: s.fileLanguage(fpath), Size: s.fileSize(fpath)}
+	if opts.ListOnly {
+		return f
+	}
+
+	// Files a filter left out are only there to say so
+	if s.filtered[fpath] {
+		f.Omitted = "content excluded by filter"
+		return f
+	}
+
+	// Files whose content we skip only get a short hex dump, if anything
+	var (
+		content []byte
+		err     error
+	)
+	switch {
+	case opts.HexPreview && s.contentSkipped[fpath]:
+		var dump bytes.Buffer
+		err = printHexPreview(s.absPath(fpath), &dump)
+		content, f.Preview = dump.Bytes(), "hex"
+	case s.contentSkipped[fpath]:
+		f.Omitted = "skip-content file"
+		return f
+	default:
+		content, err = s.fileContent(fpath, f.Language)
+	}
+
+	if reason := s.omittedReason(err); reason != "" {
+		f.Omitted = reason
+		return f
+	}
+	if err != nil {
+		f.Error = err.Error()
+	}
+
+	if opts.PathComment {
+		if comment := pathComment(fpath, f.Language); comment != "" {
+			content = append([]byte(comment+"\n"), content...)
+		}
+	}
+	f.Content, f.Lines = string(content), countLines(content)
+	return f
+}
@@ -0,0 +1,57 @@
+package cb2md
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFormatJSON checks that -format=json prints the tree as nested objects, without
+// children for files, followed by the included files with their language, size, line
+// count and contents.
+func TestFormatJSON(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":       "package main\n\nfunc main() {}\n",
+		"docs/intro.md": "# Intro",
+		"logo.png":      "\x89PNG",
+	})
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, Format: "json"}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	var out struct {
+		Tree  *Node
+		Files []jsonFile
+	}
+	if err := json.Unmarshal([]byte(buf.String()), &out); err != nil {
+		t.Fatalf("output isn't JSON: %v\n%s", err, buf.String())
+	}
+
+	tree := out.Tree
+	if tree == nil || tree.Name != filepath.Base(tmp) || !tree.IsDir || len(tree.Children) != 3 {
+		t.Fatalf("unexpected root: %+v", tree)
+	}
+	docs := tree.Children[0]
+	if docs.Name != "docs" || !docs.IsDir || len(docs.Children) != 1 || docs.Children[0].Name != "intro.md" {
+		t.Errorf("unexpected docs node: %+v", docs)
+	}
+	if !strings.Contains(buf.String(), `{"name":"main.go","isDir":false}`) {
+		t.Errorf("a file's node should have no children:\n%s", buf.String())
+	}
+
+	want := []jsonFile{
+		{Path: filepath.Join("docs", "intro.md"), Language: "markdown", Size: 7, Lines: 1, Content: "# Intro"},
+		{Path: "main.go", Language: "go", Size: 29, Lines: 3, Content: "package main\n\nfunc main() {}\n"},
+	}
+	if len(out.Files) != len(want) {
+		t.Fatalf("got %d files, want %d: %+v", len(out.Files), len(want), out.Files)
+	}
+	for i := range want {
+		if out.Files[i] != want[i] {
+			t.Errorf("file %d = %+v; want %+v", i, out.Files[i], want[i])
+		}
+	}
+}
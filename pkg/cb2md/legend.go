@@ -0,0 +1,43 @@
+package cb2md
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// printLegend prints a table mapping each file extension among files to the language
+// used for its code fences. Extensions without a known language are left out, and so are
+// well-known files recognized by name (go.mod isn't what makes .mod files Go modules).
+func (s *scan) printLegend(w io.Writer, files []string) {
+	languages := make(map[string]string)
+	for _, f := range files {
+		if _, ok := filenameLanguages[strings.ToLower(filepath.Base(f))]; ok {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(f))
+		if lang := s.fileLanguage(f); ext != "" && lang != "" {
+			languages[ext] = lang
+		}
+	}
+	if len(languages) == 0 {
+		return
+	}
+
+	exts := make([]string, 0, len(languages))
+	for ext := range languages {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+
+	fmt.Fprintln(w, "## Legend")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Extension | Language |")
+	fmt.Fprintln(w, "|-----------|----------|")
+	for _, ext := range exts {
+		fmt.Fprintf(w, "| `%s` | %s |\n", ext, languages[ext])
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,37 @@
+package cb2md
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestLegend checks that -legend lists every distinct extension with its language, once,
+// from a shebang line for an extension that doesn't tell.
+func TestLegend(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":        "package main",
+		"util/util.go":   "package util",
+		"web/app.ts":     "export {}",
+		"conf/a.yml":     "a: 1",
+		"conf/b.yaml":    "b: 2",
+		"notes.xyz":      "unknown",
+		"Makefile":       "all:",
+		"docs/README.MD": "# Hi",
+		"cgi/form.cgi":   "#!/usr/bin/perl\nprint 1;\n",
+	})
+
+	out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, Legend: true, ListOnly: true})
+	want := "## Legend\n\n" +
+		"| Extension | Language |\n" +
+		"|-----------|----------|\n" +
+		"| `.cgi` | perl |\n" +
+		"| `.go` | go |\n" +
+		"| `.md` | markdown |\n" +
+		"| `.ts` | typescript |\n" +
+		"| `.yaml` | yaml |\n" +
+		"| `.yml` | yaml |\n\n"
+	if !strings.HasPrefix(out, want) {
+		t.Errorf("output should start with the legend; got:\n%s\nwant prefix:\n%s", out, want)
+	}
+}
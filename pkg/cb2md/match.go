@@ -0,0 +1,84 @@
+package cb2md
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// matchGlob reports whether relPath matches pattern, comparing one path segment at a time.
+// A single "*" never crosses a "/", so "src/*.go" only matches direct children of src,
+// while a "**" segment matches any number of directories, so "src/**/*.go" matches at any depth.
+// It backs both the ignore and include pattern checks.
+func matchGlob(pattern, relPath string) bool {
+	patSegs := strings.Split(filepath.ToSlash(pattern), "/")
+	pathSegs := strings.Split(filepath.ToSlash(relPath), "/")
+	return matchSegments(patSegs, pathSegs)
+}
+
+// matchSegments matches pattern segments against path segments, expanding "**" recursively.
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			// Collapse runs like "**/**" into a single globstar
+			for len(pat) > 1 && pat[1] == "**" {
+				pat = pat[1:]
+			}
+			// A trailing "**" matches everything below, but not the directory itself
+			if len(pat) == 1 {
+				return len(segs) > 0
+			}
+			// Otherwise try letting "**" swallow 0, 1, 2, ... segments
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segs) == 0 {
+			return false
+		}
+		matched, err := path.Match(pat[0], segs[0])
+		if err != nil || !matched {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// includePattern turns an -include value into a glob: a bare extension, like "go" or
+// ".go", stands for "*.go"; anything else is a glob already.
+func includePattern(v string) string {
+	if strings.ContainsAny(v, "*?[/") {
+		return v
+	}
+	if ext, ok := strings.CutPrefix(v, "."); ok && !strings.Contains(ext, ".") {
+		return "*." + ext
+	}
+	if !strings.Contains(v, ".") {
+		return "*." + v
+	}
+	return v
+}
+
+// matchesAnyInclude reports whether relPath matches any of the -include patterns. Like
+// skip-content patterns, they are case-insensitive and, without a "/", match the base
+// name; patterns with a "/" match the whole path, with "**" as in ignore files.
+func matchesAnyInclude(relPath string, patterns []string) bool {
+	for _, p := range patterns {
+		p = includePattern(p)
+		if !strings.Contains(p, "/") {
+			if matchesAnySkipContent(relPath, []string{p}) {
+				return true
+			}
+			continue
+		}
+		if matchGlob(strings.ToLower(p), strings.ToLower(relPath)) {
+			return true
+		}
+	}
+	return false
+}
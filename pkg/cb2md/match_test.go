@@ -0,0 +1,77 @@
+package cb2md
+
+import "testing"
+
+// TestMatchGlob distinguishes single-segment "*" from recursive "**".
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		relPath string
+		want    bool
+	}{
+		// "*" stays within one directory level
+		{"src/*.go", "src/main.go", true},
+		{"src/*.go", "src/pkg/util.go", false},
+		{"src/*.go", "main.go", false},
+		{"*.log", "debug.log", true},
+		{"*.log", "logs/debug.log", false},
+
+		// "**" crosses directory levels, including zero of them
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/pkg/util.go", true},
+		{"src/**/*.go", "src/pkg/deep/util.go", true},
+		{"src/**/*.go", "other/pkg/util.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/c.go", true},
+		{"src/**", "src/a/b.txt", true},
+		{"src/**", "src", false},
+		{"a/**/**/b", "a/x/b", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/c", false},
+		{"**/node_modules", "node_modules", true},
+		{"**/node_modules", "web/app/node_modules", true},
+		{"**/node_modules", "web/node_modules.txt", false},
+
+		// Plain names still need an exact match
+		{"secret.txt", "secret.txt", true},
+		{"secret.txt", "dir/secret.txt", false},
+	}
+	for _, tt := range tests {
+		got := matchGlob(tt.pattern, tt.relPath)
+		if got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v; want %v", tt.pattern, tt.relPath, got, tt.want)
+		}
+	}
+}
+
+// TestMatchesAnyInclude checks extension shorthands, case-insensitive base-name globs,
+// and path globs.
+func TestMatchesAnyInclude(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		relPath  string
+		want     bool
+	}{
+		{[]string{"*.go"}, "main.go", true},
+		{[]string{"*.go"}, "pkg/util/strings.go", true},
+		{[]string{"*.go"}, "main.GO", true},
+		{[]string{"*.go"}, "main.py", false},
+		{[]string{"go"}, "cmd/main.go", true},
+		{[]string{".go"}, "cmd/main.go", true},
+		{[]string{"go"}, "go.mod", false},
+		{[]string{"*file"}, "build/Makefile", true},
+		{[]string{"Makefile"}, "Makefile", false}, // a bare word is an extension
+		{[]string{"go.mod"}, "go.mod", true},
+		{[]string{"src/**/*.ts"}, "src/app/main.ts", true},
+		{[]string{"src/**/*.ts"}, "SRC/App/main.TS", true},
+		{[]string{"src/**/*.ts"}, "lib/main.ts", false},
+		{[]string{"*.md", "*.go"}, "README.md", true},
+		{nil, "main.go", false},
+	}
+	for _, tt := range tests {
+		if got := matchesAnyInclude(tt.relPath, tt.patterns); got != tt.want {
+			t.Errorf("matchesAnyInclude(%q, %q) = %v; want %v", tt.relPath, tt.patterns, got, tt.want)
+		}
+	}
+}
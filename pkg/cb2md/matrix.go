@@ -0,0 +1,64 @@
+package cb2md
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// printMatrixIndex prints a Markdown table counting files by directory (rows) and language
+// (columns), for a view of what a big dump is made of. Each file counts toward the
+// directory it's directly in; files of no known language go in an "other" column, last.
+// Empty cells are left blank.
+func (s *scan) printMatrixIndex(w io.Writer, files []string) {
+	if len(files) == 0 {
+		return
+	}
+	counts := make(map[string]map[string]int)
+	seen := make(map[string]bool)
+	for _, f := range files {
+		dir := filepath.ToSlash(filepath.Dir(f))
+		language := s.fileLanguage(f)
+		if language == "" {
+			language = "other"
+		}
+		if counts[dir] == nil {
+			counts[dir] = make(map[string]int)
+		}
+		counts[dir][language]++
+		seen[language] = true
+	}
+
+	dirs := make([]string, 0, len(counts))
+	for dir := range counts {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	languages := make([]string, 0, len(seen))
+	for language := range seen {
+		if language != "other" {
+			languages = append(languages, language)
+		}
+	}
+	sort.Strings(languages)
+	if seen["other"] {
+		languages = append(languages, "other")
+	}
+
+	fmt.Fprintln(w, "## Index by Directory and Language")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "| Directory | %s |\n", strings.Join(languages, " | "))
+	fmt.Fprintf(w, "|-----------|%s\n", strings.Repeat("---:|", len(languages)))
+	for _, dir := range dirs {
+		cells := make([]string, len(languages))
+		for i, language := range languages {
+			if n := counts[dir][language]; n > 0 {
+				cells[i] = fmt.Sprint(n)
+			}
+		}
+		fmt.Fprintf(w, "| `%s` | %s |\n", dir, strings.Join(cells, " | "))
+	}
+	fmt.Fprintln(w)
+}
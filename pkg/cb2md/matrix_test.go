@@ -0,0 +1,35 @@
+package cb2md
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMatrixIndex checks that -matrix-index counts the included files of each directory by
+// language, with the unknown ones last and empty cells blank.
+func TestMatrixIndex(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":          "package main",
+		"README.md":        "# Hi",
+		"cmd/run.go":       "package cmd",
+		"cmd/serve.go":     "package cmd",
+		"cmd/notes.xyz":    "unknown",
+		"web/app.ts":       "export {}",
+		"web/lib/util.ts":  "export {}",
+		"web/lib/types.ts": "export {}",
+		"web/lib/logo.png": "skipped",
+	})
+
+	out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, MatrixIndex: true, ListOnly: true})
+	want := "## Index by Directory and Language\n\n" +
+		"| Directory | go | markdown | typescript | other |\n" +
+		"|-----------|---:|---:|---:|---:|\n" +
+		"| `.` | 1 | 1 |  |  |\n" +
+		"| `cmd` | 2 |  |  | 1 |\n" +
+		"| `web` |  |  | 1 |  |\n" +
+		"| `web/lib` |  |  | 2 |  |\n\n"
+	if !strings.HasPrefix(out, want) {
+		t.Errorf("output should start with the index; got:\n%s\nwant prefix:\n%s", out, want)
+	}
+}
@@ -0,0 +1,432 @@
+package cb2md
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// errBinaryContent is returned by renderFile, without writing anything, for a file whose
+// content looks binary.
+var errBinaryContent = errors.New("binary file, contents omitted")
+
+// errDataBlob is returned by renderFile, with s.opts.SkipDataBlobs, for a file whose
+// content looks like encoded data.
+var errDataBlob = errors.New("data blob, contents omitted")
+
+// mimeTypeError is returned by renderFile, with s.opts.MIMEDetect, for a file whose
+// sniffed MIME type isn't text/* or allowed. It counts as errBinaryContent.
+type mimeTypeError struct {
+	mimeType string
+}
+
+func (e *mimeTypeError) Error() string { return e.mimeType + " file, contents omitted" }
+
+func (e *mimeTypeError) Unwrap() error { return errBinaryContent }
+
+// tooLargeError is returned by renderFile for a file larger than s.opts.MaxFileSize, whether
+// it was when stat-ed or only grew past it by the time it's read, size being how large it
+// was last seen to be. Whatever was written of it then is cut short, to be dropped.
+type tooLargeError struct {
+	size int64
+}
+
+func (e *tooLargeError) Error() string {
+	return fmt.Sprintf("file too large (%s), contents omitted", formatSize(e.size))
+}
+
+// sizeMismatchError is returned by sizeCheckReader.check for a file of which significantly more
+// or fewer bytes were read than its size says, as happens with pseudo-files like those in
+// /proc, or files written to while being read.
+type sizeMismatchError struct {
+	size, read int64
+}
+
+func (e *sizeMismatchError) Error() string {
+	return fmt.Sprintf("read %d bytes, but the file's size is %d", e.read, e.size)
+}
+
+// sizeCheckReader passes reads through from r, counting the bytes read to check them
+// against size, what the file's stat reports.
+type sizeCheckReader struct {
+	r          io.Reader
+	size, read int64
+}
+
+func (c *sizeCheckReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	return n, err
+}
+
+// check returns a *sizeMismatchError if the bytes read so far, all of the file once it's
+// been read to the end, differ from size by more than a tenth of it.
+func (c *sizeCheckReader) check() error {
+	if diff := c.read - c.size; diff > c.size/10 || -diff > c.size/10 {
+		return &sizeMismatchError{size: c.size, read: c.read}
+	}
+	return nil
+}
+
+// renderFile writes the content of the file at relative path fpath (as configured by the
+// options) to w, counting it into stats. Content that is too large (a *tooLargeError),
+// looks binary (unless s.opts.IncludeBinary is set; with s.opts.MIMEDetect, has a sniffed
+// MIME type that isn't allowed) or like a data blob (with s.opts.SkipDataBlobs) isn't
+// written; that error, errBinaryContent (possibly a *mimeTypeError) or errDataBlob is
+// returned instead. A file whose size doesn't match what was read is written, but a
+// *sizeMismatchError returned to note it; with s.opts.SkipSizeMismatch, what was written
+// of it is to be dropped. If digest isn't nil, the whole file is read through it, however
+// much of it is written.
+func (s *scan) renderFile(w io.Writer, fpath, language string, stats *contentStats, digest *fileDigest) error {
+	size := s.fileSize(fpath)
+	if digest == nil && s.opts.MaxFileSize > 0 && size > s.opts.MaxFileSize {
+		return &tooLargeError{size}
+	}
+
+	rc, err := s.openContent(fpath)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	var raw io.Reader = rc
+	if digest != nil {
+		raw = io.TeeReader(rc, digest)
+		defer digest.finish(raw)
+	}
+
+	// The file may have changed since the walk: go by its size now
+	f, onDisk := rc.(fs.File)
+	if onDisk {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		size = info.Size()
+		if s.opts.MaxFileSize > 0 && size > s.opts.MaxFileSize {
+			return &tooLargeError{size}
+		}
+	}
+
+	// It may still grow past the limit as it's read: read no more than a byte over it, which
+	// tells it did
+	src := raw
+	var limited *io.LimitedReader
+	if s.opts.MaxFileSize > 0 {
+		limited = &io.LimitedReader{R: raw, N: s.opts.MaxFileSize + 1}
+		src = limited
+	}
+	tooLarge := func() bool { return limited != nil && limited.N == 0 }
+
+	// Count what's read of files from disk, to check that their size adds up, unless only a
+	// preview is wanted
+	var checked *sizeCheckReader
+	if onDisk && s.opts.Preview <= 0 {
+		checked = &sizeCheckReader{r: src, size: size}
+		src = checked
+	}
+
+	// A short file can't fill the sample; Peek returns what there is
+	r := bufio.NewReaderSize(src, binarySampleSize)
+	sample, _ := r.Peek(binarySampleSize)
+	switch {
+	case s.opts.IncludeBinary:
+	case s.opts.MIMEDetect:
+		if mimeType := sniffMIMEType(sample); !s.mimeAllowed(mimeType) {
+			return &mimeTypeError{mimeType}
+		}
+	case looksBinary(sample):
+		return errBinaryContent
+	}
+	if s.opts.SkipDataBlobs && looksLikeDataBlob(sample) {
+		return errDataBlob
+	}
+
+	// Cut the content down to the matching lines, if asked to
+	var content io.Reader = r
+	if s.opts.MatchLines && s.contentMatch != nil {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		excerpt := matchExcerpt(data, s.contentMatch, s.opts.MatchContext)
+		content, size = bytes.NewReader(excerpt), int64(len(excerpt))
+	}
+
+	// Content that only turns out too large, or of the wrong size, as it's streamed isn't counted
+	counter := &charCounter{}
+	err = printContent(content, size, language, io.MultiWriter(w, counter), s.opts)
+	if tooLarge() {
+		return &tooLargeError{s.opts.MaxFileSize + 1}
+	}
+	if err == nil && checked != nil {
+		err = checked.check()
+		var sizeErr *sizeMismatchError
+		if errors.As(err, &sizeErr) && s.opts.SkipSizeMismatch {
+			return err
+		}
+	}
+	stats.add(fpath, language, counter)
+	return err
+}
+
+// omittedReason returns why the contents of a file are left out of the output when
+// rendering them failed with err, e.g. "binary file", or "" if they're dumped all the same.
+// Every -format goes by it.
+func (s *scan) omittedReason(err error) string {
+	var (
+		largeErr *tooLargeError
+		mimeErr  *mimeTypeError
+		sizeErr  *sizeMismatchError
+	)
+	switch {
+	case errors.As(err, &largeErr):
+		return fmt.Sprintf("file too large (%s)", formatSize(largeErr.size))
+	case errors.As(err, &sizeErr) && s.opts.SkipSizeMismatch:
+		return fmt.Sprintf("size mismatch (%v)", sizeErr)
+	case errors.As(err, &mimeErr):
+		return mimeErr.mimeType + " file"
+	case errors.Is(err, errBinaryContent):
+		return "binary file"
+	case errors.Is(err, errDataBlob):
+		return "encoded data (base64-like)"
+	}
+	return ""
+}
+
+// openContent opens the content of the file at relative path fpath: from disk, or as it
+// was at s.opts.ContentRef in git.
+func (s *scan) openContent(fpath string) (io.ReadCloser, error) {
+	if s.opts.ContentRef != "" {
+		root, rel := s.locate(fpath)
+		data, err := gitShow(root, s.opts.ContentRef, rel)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return s.openFile(s.absPath(fpath))
+}
+
+// osOpen opens a file for reading; tests replace it to watch the files being opened.
+var osOpen = func(name string) (fs.File, error) { return os.Open(name) }
+
+// openFile opens the file at path for reading. With opts.MaxOpen, it waits until fewer than
+// that many files are open, and the file's slot is freed when it's closed.
+func (s *scan) openFile(path string) (fs.File, error) {
+	if s.openSlots == nil {
+		return osOpen(path)
+	}
+	s.openSlots <- struct{}{}
+	f, err := osOpen(path)
+	if err != nil {
+		<-s.openSlots
+		return nil, err
+	}
+	return &slotFile{File: f, slots: s.openSlots}, nil
+}
+
+// slotFile is a file opened in one of a scan's openSlots, freed by the first Close.
+type slotFile struct {
+	fs.File
+	slots chan struct{}
+	once  sync.Once
+}
+
+func (f *slotFile) Close() error {
+	err := f.File.Close()
+	f.once.Do(func() { <-f.slots })
+	return err
+}
+
+// fileDigest counts the lines of a file written through it and, if hash isn't nil,
+// hashes it.
+type fileDigest struct {
+	hash     hash.Hash
+	newlines int
+	last     byte
+	read     bool
+	failed   bool
+}
+
+func (d *fileDigest) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		d.newlines += bytes.Count(p, []byte("\n"))
+		d.last, d.read = p[len(p)-1], true
+	}
+	if d.hash != nil {
+		d.hash.Write(p)
+	}
+	return len(p), nil
+}
+
+// finish reads the rest of r, the file being digested, through d.
+func (d *fileDigest) finish(r io.Reader) {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		d.failed = true
+	}
+}
+
+// sum returns the hex hash of the file, or "" if it isn't hashed or couldn't be read to
+// the end.
+func (d *fileDigest) sum() string {
+	if d.hash == nil || d.failed {
+		return ""
+	}
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// lines returns the number of lines written through d, as countLines counts them, or 0 if
+// the file couldn't be read to the end.
+func (d *fileDigest) lines() int {
+	if d.failed {
+		return 0
+	}
+	if d.read && d.last != '\n' {
+		return d.newlines + 1
+	}
+	return d.newlines
+}
+
+// digestFile reads the whole file at relative path fpath through digest, without rendering it.
+func (s *scan) digestFile(fpath string, digest *fileDigest) {
+	rc, err := s.openContent(fpath)
+	if err != nil {
+		digest.failed = true
+		return
+	}
+	defer rc.Close()
+	digest.finish(io.TeeReader(rc, digest))
+}
+
+// renderedFile is a file's content, rendered ahead of being written out, if it was
+// (hasContent), and the number of lines in the file as a whole and its hash, if counted
+// and hashed.
+type renderedFile struct {
+	content    []byte
+	err        error
+	hasContent bool
+	lines      int
+	hash       string
+}
+
+// readFiles reads the files up front, into s.rendered, when there's a reason to: rendering
+// files that get a section in the output with more than one of s.opts.Jobs workers, which
+// holds the whole dump in memory until it's written, or hashing every file in the tree at
+// root for s.opts.TreeJSON, which fills in the nodes' Hash. With s.opts.HeadingMeta, their
+// line counts are taken as they're read. Each file is read once, counted and hashed as
+// it's rendered; a file whose contents aren't dumped is only read to count or hash it.
+// With a single worker, nothing is rendered up front: files are rendered one at a time as
+// they're written (see fileLines), and only the line counts a table of contents needs
+// before any file, and the hashes, take a pass of their own, which keeps no contents.
+// Files noted in the tree, like symlinks out of the root, aren't read, and files that
+// can't be read are left without a hash. Each worker counts into its own stats, merged
+// into s.stats at the end.
+func (s *scan) readFiles(root *Node, files []string) {
+	opts := s.opts
+	s.rendered = make(map[string]renderedFile)
+	dumped := opts.Markdown && !opts.TreeOnly && !opts.ListOnly
+	render := dumped && opts.Jobs > 1
+	needLines := dumped && opts.HeadingMeta && opts.Format == "md" && (render || opts.TOC || opts.TOCDepth > 0)
+	hashes := opts.TreeJSON != ""
+	if !hashes && !render && !needLines {
+		return
+	}
+
+	// Hex previews are cheap, written directly, and show no line count
+	type job struct {
+		fpath  string
+		render bool
+	}
+	var jobs []job
+	queued := make(map[string]bool)
+	for _, fpath := range files {
+		switch {
+		case !dumped || s.contentSkipped[fpath]:
+			continue
+		case s.filtered[fpath]:
+			// Placeholders are written directly, but their headings count lines too
+			if !needLines {
+				continue
+			}
+			jobs = append(jobs, job{fpath, false})
+		case !render && !needLines:
+			// Left for the hashing below
+			continue
+		default:
+			jobs = append(jobs, job{fpath, render})
+		}
+		queued[fpath] = true
+	}
+
+	// The rest of the files in the tree only need hashing
+	nodes := make(map[string]*Node)
+	if hashes {
+		var walk func(node *Node, relPath string)
+		walk = func(node *Node, relPath string) {
+			for _, child := range node.Children {
+				childPath := filepath.Join(relPath, child.Name)
+				switch {
+				case child.IsDir:
+					walk(child, childPath)
+				case child.Note == "":
+					nodes[childPath] = child
+					if !queued[childPath] {
+						jobs = append(jobs, job{childPath, false})
+					}
+				}
+			}
+		}
+		walk(root, "")
+	}
+
+	results := make([]renderedFile, len(jobs))
+	next := make(chan int)
+	workerStats := make([]*contentStats, max(opts.Jobs, 1))
+	var wg sync.WaitGroup
+	for i := range workerStats {
+		stats := newContentStats()
+		workerStats[i] = stats
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range next {
+				digest := &fileDigest{}
+				if hashes {
+					digest.hash = sha256.New()
+				}
+				if !jobs[j].render {
+					s.digestFile(jobs[j].fpath, digest)
+					results[j] = renderedFile{lines: digest.lines(), hash: digest.sum()}
+					continue
+				}
+				var buf bytes.Buffer
+				err := s.renderFile(&buf, jobs[j].fpath, s.fileLanguage(jobs[j].fpath), stats, digest)
+				results[j] = renderedFile{content: buf.Bytes(), err: err, hasContent: true, lines: digest.lines(), hash: digest.sum()}
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, stats := range workerStats {
+		s.stats.merge(stats)
+	}
+	for i, j := range jobs {
+		s.rendered[j.fpath] = results[i]
+	}
+	for fpath, node := range nodes {
+		node.Hash = s.rendered[fpath].hash
+	}
+}
@@ -0,0 +1,471 @@
+package cb2md
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestConcurrentStats checks that counting with -jobs workers gives the same totals (and the
+// same output) as the sequential path. Run with -race to check the workers don't share counters.
+func TestConcurrentStats(t *testing.T) {
+	tmp := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 60; i++ {
+		ext := []string{".go", ".py", ".md", ".txt"}[i%4]
+		files[fmt.Sprintf("dir%d/file%02d%s", i%5, i, ext)] = strings.Repeat(fmt.Sprintf("line %d é\n", i), i+1)
+	}
+	writeFiles(t, tmp, files)
+
+	var seqOut, parOut strings.Builder
+	seq, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, Jobs: 1}, &seqOut)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	par, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, Jobs: 8}, &parOut)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	if !reflect.DeepEqual(par.stats, seq.stats) {
+		t.Errorf("concurrent stats %v differ from sequential %v", par.stats.tokensByLanguage, seq.stats.tokensByLanguage)
+	}
+	if len(seq.stats.tokensByLanguage) != 4 {
+		t.Errorf("expected 4 languages counted, got %v", seq.stats.tokensByLanguage)
+	}
+	if parOut.String() != seqOut.String() {
+		t.Errorf("concurrent output differs from sequential output")
+	}
+}
+
+// countingFile is a file opened through osOpen in TestMaxOpen, counted as open until closed.
+type countingFile struct {
+	fs.File
+	open *atomic.Int32
+}
+
+func (f countingFile) Close() error {
+	f.open.Add(-1)
+	return f.File.Close()
+}
+
+// TestMaxOpen checks that -jobs workers keep no more than MaxOpen files open at once, and
+// that the output is the same as without the limit.
+func TestMaxOpen(t *testing.T) {
+	tmp := t.TempDir()
+	files := make(map[string]string)
+	for i := range 40 {
+		files[fmt.Sprintf("file%02d.go", i)] = strings.Repeat("package p\n", 200)
+	}
+	writeFiles(t, tmp, files)
+
+	var open, peak atomic.Int32
+	defer func(orig func(string) (fs.File, error)) { osOpen = orig }(osOpen)
+	osOpen = func(name string) (fs.File, error) {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		n := open.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(time.Millisecond) // give the other workers a chance to open theirs
+		return countingFile{f, &open}, nil
+	}
+
+	var limited, unlimited strings.Builder
+	opts := Options{IgnoreFile: ".ignore", Markdown: true, Jobs: 8, TreeJSON: filepath.Join(t.TempDir(), "tree.json")}
+	if _, err := run(tmp, opts, &unlimited); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	peak.Store(0)
+	opts.MaxOpen = 3
+	if _, err := run(tmp, opts, &limited); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if got := peak.Load(); got > 3 || got == 0 {
+		t.Errorf("%d files were open at once; want between 1 and 3", got)
+	}
+	if open.Load() != 0 {
+		t.Errorf("%d files were left open", open.Load())
+	}
+	if limited.String() != unlimited.String() {
+		t.Errorf("output with -max-open differs from the output without")
+	}
+}
+
+// TestReadFilesOnce checks that with HeadingMeta and TreeJSON, each file is only read once
+// by -jobs workers, for the line count in its heading (in the table of contents too) and
+// its hash as well as its contents: the whole file's count, though only a preview is
+// shown. A single worker takes a streaming pass for those first, and reads each file
+// again as it's written.
+func TestReadFilesOnce(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a.go":   "package a\n",
+		"b/c.py": strings.Repeat("x = 1\n", 100),
+	})
+
+	var mu sync.Mutex
+	opens := make(map[string]int)
+	defer func(orig func(string) (fs.File, error)) { osOpen = orig }(osOpen)
+	osOpen = func(name string) (fs.File, error) {
+		mu.Lock()
+		opens[filepath.Base(name)]++
+		mu.Unlock()
+		return os.Open(name)
+	}
+
+	for jobs, reads := range map[int]int{1: 2, 4: 1} {
+		clear(opens)
+		var buf strings.Builder
+		opts := Options{IgnoreFile: ".ignore", Markdown: true, HeadingMeta: true, TOC: true, Preview: 20, Jobs: jobs,
+			TreeJSON: filepath.Join(t.TempDir(), "tree.json")}
+		if _, err := run(tmp, opts, &buf); err != nil {
+			t.Fatalf("run error: %v", err)
+		}
+		if want := map[string]int{"a.go": reads, "c.py": reads}; !reflect.DeepEqual(opens, want) {
+			t.Errorf("jobs=%d: files opened %v times; want %d each", jobs, opens, reads)
+		}
+		if !strings.Contains(buf.String(), "### b/c.py (600 B, 100 lines)\n") {
+			t.Errorf("jobs=%d: expected c.py's whole line count in its heading:\n%s", jobs, buf.String())
+		}
+		tree, err := ReadTreeJSON(opts.TreeJSON)
+		if err != nil {
+			t.Fatalf("ReadTreeJSON failed: %v", err)
+		}
+		sum := sha256.Sum256([]byte(strings.Repeat("x = 1\n", 100)))
+		if got := treeFiles(tree)["b/c.py"]; got != hex.EncodeToString(sum[:]) {
+			t.Errorf("jobs=%d: c.py hashed as %q, not its whole content", jobs, got)
+		}
+	}
+}
+
+// TestHeadingMetaStreams checks that with a single worker, HeadingMeta doesn't render the
+// files up front: each is read once, as it's written, and isn't kept afterwards.
+func TestHeadingMetaStreams(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a.go":   "package a\n",
+		"b/c.py": strings.Repeat("x = 1\n", 100),
+	})
+
+	opens := make(map[string]int)
+	defer func(orig func(string) (fs.File, error)) { osOpen = orig }(osOpen)
+	osOpen = func(name string) (fs.File, error) {
+		opens[filepath.Base(name)]++
+		return os.Open(name)
+	}
+
+	var buf strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, HeadingMeta: true, Jobs: 1}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := map[string]int{"a.go": 1, "c.py": 1}; !reflect.DeepEqual(opens, want) {
+		t.Errorf("files opened %v times; want once each", opens)
+	}
+	if !strings.Contains(buf.String(), "### b/c.py (600 B, 100 lines)\n") {
+		t.Errorf("expected c.py's line count in its heading:\n%s", buf.String())
+	}
+	for fpath, r := range s.rendered {
+		if r.hasContent {
+			t.Errorf("%s's contents were kept after being written", fpath)
+		}
+	}
+}
+
+// TestShebangReadOnce checks that the shebang line of a file whose name doesn't tell its
+// language is read once, however many features ask for the language.
+func TestShebangReadOnce(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{"run": "#!/usr/bin/env python3\nprint(1)\n"})
+
+	var mu sync.Mutex
+	opens := 0
+	defer func(orig func(string) (fs.File, error)) { osOpen = orig }(osOpen)
+	osOpen = func(name string) (fs.File, error) {
+		if filepath.Base(name) == "run" {
+			mu.Lock()
+			opens++
+			mu.Unlock()
+		}
+		return os.Open(name)
+	}
+
+	opts := Options{IgnoreFile: ".ignore", Markdown: true, SkipUnknownLang: true, Legend: true, MatrixIndex: true, Jobs: 4}
+	out := runOutput(t, tmp, opts)
+	if !strings.Contains(out, "```python\n") {
+		t.Errorf("expected run as python:\n%s", out)
+	}
+	// Once for the shebang, once for the content
+	if opens != 2 {
+		t.Errorf("run opened %d times; want 2", opens)
+	}
+}
+
+// TestConcurrentOutput checks that files whose contents are left out, for whatever reason,
+// get the same notes, in the same order, when rendered by -jobs workers.
+func TestConcurrentOutput(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a.go":        "package a\n",
+		"b.bin":       "\x00\x01\x02binary",
+		"c/large.txt": strings.Repeat("large\n", 500),
+		"c/small.txt": "small\n",
+	})
+
+	opts := Options{IgnoreFile: ".ignore", Markdown: true, MaxFileSize: 1024}
+	var seqOut, parOut strings.Builder
+	opts.Jobs = 1
+	if _, err := run(tmp, opts, &seqOut); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	opts.Jobs = 4
+	if _, err := run(tmp, opts, &parOut); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	if parOut.String() != seqOut.String() {
+		t.Errorf("concurrent output differs from sequential output:\n%s\nwant:\n%s", parOut.String(), seqOut.String())
+	}
+	for _, note := range []string{"_binary file, contents omitted_", "_file too large (2.9 KB), contents omitted_"} {
+		if !strings.Contains(seqOut.String(), note) {
+			t.Errorf("output missing %q:\n%s", note, seqOut.String())
+		}
+	}
+}
+
+// TestMaxFileSizeGrown checks that a file that grows past -max-file-size between the walk
+// and its rendering is still left out, with and without -jobs workers.
+func TestMaxFileSizeGrown(t *testing.T) {
+	for _, jobs := range []int{1, 4} {
+		tmp := t.TempDir()
+		writeFiles(t, tmp, map[string]string{
+			"a.go":     "package a\n",
+			"grow.txt": "small\n",
+		})
+
+		opts := Options{IgnoreFile: ".ignore", Markdown: true, MaxFileSize: 1024, Jobs: jobs}
+		got := runChangedAfterWalk(t, tmp, opts, map[string]string{"grow.txt": strings.Repeat("grown\n", 500)})
+		if !strings.Contains(got, "### grow.txt\n_file too large (2.9 KB), contents omitted_\n") {
+			t.Errorf("jobs=%d: grown file not left out:\n%s", jobs, got)
+		}
+		if strings.Contains(got, "grown") {
+			t.Errorf("jobs=%d: output has the grown file's content:\n%s", jobs, got)
+		}
+		if !strings.Contains(got, "package a") {
+			t.Errorf("jobs=%d: output missing a.go:\n%s", jobs, got)
+		}
+	}
+}
+
+// runChangedAfterWalk is run, but with files (as for writeFiles) written in dir after the
+// tree is built, before the output is.
+func runChangedAfterWalk(t *testing.T, dir string, opts Options, files map[string]string) string {
+	t.Helper()
+	s, err := newScan(dir, opts)
+	if err != nil {
+		t.Fatalf("newScan error: %v", err)
+	}
+	root, err := s.buildRootTree(s.loadRules())
+	if err != nil {
+		t.Fatalf("buildRootTree error: %v", err)
+	}
+	writeFiles(t, dir, files)
+
+	var buf strings.Builder
+	if err := s.write(root, nil, &buf); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	return buf.String()
+}
+
+// sizedFS is an fs.FS whose files report the sizes given instead of their own, like the
+// pseudo-files of /proc.
+type sizedFS struct {
+	fstest.MapFS
+	sizes map[string]int64
+}
+
+func (fsys sizedFS) Open(name string) (fs.File, error) {
+	f, err := fsys.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if size, ok := fsys.sizes[name]; ok {
+		return sizedFile{File: f, size: size}, nil
+	}
+	return f, nil
+}
+
+type sizedFile struct {
+	fs.File
+	size int64
+}
+
+func (f sizedFile) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	return sizedInfo{FileInfo: info, size: f.size}, err
+}
+
+type sizedInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i sizedInfo) Size() int64 { return i.size }
+
+// TestSizeCheckReader checks that reading a file whose size is far off from the bytes read
+// gets them all, but a *sizeMismatchError from the check, while small differences are let
+// through.
+func TestSizeCheckReader(t *testing.T) {
+	content := strings.Repeat("x", 100)
+	fsys := sizedFS{
+		MapFS: fstest.MapFS{
+			"exact.txt":  {Data: []byte(content)},
+			"close.txt":  {Data: []byte(content)},
+			"proc.txt":   {Data: []byte(content)},
+			"shrunk.txt": {Data: []byte(content)},
+		},
+		sizes: map[string]int64{"close.txt": 105, "proc.txt": 0, "shrunk.txt": 4096},
+	}
+
+	tests := []struct {
+		name         string
+		wantMismatch bool
+	}{
+		{"exact.txt", false},
+		{"close.txt", false},
+		{"proc.txt", true},
+		{"shrunk.txt", true},
+	}
+	for _, tt := range tests {
+		f, err := fsys.Open(tt.name)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		checked := &sizeCheckReader{r: f, size: info.Size()}
+		data, err := io.ReadAll(checked)
+		f.Close()
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		if string(data) != content {
+			t.Errorf("%s: got %d bytes, want all %d", tt.name, len(data), len(content))
+		}
+		err = checked.check()
+		var sizeErr *sizeMismatchError
+		if got := errors.As(err, &sizeErr); got != tt.wantMismatch {
+			t.Errorf("%s: got error %v; want a size mismatch: %v", tt.name, err, tt.wantMismatch)
+		}
+	}
+}
+
+// TestSkipSizeMismatch checks that a /proc file, whose size is 0 however much it holds,
+// gets a warning above its contents, and with -skip-size-mismatch, a note instead of them.
+func TestSkipSizeMismatch(t *testing.T) {
+	if _, err := os.Stat("/proc/version"); err != nil {
+		t.Skip("no /proc/version to read")
+	}
+	tmp := t.TempDir()
+	if err := os.Symlink("/proc/version", filepath.Join(tmp, "version")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	var buf strings.Builder
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, FollowOutside: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Linux") || !strings.Contains(buf.String(), "### version\n> ⚠️ Size mismatch (read ") ||
+		!strings.Contains(buf.String(), "bytes, but the file's size is 0)\n\n```\n") {
+		t.Errorf("expected the contents with a size warning:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, FollowOutside: true, SkipSizeMismatch: true}, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if strings.Contains(buf.String(), "Linux") || !strings.Contains(buf.String(), "### version\n_size mismatch (read ") {
+		t.Errorf("expected the contents to be omitted:\n%s", buf.String())
+	}
+}
+
+// writeBenchTree writes a synthetic tree for benchmarks: 500 files named file000.ext and
+// on, spread over 25 directories pkg00 to pkg24, the i-th holding content(i). It returns
+// the tree's root.
+func writeBenchTree(b *testing.B, ext string, content func(i int) string) string {
+	b.Helper()
+	tmp := b.TempDir()
+	for i := 0; i < 500; i++ {
+		path := filepath.Join(tmp, fmt.Sprintf("pkg%02d", i%25), fmt.Sprintf("file%03d.%s", i, ext))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			b.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content(i)), 0o644); err != nil {
+			b.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	return tmp
+}
+
+// BenchmarkRenderContents compares reading and rendering a synthetic tree of files one at
+// a time and with a worker per CPU (at least two).
+func BenchmarkRenderContents(b *testing.B) {
+	tmp := writeBenchTree(b, "go", func(i int) string {
+		return fmt.Sprintf("package pkg%02d\n\n", i%25) + strings.Repeat(fmt.Sprintf("func f%d() int { return %d }\n", i, i), 50)
+	})
+
+	for _, jobs := range []int{1, max(2, runtime.NumCPU())} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, Jobs: jobs}, io.Discard); err != nil {
+					b.Fatalf("run error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// TestOmittedReasonFormats checks that every -format gives the same reason for leaving out
+// a file's contents.
+func TestOmittedReasonFormats(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"big.txt":  strings.Repeat("x", 2048),
+		"blob.txt": strings.Repeat("QUJDZGVmZ2hpSktMbW5vcFFSU3R1dnd4WVphYmNkRUZHaGlqa0xNTk9wcXJzVFVWd3h5ejAxMjM0NTY3ODk=\n", 10),
+	})
+
+	opts := Options{IgnoreFile: ".ignore", Markdown: true, MaxFileSize: 1024, SkipDataBlobs: true}
+	wants := map[string][]string{
+		"md":   {"_file too large (2.0 KB), contents omitted_", "_encoded data (base64-like), contents omitted_"},
+		"xml":  {`omitted="file too large (2.0 KB)"`, `omitted="encoded data (base64-like)"`},
+		"json": {`"omitted":"file too large (2.0 KB)"`, `"omitted":"encoded data (base64-like)"`},
+	}
+	for format, want := range wants {
+		opts.Format = format
+		got := runOutput(t, tmp, opts)
+		for _, w := range want {
+			if !strings.Contains(got, w) {
+				t.Errorf("-format=%s output should contain %q:\n%s", format, w, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package cb2md
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// RunRoots is like Run, for any number of root directories. Each root gets a section of
+// its own, with a heading, its tree and its files, or, with opts.MergeRoots, they are all
+// combined into one tree below a synthetic root. Either way, the paths of the files start
+// with the name of their root, so files with the same path in different roots stay apart.
+func RunRoots(roots []string, opts Options, w io.Writer) error {
+	switch {
+	case len(roots) == 0:
+		return fmt.Errorf("no directory to scan")
+	case len(roots) == 1 && !opts.MergeRoots:
+		return Run(roots[0], opts, w)
+	}
+	_, err := runRoots(roots, opts, w)
+	return err
+}
+
+// runRoots does the work of RunRoots for several roots. Each root is walked by a scan of
+// its own, with its own ignore files and visited directories, and the results are merged
+// into a scan whose paths start with the name of their root.
+func runRoots(roots []string, opts Options, stdout io.Writer) (*scan, error) {
+	if opts.FromFile != "" || opts.Explain || opts.TestPattern != "" {
+		return nil, fmt.Errorf("-from-file, -explain and -test-pattern only work on a single directory")
+	}
+
+	merged, err := newScan(roots[0], opts)
+	if err != nil {
+		return nil, err
+	}
+	merged.mounts = make(map[string]string)
+	merged.sections = !opts.MergeRoots
+
+	top := &Node{Name: ".", IsDir: true}
+	for _, root := range roots {
+		s, err := newScan(root, opts)
+		if err != nil {
+			return nil, err
+		}
+		if s.onlyFiles != nil {
+			s.onlyDirs = parentDirs(s.onlyFiles)
+		}
+		node, err := s.buildRootTree(s.loadRules())
+		if err != nil {
+			return nil, fmt.Errorf("error building tree of '%s': %w", root, err)
+		}
+
+		// Roots with the same directory name get a numbered suffix
+		name := node.Name
+		for n := 2; merged.mounts[name] != ""; n++ {
+			name = fmt.Sprintf("%s-%d", node.Name, n)
+		}
+		node.Name = name
+		merged.mounts[name] = s.root
+
+		// A single file is mounted as itself, so its path is just its name
+		join := func(name, f string) string { return filepath.Join(name, f) }
+		if s.file != "" {
+			merged.mounts[name] = filepath.Join(s.root, s.file)
+			join = func(name, _ string) string { return name }
+		}
+
+		for _, f := range s.included {
+			merged.included = append(merged.included, join(name, f))
+		}
+		for f := range s.contentSkipped {
+			merged.contentSkipped[join(name, f)] = true
+		}
+		for f := range s.filtered {
+			merged.filtered[join(name, f)] = true
+		}
+		for f, info := range s.fileInfos {
+			merged.fileInfos[join(name, f)] = info
+		}
+		for f, language := range s.shebangLanguages {
+			merged.shebangLanguages[join(name, f)] = language
+		}
+		merged.dirCount += s.dirCount
+		merged.dirsSkipped += s.dirsSkipped
+		merged.filesIgnored += s.filesIgnored
+
+		top.Children = append(top.Children, node)
+		top.Size += node.Size
+		top.FileCount += node.FileCount
+		if node.ModTime.After(top.ModTime) {
+			top.ModTime = node.ModTime
+		}
+	}
+	return merged, merged.write(top, nil, stdout)
+}
+
+// filesUnder returns the files among files below the directory dir.
+func filesUnder(files []string, dir string) []string {
+	var under []string
+	for _, f := range files {
+		if strings.HasPrefix(f, dir+string(filepath.Separator)) {
+			under = append(under, f)
+		}
+	}
+	return under
+}
@@ -0,0 +1,114 @@
+package cb2md
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMergeRoots checks that two roots end up as children of one synthetic root, with
+// one Full File List whose paths are prefixed with their root's name.
+func TestMergeRoots(t *testing.T) {
+	base := t.TempDir()
+	backend, frontend := filepath.Join(base, "backend"), filepath.Join(base, "frontend")
+	writeFiles(t, backend, map[string]string{
+		".ignore":   "*.log\n",
+		"config.go": "package backend\n",
+		"debug.log": "x\n",
+	})
+	writeFiles(t, frontend, map[string]string{
+		"config.go":  "package frontend\n",
+		"src/app.ts": "export {}\n",
+	})
+
+	var buf strings.Builder
+	s, err := runRoots([]string{backend, frontend}, Options{IgnoreFile: ".ignore", Markdown: true, MergeRoots: true}, &buf)
+	if err != nil {
+		t.Fatalf("runRoots error: %v", err)
+	}
+
+	want := []string{filepath.Join("backend", "config.go"), filepath.Join("frontend", "config.go"), filepath.Join("frontend", "src", "app.ts")}
+	if !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+
+	got := buf.String()
+	wantTree := "└── .\n" +
+		"    ├── backend\n" +
+		"    │   └── config.go\n" +
+		"    └── frontend\n" +
+		"        ├── config.go\n" +
+		"        └── src\n" +
+		"            └── app.ts\n"
+	if !strings.HasPrefix(got, wantTree) {
+		t.Errorf("expected one merged tree; got:\n%s\nwant prefix:\n%s", got, wantTree)
+	}
+	if strings.Count(got, "## Full File List") != 1 {
+		t.Errorf("expected a single Full File List:\n%s", got)
+	}
+	for root, content := range map[string]string{"backend": "package backend\n", "frontend": "package frontend\n"} {
+		want := "### " + filepath.Join(root, "config.go") + "\n```go\n" + content
+		if !strings.Contains(got, want) {
+			t.Errorf("output should contain %q:\n%s", want, got)
+		}
+	}
+}
+
+// TestMergeRootsSameName checks that roots with the same directory name are told apart.
+func TestMergeRootsSameName(t *testing.T) {
+	base := t.TempDir()
+	a, b := filepath.Join(base, "a", "src"), filepath.Join(base, "b", "src")
+	writeFiles(t, a, map[string]string{"main.go": "package a\n"})
+	writeFiles(t, b, map[string]string{"main.go": "package b\n"})
+
+	var buf strings.Builder
+	if err := RunRoots([]string{a, b}, Options{IgnoreFile: ".ignore", Markdown: true, MergeRoots: true}, &buf); err != nil {
+		t.Fatalf("RunRoots error: %v", err)
+	}
+	for _, want := range []string{"package a\n", "package b\n", "├── src\n", "└── src-2\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output should contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+// TestMultipleRoots checks that each root gets a section with its own tree and files, and
+// that files with the same name in different roots are both dumped, from the right root.
+func TestMultipleRoots(t *testing.T) {
+	backend, frontend := t.TempDir(), t.TempDir()
+	writeFiles(t, backend, map[string]string{
+		"config.go": "package backend\n",
+		"db/db.go":  "package db\n",
+	})
+	writeFiles(t, frontend, map[string]string{
+		"config.go": "package frontend\n",
+	})
+	bName, fName := filepath.Base(backend), filepath.Base(frontend)
+
+	var buf strings.Builder
+	s, err := runRoots([]string{backend, frontend}, Options{IgnoreFile: ".ignore", Markdown: true}, &buf)
+	if err != nil {
+		t.Fatalf("runRoots error: %v", err)
+	}
+	if len(s.included) != 3 {
+		t.Errorf("expected 3 included files, got %v", s.included)
+	}
+
+	want := "# " + bName + "\n\n" +
+		"└── " + bName + "\n" +
+		"    ├── config.go\n" +
+		"    └── db\n" +
+		"        └── db.go\n" +
+		"\n## Full File List\n\n" +
+		"### " + filepath.Join(bName, "config.go") + "\n```go\npackage backend\n```\n\n" +
+		"### " + filepath.Join(bName, "db", "db.go") + "\n```go\npackage db\n```\n\n" +
+		"# " + fName + "\n\n" +
+		"└── " + fName + "\n" +
+		"    └── config.go\n" +
+		"\n## Full File List\n\n" +
+		"### " + filepath.Join(fName, "config.go") + "\n```go\npackage frontend\n```\n\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
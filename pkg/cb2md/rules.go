@@ -0,0 +1,253 @@
+package cb2md
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ruleAction is what a matching rule does to a path.
+type ruleAction int
+
+const (
+	actionNone        ruleAction = iota // no rule matched: the file is included
+	actionInclude                       // "!pattern": undo an exclusion or skip-content rule from a lower level
+	actionExclude                       // leave the path out of the tree and the file list
+	actionSkipContent                   // show the path in the tree, but not in the file list
+)
+
+func (a ruleAction) String() string {
+	switch a {
+	case actionInclude:
+		return "include"
+	case actionExclude:
+		return "ignore"
+	case actionSkipContent:
+		return "skip-content"
+	}
+	return "none"
+}
+
+// rule is a single pattern from any source, normalized for the unified matcher.
+type rule struct {
+	source  string // where the pattern came from, e.g. "defaults", ".ignore", "-ignore-pattern", "src/.gitignore"
+	pattern string // the pattern as written
+	action  ruleAction
+	match   func(relPath string, isDir bool) bool
+}
+
+// ruleSet holds every rule in precedence order, lowest first:
+//
+//  1. the built-in skip-content defaults, and -skip-content patterns,
+//  2. .gitignore files (with -gitignore), shallowest to deepest,
+//  3. the -ignore file and the -cb2mdignore file, followed by the ignore files of the same
+//     name as the -ignore file in subdirectories, shallowest to deepest,
+//  4. inline -ignore-pattern flags.
+//
+// The last matching rule decides, so each level overrides the ones before it, and a
+// "!pattern" at a higher level re-includes whatever a lower level excluded or skipped.
+type ruleSet struct {
+	defaults     []rule
+	git          []rule // grows as the walk enters directories with their own .gitignore
+	ignore       []rule // grows as the walk enters directories with their own ignore file
+	inline       []rule
+	useGitignore bool
+	ignoreName   string // name of the per-directory ignore files, or "" for none
+}
+
+// layers returns the rule layers, lowest precedence first.
+func (rs ruleSet) layers() [][]rule {
+	return [][]rule{rs.defaults, rs.git, rs.ignore, rs.inline}
+}
+
+// decide returns the action for relPath along with the rule that decided it (nil if none matched).
+func (rs ruleSet) decide(relPath string, isDir bool) (ruleAction, *rule) {
+	action, decider := actionNone, (*rule)(nil)
+	for _, layer := range rs.layers() {
+		for i := range layer {
+			if layer[i].match(relPath, isDir) {
+				action, decider = layer[i].action, &layer[i]
+			}
+		}
+	}
+	return action, decider
+}
+
+// matching returns every rule that matches relPath, in precedence order.
+func (rs ruleSet) matching(relPath string, isDir bool) []rule {
+	var matched []rule
+	for _, layer := range rs.layers() {
+		for _, r := range layer {
+			if r.match(relPath, isDir) {
+				matched = append(matched, r)
+			}
+		}
+	}
+	return matched
+}
+
+// enter returns the rules that apply inside the directory at relDir (absDir on disk, "" for
+// the root): rs plus the directory's own .gitignore (with -gitignore) and ignore file. The
+// root's ignore file is part of rs from the start, so it isn't added again.
+func (rs ruleSet) enter(absDir, relDir string) ruleSet {
+	if rs.useGitignore {
+		if local := loadGitignore(absDir, relDir); len(local) > 0 {
+			rs = rs.withGitignore(local, filepath.Join(relDir, ".gitignore"))
+		}
+	}
+	if rs.ignoreName != "" && relDir != "" {
+		if local := loadIgnorePatterns(filepath.Join(absDir, rs.ignoreName)); len(local) > 0 {
+			rs = rs.withIgnore(ignoreRules(local, relDir, filepath.Join(relDir, rs.ignoreName)))
+		}
+	}
+	return rs
+}
+
+// withIgnore returns a copy of rs with rules appended to the ignore layer, leaving rs (still
+// used by sibling directories) untouched.
+func (rs ruleSet) withIgnore(rules []rule) ruleSet {
+	ignore := make([]rule, len(rs.ignore), len(rs.ignore)+len(rules))
+	copy(ignore, rs.ignore)
+	rs.ignore = append(ignore, rules...)
+	return rs
+}
+
+// withGitignore returns a copy of rs with .gitignore rules appended to the git layer,
+// leaving rs (still used by sibling directories) untouched.
+func (rs ruleSet) withGitignore(local []gitignoreRule, source string) ruleSet {
+	git := make([]rule, len(rs.git), len(rs.git)+len(local))
+	copy(git, rs.git)
+	for _, gr := range local {
+		r := rule{source: source, pattern: gr.line, action: actionExclude, match: gr.matches}
+		if gr.negate {
+			r.action = actionInclude
+		}
+		git = append(git, r)
+	}
+	rs.git = git
+	return rs
+}
+
+// skipContentRules turns skip-content patterns (case-insensitive, base name only) into rules.
+func skipContentRules(patterns []string, source string) []rule {
+	var rules []rule
+	for _, p := range patterns {
+		rules = append(rules, rule{
+			source:  source,
+			pattern: p,
+			action:  actionSkipContent,
+			match: func(relPath string, _ bool) bool {
+				return matchesAnySkipContent(relPath, []string{p})
+			},
+		})
+	}
+	return rules
+}
+
+// unknownLanguageRule skips the content of files whose language can't be told, by language
+// (a scan's fileLanguage, which looks at shebang lines too), which are likely data or
+// binary files.
+func unknownLanguageRule(source string, language func(relPath string) string) rule {
+	return rule{
+		source:  source,
+		pattern: "(unknown language)",
+		action:  actionSkipContent,
+		match: func(relPath string, isDir bool) bool {
+			return !isDir && language(relPath) == ""
+		},
+	}
+}
+
+// ignoreRules turns .ignore-style patterns (full relative path, case-sensitive) into rules.
+// A leading "!" makes the pattern re-include instead of exclude, and a trailing "/" makes it
+// match only directories (and so everything below them). Patterns from an ignore file
+// in a subdirectory only apply below base (that directory), and are relative to it.
+func ignoreRules(patterns []string, base, source string) []rule {
+	var rules []rule
+	for _, p := range patterns {
+		glob, action := p, actionExclude
+		if strings.HasPrefix(p, "!") {
+			glob, action = p[1:], actionInclude
+		}
+		dir, dirOnly := strings.CutSuffix(filepath.ToSlash(glob), "/")
+		rules = append(rules, rule{
+			source:  source,
+			pattern: p,
+			action:  action,
+			match: func(relPath string, isDir bool) bool {
+				if base != "" {
+					rest, ok := strings.CutPrefix(relPath, base+string(filepath.Separator))
+					if !ok {
+						return false
+					}
+					relPath = rest
+				}
+				return dirOnly && isDir && matchGlob(dir, relPath) || matchesAnyPattern(relPath, []string{glob})
+			},
+		})
+	}
+	return rules
+}
+
+// findParentIgnoreFile looks for an ignore file called name in the directories above
+// root, nearest first, up to the root of the git repository root is in (if any). It
+// returns the file's path, and root's path relative to the file's directory, which the
+// file's patterns are written against; or "" if there's no such file.
+func findParentIgnoreFile(root, name string) (path, prefix string) {
+	for dir := root; !pathExists(filepath.Join(dir, ".git")); {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+		if candidate := filepath.Join(dir, name); pathExists(candidate) {
+			prefix, err := filepath.Rel(dir, root)
+			if err != nil {
+				return "", ""
+			}
+			return candidate, prefix
+		}
+	}
+	return "", ""
+}
+
+// pathExists reports whether anything exists at path.
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// parentIgnoreRules is ignoreRules for an ignore file found above the scanned root: its
+// patterns are matched against paths relative to its own directory, which the scanned
+// paths get by being prefixed with prefix, the root's path from there.
+func parentIgnoreRules(patterns []string, prefix, source string) []rule {
+	rules := ignoreRules(patterns, "", source)
+	for i := range rules {
+		match := rules[i].match
+		rules[i].match = func(relPath string, isDir bool) bool {
+			return match(filepath.Join(prefix, relPath), isDir)
+		}
+	}
+	return rules
+}
+
+// printRuleSet lists the effective rules in precedence order (lowest first), followed by the
+// ignore files found in subdirectories, whose rules only apply within them.
+func printRuleSet(w io.Writer, rs ruleSet, nestedFiles []string) {
+	fmt.Fprintln(w, "Effective rules, lowest precedence first (the last matching rule wins):")
+	n := 0
+	for _, layer := range rs.layers() {
+		for _, r := range layer {
+			n++
+			fmt.Fprintf(w, "%3d. %-12s %-24q (%s)\n", n, r.action, r.pattern, r.source)
+		}
+	}
+	if len(nestedFiles) > 0 {
+		fmt.Fprintln(w, "Nested ignore files, applied within their own directories:")
+		for _, f := range nestedFiles {
+			fmt.Fprintf(w, "     %s\n", f)
+		}
+	}
+}
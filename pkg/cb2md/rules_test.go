@@ -0,0 +1,236 @@
+package cb2md
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestInlineNegationOverridesIgnoreFile checks that an inline "!pattern" re-includes what the ignore file excludes.
+func TestInlineNegationOverridesIgnoreFile(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		".ignore":   "*.log\n",
+		"debug.log": "x\n",
+		"keep.log":  "x\n",
+		"main.go":   "package main\n",
+	})
+
+	opts := Options{IgnoreFile: ".ignore", Markdown: true, IgnorePatterns: []string{"!keep.log"}, ListOnly: true}
+	s, err := run(tmp, opts, io.Discard)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := []string{"keep.log", "main.go"}; !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+}
+
+// TestNestedIgnoreFile checks that an ignore file in a subdirectory applies only below it,
+// relative to it, on top of the root's patterns.
+func TestNestedIgnoreFile(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		".ignore":           "**/*.log\n",
+		"src/.ignore":       "*.tmp\ngen\n",
+		"src/a.tmp":         "x\n",
+		"src/debug.log":     "x\n",
+		"src/main.go":       "package main\n",
+		"src/gen/out.go":    "package gen\n",
+		"src/pkg/gen/in.go": "package gen\n",
+		"lib/b.tmp":         "x\n",
+		"lib/gen/lib.go":    "package gen\n",
+	})
+
+	opts := Options{IgnoreFile: ".ignore", Markdown: true, ListOnly: true}
+	s, err := run(tmp, opts, io.Discard)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	want := []string{"lib/b.tmp", "lib/gen/lib.go", "src/main.go", "src/pkg/gen/in.go"}
+	if !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+}
+
+// TestParentIgnoreFile checks that without an ignore file of its own, the scan picks up one
+// from a parent directory, whose patterns are relative to that directory, not the root.
+func TestParentIgnoreFile(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		".ignore":               "main.go\nservices/api/src\nservices/api/*.log\n",
+		"main.go":               "package main\n",
+		"services/api/main.go":  "package main\n",
+		"services/api/api.log":  "x\n",
+		"services/api/src/a.go": "package src\n",
+		"services/api/lib/b.go": "package lib\n",
+	})
+
+	s, err := run(filepath.Join(tmp, "services", "api"), Options{IgnoreFile: ".ignore", Markdown: true, ListOnly: true}, io.Discard)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	// main.go is the parent's own, not services/api/main.go
+	want := []string{filepath.Join("lib", "b.go"), "main.go"}
+	if !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+
+	// The search stops at the root of a git repository
+	writeFiles(t, tmp, map[string]string{"services/.git/HEAD": "ref: refs/heads/main\n"})
+	s, err = run(filepath.Join(tmp, "services", "api"), Options{IgnoreFile: ".ignore", Markdown: true, ListOnly: true}, io.Discard)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if len(s.included) != 4 {
+		t.Errorf("expected the parent ignore file outside the repository to be ignored, got %v", s.included)
+	}
+}
+
+// TestCb2mdIgnoreFile checks that the patterns of .cb2mdignore are merged with those of
+// the -ignore file, coming after them, and that the file itself stays out of the tree.
+func TestCb2mdIgnoreFile(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		".ignore":      "*.log\n*.tmp\n",
+		".cb2mdignore": "*.log\n!keep.tmp\nsecret.txt\n",
+		"main.go":      "package main\n",
+		"debug.log":    "ignored by both\n",
+		"cache.tmp":    "ignored by .ignore\n",
+		"keep.tmp":     "re-included by .cb2mdignore\n",
+		"secret.txt":   "ignored by .cb2mdignore\n",
+	})
+
+	var buf strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Cb2mdIgnoreFile: ".cb2mdignore", IncludeHidden: true}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := []string{"keep.tmp", "main.go"}; !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+	if strings.Contains(buf.String(), ".cb2mdignore") {
+		t.Errorf(".cb2mdignore should be left out of the tree:\n%s", buf.String())
+	}
+
+	// Without it, only .ignore applies
+	s, err = run(tmp, Options{IgnoreFile: ".ignore"}, io.Discard)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := []string{"main.go", "secret.txt"}; !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+}
+
+// TestRuleSetPrecedence checks that higher levels override lower ones, in both directions.
+func TestRuleSetPrecedence(t *testing.T) {
+	rs := ruleSet{
+		defaults: skipContentRules([]string{"*.png"}, "defaults"),
+		git: []rule{
+			{source: ".gitignore", pattern: "*.tmp", action: actionExclude, match: func(p string, _ bool) bool { return strings.HasSuffix(p, ".tmp") }},
+		},
+		ignore: ignoreRules([]string{"!keep.tmp", "secret.png"}, "", ".ignore"),
+		inline: ignoreRules([]string{"!logo.png"}, "", "-ignore-pattern"),
+	}
+
+	tests := []struct {
+		path string
+		want ruleAction
+	}{
+		{"photo.png", actionSkipContent}, // defaults only
+		{"logo.png", actionInclude},      // inline negation beats the default
+		{"secret.png", actionExclude},    // the ignore file beats the default
+		{"junk.tmp", actionExclude},      // .gitignore only
+		{"keep.tmp", actionInclude},      // the ignore file's negation beats .gitignore
+		{"main.go", actionNone},
+	}
+	for _, tt := range tests {
+		if got, _ := rs.decide(tt.path, false); got != tt.want {
+			t.Errorf("decide(%q) = %v; want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestExplainRuleSet checks that -explain lists every rule with its source, lowest precedence first.
+func TestExplainRuleSet(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{".ignore": "*.log\n"})
+
+	var buf strings.Builder
+	opts := Options{IgnoreFile: ".ignore", IgnorePatterns: []string{"!keep.log"}, Explain: true}
+	if _, err := run(tmp, opts, &buf); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got := buf.String()
+
+	defaults := strings.Index(got, `"package-lock.json"`)
+	file := strings.Index(got, `"*.log"`)
+	inline := strings.Index(got, `"!keep.log"`)
+	if defaults < 0 || file < 0 || inline < 0 || !(defaults < file && file < inline) {
+		t.Errorf("expected defaults, then .ignore, then inline rules:\n%s", got)
+	}
+	if !strings.Contains(got, "(-ignore-pattern)") || !strings.Contains(got, "(.ignore)") {
+		t.Errorf("expected rule sources in output:\n%s", got)
+	}
+}
+
+// TestSkipUnknownLang checks that -skip-unknown-lang keeps unknown files in the tree but dumps only known languages,
+// including scripts known by their shebang line.
+func TestSkipUnknownLang(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"data.xyz":   "???\n",
+		"main.go":    "package main\n",
+		"bin/deploy": "#!/usr/bin/env python3\nprint('hi')\n",
+	})
+
+	var buf strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, SkipUnknownLang: true}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := []string{filepath.Join("bin", "deploy"), "main.go"}; !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+	if !s.contentSkipped["data.xyz"] {
+		t.Errorf("data.xyz should be content-skipped")
+	}
+	if !strings.Contains(buf.String(), "data.xyz") || strings.Contains(buf.String(), "### data.xyz") {
+		t.Errorf("data.xyz should be in the tree only; got:\n%s", buf.String())
+	}
+}
+
+// TestSkipContentPatterns checks that -skip-content adds to the built-in patterns, with the
+// same case-insensitive base-name matching, and that -skip-content-only replaces them.
+func TestSkipContentPatterns(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"web/vendor.min.js": "var a=1;\n",
+		"web/APP.MIN.JS":    "var b=2;\n",
+		"web/app.js":        "let c = 3;\n",
+		"logo.png":          "png",
+	})
+
+	var buf strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, SkipContent: []string{"*.min.js"}}, &buf)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := []string{filepath.Join("web", "app.js")}; !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files got %v, want %v", s.included, want)
+	}
+	if !strings.Contains(buf.String(), "vendor.min.js\n") || strings.Contains(buf.String(), "var a=1") {
+		t.Errorf("vendor.min.js should be in the tree only; got:\n%s", buf.String())
+	}
+
+	s, err = run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, SkipContent: []string{"*.min.js"}, SkipContentOnly: true}, new(strings.Builder))
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if want := []string{"logo.png", filepath.Join("web", "app.js")}; !reflect.DeepEqual(s.included, want) {
+		t.Errorf("included files with SkipContentOnly got %v, want %v", s.included, want)
+	}
+}
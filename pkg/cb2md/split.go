@@ -0,0 +1,274 @@
+package cb2md
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// splitPart is one output file of a split dump: every included file below a directory.
+type splitPart struct {
+	Key   string   // directory the part covers, e.g. "services/api"
+	File  string   // output file name, relative to the index file's directory
+	Files []string // included files in this part
+}
+
+// splitKey returns the directory a file belongs to when splitting at depth:
+// the first depth components of its directory, or fewer if the file sits higher up.
+// Files directly in the root get the empty key.
+func splitKey(relPath string, depth int) string {
+	dir := filepath.ToSlash(filepath.Dir(relPath))
+	if dir == "." {
+		return ""
+	}
+	segs := strings.Split(dir, "/")
+	if len(segs) > depth {
+		segs = segs[:depth]
+	}
+	return strings.Join(segs, "/")
+}
+
+// splitPartName builds the file name for a part, e.g. "tree.md" + "services/api" -> "tree.services-api.md".
+func splitPartName(outFile, key string) string {
+	ext := filepath.Ext(outFile)
+	base := strings.TrimSuffix(filepath.Base(outFile), ext)
+	return base + "." + strings.ReplaceAll(key, "/", "-") + ext
+}
+
+// isSplitPartFile reports whether absPath is a part file splitPartName would produce for
+// absOutFile, so re-running over a directory containing old parts doesn't dump them. With
+// depth 0 (-split-tokens, -split-size) parts are "partN"; otherwise the key must name a
+// directory of root at most depth levels down (or, with merged roots, of its parent).
+func isSplitPartFile(absPath, absOutFile, root string, depth int) bool {
+	if filepath.Dir(absPath) != filepath.Dir(absOutFile) {
+		return false
+	}
+	ext := filepath.Ext(absOutFile)
+	base := strings.TrimSuffix(filepath.Base(absOutFile), ext)
+	key, ok := strings.CutPrefix(filepath.Base(absPath), base+".")
+	if !ok {
+		return false
+	}
+	key, ok = strings.CutSuffix(key, ext)
+	if !ok || key == "" {
+		return false
+	}
+	if depth == 0 {
+		n, ok := strings.CutPrefix(key, "part")
+		return ok && n != "" && strings.Trim(n, "0123456789") == ""
+	}
+	return isDirKey(root, key, depth) || isDirKey(filepath.Dir(root), key, depth)
+}
+
+// isDirKey reports whether key, a directory path with "/" replaced by "-", names a directory
+// under dir at most depth levels down. Directory names may contain "-" themselves, so every
+// split point is tried.
+func isDirKey(dir, key string, depth int) bool {
+	if depth == 0 {
+		return false
+	}
+	for i := 0; i <= len(key); i++ {
+		if i < len(key) && key[i] != '-' {
+			continue
+		}
+		name := key[:i]
+		if name == "" || name == "." || name == ".." {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		if i == len(key) || isDirKey(filepath.Join(dir, name), key[i+1:], depth-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupSplitParts distributes files into parts by their split key, ordered so that each
+// directory comes before the directories nested inside it. Files in the root get no part.
+func groupSplitParts(files []string, depth int, outFile string) (parts []*splitPart, rootFiles []string) {
+	byKey := make(map[string]*splitPart)
+	for _, f := range files {
+		key := splitKey(f, depth)
+		if key == "" {
+			rootFiles = append(rootFiles, f)
+			continue
+		}
+		p, ok := byKey[key]
+		if !ok {
+			p = &splitPart{Key: key}
+			byKey[key] = p
+			parts = append(parts, p)
+		}
+		p.Files = append(p.Files, f)
+	}
+
+	// Compare component by component, so "a/b" sorts right after "a" rather than after "a-x"
+	sort.Slice(parts, func(i, j int) bool {
+		return lessPathSegments(strings.Split(parts[i].Key, "/"), strings.Split(parts[j].Key, "/"))
+	})
+
+	// Name the parts, keeping names unique if two keys flatten to the same string
+	used := make(map[string]bool)
+	for _, p := range parts {
+		name := splitPartName(outFile, p.Key)
+		for n := 2; used[name]; n++ {
+			name = splitPartName(outFile, fmt.Sprintf("%s-%d", p.Key, n))
+		}
+		used[name] = true
+		p.File = name
+	}
+	return parts, rootFiles
+}
+
+// lessPathSegments orders two paths given as segments, parents before children.
+func lessPathSegments(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// printSplitIndex prints a nested list linking to each part, mirroring the directory hierarchy.
+func printSplitIndex(w io.Writer, parts []*splitPart) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "## Parts")
+	fmt.Fprintln(w)
+
+	listed := make(map[string]bool)
+	for _, p := range parts {
+		segs := strings.Split(p.Key, "/")
+		// Print intermediate directories that have no part of their own
+		for i := 1; i < len(segs); i++ {
+			dir := strings.Join(segs[:i], "/")
+			if !listed[dir] {
+				listed[dir] = true
+				fmt.Fprintf(w, "%s- %s/\n", strings.Repeat("  ", i-1), segs[i-1])
+			}
+		}
+		listed[p.Key] = true
+		unit := "files"
+		if len(p.Files) == 1 {
+			unit = "file"
+		}
+		fmt.Fprintf(w, "%s- [%s/](%s) (%d %s)\n", strings.Repeat("  ", len(segs)-1), segs[len(segs)-1], p.File, len(p.Files), unit)
+	}
+}
+
+// writeSplitOutput writes the tree and an index of parts to opts.OutFile, plus one part file
+// per directory at opts.SplitDepth holding the file list for everything below it.
+// Files directly in the root are listed in the index file itself.
+func (s *scan) writeSplitOutput(rootNode *Node, files []string) error {
+	opts := s.opts
+	parts, rootFiles := groupSplitParts(files, opts.SplitDepth, opts.OutFile)
+	outDir := filepath.Dir(opts.OutFile)
+
+	for _, p := range parts {
+		partPath := filepath.Join(outDir, p.File)
+		if err := s.writeFile(partPath, func(w io.Writer) {
+			fmt.Fprintf(w, "# %s/\n", p.Key)
+			if opts.SplitContext {
+				if crumb := breadcrumbTree(rootNode, p.Key); crumb != nil {
+					fmt.Fprintln(w)
+					fmt.Fprintln(w, "```")
+					printTree(crumb, "", true, w, opts)
+					fmt.Fprintln(w, "```")
+				}
+			}
+			s.printFileList(w, p.Files)
+		}); err != nil {
+			return fmt.Errorf("error writing part '%s': %w", partPath, err)
+		}
+	}
+
+	return s.writeFile(opts.OutFile, func(w io.Writer) {
+		if opts.RepoHeader {
+			s.printRepoHeader(w, rootNode, files)
+		}
+		if opts.Legend {
+			s.printLegend(w, files)
+		}
+		if opts.Format == "xml" {
+			printTreeXML(w, rootNode, opts)
+		} else {
+			fmt.Fprintln(w, "```")
+			printTree(rootNode, "", true, w, opts)
+			fmt.Fprintln(w, "```")
+		}
+		printSplitIndex(w, parts)
+		if len(rootFiles) > 0 {
+			s.printFileList(w, rootFiles)
+		}
+		if opts.ImportGraph {
+			fmt.Fprintln(w)
+			printImportGraph(w, s.buildImportGraph(s.included), s.included)
+		}
+		if opts.Stats && opts.Markdown && opts.Format != "xml" {
+			s.printStats(w, true)
+		}
+	})
+}
+
+// breadcrumbTree returns a copy of the path from root down to the directory at key,
+// keeping only the ancestors on the way and marking the directory itself, with its
+// whole subtree below it. It returns nil if key isn't in the tree.
+func breadcrumbTree(root *Node, key string) *Node {
+	crumb := &Node{Name: root.Name, IsDir: true, Size: root.Size}
+	parent, node := crumb, root
+	for _, seg := range strings.Split(key, "/") {
+		var next *Node
+		for _, child := range node.Children {
+			if child.IsDir && child.Name == seg {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+
+		copied := *node
+		copied.Children = nil
+		parent.Children = []*Node{&copied}
+		parent = &copied
+	}
+
+	parent.Name += " (you are here)"
+	parent.Children = node.Children
+	return crumb
+}
+
+// writeFile creates (or truncates) path and fills it using write, applying the same
+// output transformations as the main output. With -validate, the content is checked
+// first, and the file not written if it isn't well-formed Markdown.
+func (s *scan) writeFile(path string, write func(w io.Writer)) error {
+	if s.opts.Validate {
+		var buf bytes.Buffer
+		write(&buf)
+		if err := validateMarkdown(buf.Bytes()); err != nil {
+			return fmt.Errorf("invalid Markdown output, not written: %w", err)
+		}
+		write = func(w io.Writer) { fmt.Fprintf(w, "%s", buf.Bytes()) }
+	}
+
+	f, err := createOutputFile(path)
+	if err != nil {
+		return err
+	}
+	w, flush := wrapOutput(io.MultiWriter(f, &s.output), s.opts)
+	write(w)
+	if err := flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,163 @@
+package cb2md
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSplitDepth checks that -split-depth=2 writes one part per second-level directory plus an index.
+func TestSplitDepth(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "repo")
+	writeFiles(t, root, map[string]string{
+		"root.go":          "package root\n",
+		"a/top.go":         "package a\n",
+		"a/x/one.go":       "package x\n",
+		"a/x/deep/two.go":  "package deep\n",
+		"a/y/three.go":     "package y\n",
+		"b/z/four.go":      "package z\n",
+		"b/z/deep/five.go": "package deep\n",
+	})
+
+	outDir := filepath.Join(tmp, "out")
+	if err := os.Mkdir(outDir, 0o755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	outFile := filepath.Join(outDir, "tree.md")
+	if _, err := run(root, Options{IgnoreFile: ".ignore", Markdown: true, OutFile: outFile, SplitDepth: 2}, os.Stdout); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	parts, err := filepath.Glob(filepath.Join(outDir, "tree.*.md"))
+	if err != nil {
+		t.Fatalf("Glob failed: %v", err)
+	}
+	// a (for a/top.go), a/x, a/y and b/z
+	if len(parts) != 4 {
+		t.Fatalf("expected 4 part files, got %d: %v", len(parts), parts)
+	}
+
+	part, err := os.ReadFile(filepath.Join(outDir, "tree.a-x.md"))
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	for _, want := range []string{"# a/x/", filepath.Join("a", "x", "one.go"), filepath.Join("a", "x", "deep", "two.go")} {
+		if !strings.Contains(string(part), want) {
+			t.Errorf("part a/x missing %q:\n%s", want, part)
+		}
+	}
+
+	index, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	wantIndex := "## Parts\n\n" +
+		"- [a/](tree.a.md) (1 file)\n" +
+		"  - [x/](tree.a-x.md) (2 files)\n" +
+		"  - [y/](tree.a-y.md) (1 file)\n" +
+		"- b/\n" +
+		"  - [z/](tree.b-z.md) (2 files)\n"
+	if !strings.Contains(string(index), wantIndex) {
+		t.Errorf("index missing hierarchical part list:\n%s", index)
+	}
+	if !strings.Contains(string(index), "### root.go") {
+		t.Errorf("expected root-level files in the index file:\n%s", index)
+	}
+}
+
+// TestSplitKey checks which directory a file is assigned to for a given depth.
+func TestSplitKey(t *testing.T) {
+	tests := []struct {
+		relPath string
+		depth   int
+		want    string
+	}{
+		{"main.go", 2, ""},
+		{"a/main.go", 2, "a"},
+		{"a/b/main.go", 2, "a/b"},
+		{"a/b/c/main.go", 2, "a/b"},
+		{"a/b/c/main.go", 1, "a"},
+	}
+	for _, tt := range tests {
+		if got := splitKey(filepath.FromSlash(tt.relPath), tt.depth); got != tt.want {
+			t.Errorf("splitKey(%q, %d) = %q; want %q", tt.relPath, tt.depth, got, tt.want)
+		}
+	}
+}
+
+// TestIsSplitPartFile checks that only names splitPartName could have generated count as parts.
+func TestIsSplitPartFile(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "repo")
+	writeFiles(t, root, map[string]string{
+		"a/b/main.go":   "package b\n",
+		"my-dir/x.go":   "package x\n",
+		"tree.md":       "",
+		"tree.notes.md": "",
+	})
+	outFile := filepath.Join(root, "tree.md")
+
+	tests := []struct {
+		name  string
+		depth int
+		want  bool
+	}{
+		{"tree.a.md", 2, true},
+		{"tree.a-b.md", 2, true},
+		{"tree.a-b.md", 1, false},
+		{"tree.my-dir.md", 2, true},
+		{"tree.repo-a.md", 2, true}, // merged roots prefix keys with the root's name
+		{"tree.notes.md", 2, false},
+		{"tree..md", 2, false},
+		{"tree.a.txt", 2, false},
+		{"tree.part3.md", 0, true},
+		{"tree.partx.md", 0, false},
+		{"tree.part.md", 0, false},
+		{"tree.a.md", 0, false},
+	}
+	for _, tt := range tests {
+		if got := isSplitPartFile(filepath.Join(root, tt.name), outFile, root, tt.depth); got != tt.want {
+			t.Errorf("isSplitPartFile(%q, depth %d) = %v; want %v", tt.name, tt.depth, got, tt.want)
+		}
+	}
+}
+
+// TestSplitContext checks that each part starts with a breadcrumb tree locating it within the repository.
+func TestSplitContext(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "repo")
+	writeFiles(t, root, map[string]string{
+		"root.go":         "package root\n",
+		"a/top.go":        "package a\n",
+		"a/x/one.go":      "package x\n",
+		"a/x/deep/two.go": "package deep\n",
+		"b/z/four.go":     "package z\n",
+	})
+
+	outFile := filepath.Join(tmp, "tree.md")
+	opts := Options{IgnoreFile: ".ignore", Markdown: true, OutFile: outFile, SplitDepth: 2, SplitContext: true}
+	if _, err := run(root, opts, os.Stdout); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	part, err := os.ReadFile(filepath.Join(tmp, "tree.a-x.md"))
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	want := "```\n" +
+		"└── repo\n" +
+		"    └── a\n" +
+		"        └── x (you are here)\n" +
+		"            ├── deep\n" +
+		"            │   └── two.go\n" +
+		"            └── one.go\n" +
+		"```\n"
+	if !strings.Contains(string(part), want) {
+		t.Errorf("part a/x missing breadcrumb:\n%s\nwant:\n%s", part, want)
+	}
+	if strings.Contains(string(part), "top.go") || strings.Contains(string(part), "└── b") {
+		t.Errorf("breadcrumb should only show the part's ancestors and subtree:\n%s", part)
+	}
+}
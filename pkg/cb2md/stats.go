@@ -0,0 +1,98 @@
+package cb2md
+
+import (
+	"fmt"
+	"io"
+)
+
+// contentStats accumulates counts over the dumped file contents. When files are rendered
+// concurrently each worker keeps its own contentStats, and they are merged once all
+// workers are done, so counting never needs locking.
+type contentStats struct {
+	// tokensByLanguage holds the estimated tokens per language from guessLanguage ("" for unknown).
+	tokensByLanguage map[string]int
+
+	// tokensByFile holds the estimated tokens per file, keyed by relative path.
+	tokensByFile map[string]int
+
+	// wordsByLanguage and wordsByFile hold the whitespace-separated words, likewise.
+	wordsByLanguage map[string]int
+	wordsByFile     map[string]int
+
+	// filesByLanguage counts the files dumped per language, and lines and bytes their content.
+	filesByLanguage map[string]int
+	lines, bytes    int
+}
+
+func newContentStats() *contentStats {
+	return &contentStats{
+		tokensByLanguage: make(map[string]int),
+		tokensByFile:     make(map[string]int),
+		wordsByLanguage:  make(map[string]int),
+		wordsByFile:      make(map[string]int),
+		filesByLanguage:  make(map[string]int),
+	}
+}
+
+// add counts the content of the file at fpath, as measured by c.
+func (cs *contentStats) add(fpath, language string, c *charCounter) {
+	n := c.tokens()
+	cs.tokensByLanguage[language] += n
+	cs.tokensByFile[fpath] += n
+	cs.wordsByLanguage[language] += c.words
+	cs.wordsByFile[fpath] += c.words
+	cs.filesByLanguage[language]++
+	cs.lines += c.lines
+	cs.bytes += c.bytes
+}
+
+// merge adds the counts of other to cs.
+func (cs *contentStats) merge(other *contentStats) {
+	for lang, n := range other.tokensByLanguage {
+		cs.tokensByLanguage[lang] += n
+	}
+	for f, n := range other.tokensByFile {
+		cs.tokensByFile[f] += n
+	}
+	for lang, n := range other.wordsByLanguage {
+		cs.wordsByLanguage[lang] += n
+	}
+	for f, n := range other.wordsByFile {
+		cs.wordsByFile[f] += n
+	}
+	for lang, n := range other.filesByLanguage {
+		cs.filesByLanguage[lang] += n
+	}
+	cs.lines += other.lines
+	cs.bytes += other.bytes
+}
+
+// printStats prints a summary of what was scanned and dumped: the directories scanned,
+// the files included and skipped (left out by the ignore rules, or shown in the tree
+// only), and the lines and bytes of the dumped contents, with the files per language.
+// As a Markdown section, it gets a heading of its own.
+func (s *scan) printStats(w io.Writer, markdown bool) {
+	inTreeOnly := len(s.fileInfos) - len(s.included)
+	if markdown {
+		fmt.Fprintln(w, "## Stats")
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "- Directories scanned: %d\n", s.dirCount)
+	fmt.Fprintf(w, "- Files included: %d\n", len(s.included))
+	fmt.Fprintf(w, "- Files skipped: %d (%d ignored, %d in the tree only)\n", s.filesIgnored+inTreeOnly, s.filesIgnored, inTreeOnly)
+	fmt.Fprintf(w, "- Lines: %d\n", s.stats.lines)
+	fmt.Fprintf(w, "- Bytes: %d (%s)\n", s.stats.bytes, formatSize(int64(s.stats.bytes)))
+	if len(s.stats.filesByLanguage) > 0 {
+		fmt.Fprintln(w, "- Files by language:")
+		for _, lang := range sortedByCount(s.stats.filesByLanguage) {
+			name := lang
+			if name == "" {
+				name = "(unknown)"
+			}
+			fmt.Fprintf(w, "  - %s: %d\n", name, s.stats.filesByLanguage[lang])
+		}
+	}
+	if markdown {
+		fmt.Fprintln(w)
+	}
+}
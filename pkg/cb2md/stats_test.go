@@ -0,0 +1,37 @@
+package cb2md
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestStats checks the counts of the -stats summary against a known tree: ignored files,
+// tree-only files and the lines, bytes and languages of the dumped ones.
+func TestStats(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		".ignore":         "**/*.log\nvendor\n",
+		"main.go":         "package main\n\nfunc main() {}\n", // 3 lines, 29 bytes
+		"util/util.go":    "package util\n",                   // 1 line, 13 bytes
+		"docs/README.md":  "# Docs\n\nHello.\n",               // 3 lines, 15 bytes
+		"docs/run.log":    "ignored\n",
+		"util/debug.log":  "ignored\n",
+		"vendor/x/x.go":   "package x\n",
+		"assets/logo.png": "\x89PNG\r\n",
+	})
+
+	out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, Stats: true})
+
+	want := "## Stats\n\n" +
+		"- Directories scanned: 4\n" +
+		"- Files included: 3\n" +
+		"- Files skipped: 3 (2 ignored, 1 in the tree only)\n" +
+		"- Lines: 7\n" +
+		"- Bytes: 57 (57 B)\n" +
+		"- Files by language:\n" +
+		"  - go: 2\n" +
+		"  - markdown: 1\n\n"
+	if got := out; !strings.HasSuffix(got, want) {
+		t.Errorf("output should end with the stats:\n%s\nwant suffix:\n%s", got, want)
+	}
+}
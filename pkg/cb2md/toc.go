@@ -0,0 +1,139 @@
+package cb2md
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// headingAnchor converts heading text into the anchor GitHub generates for it:
+// lowercased, spaces turned into hyphens, and punctuation other than "-" and "_" dropped.
+func headingAnchor(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r == ' ':
+			b.WriteRune('-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// tocHeading is the heading of the table of contents, which -back-to-top links point to.
+const tocHeading = "Table of Contents"
+
+// anchorSet hands out the anchors of a document's headings, in order, the way GitHub
+// does: a heading whose anchor is already taken gets "-1", "-2", ... appended.
+type anchorSet map[string]int
+
+// add returns the anchor of the next heading, text.
+func (a anchorSet) add(text string) string {
+	anchor := headingAnchor(text)
+	n, taken := a[anchor]
+	a[anchor] = n + 1
+	if !taken {
+		return anchor
+	}
+	return fmt.Sprintf("%s-%d", anchor, n)
+}
+
+// fileAnchors returns the anchor of each file's heading in the Full File List, taking the
+// headings before them into account.
+func (s *scan) fileAnchors(files []string) map[string]string {
+	seen := anchorSet{}
+	seen.add(tocHeading)
+	seen.add("Full File List")
+	anchors := make(map[string]string, len(files))
+	for _, f := range files {
+		anchors[f] = seen.add(s.fileHeading(f))
+	}
+	return anchors
+}
+
+// tocDir is a directory in the table of contents, with its files and subdirectories in order.
+type tocDir struct {
+	path  string
+	files []string
+	dirs  []*tocDir
+}
+
+// buildTOCTree groups files (already in output order) by directory.
+func buildTOCTree(files []string) *tocDir {
+	root := &tocDir{}
+	byPath := map[string]*tocDir{"": root}
+	for _, f := range files {
+		parent := root
+		dir := filepath.Dir(f)
+		if dir != "." {
+			segs := strings.Split(dir, string(filepath.Separator))
+			for i := range segs {
+				p := filepath.Join(segs[:i+1]...)
+				d, ok := byPath[p]
+				if !ok {
+					d = &tocDir{path: p}
+					byPath[p] = d
+					parent.dirs = append(parent.dirs, d)
+				}
+				parent = d
+			}
+		}
+		parent.files = append(parent.files, f)
+	}
+	return root
+}
+
+// allFiles returns the files in d and everything below it.
+func (d *tocDir) allFiles() []string {
+	files := append([]string(nil), d.files...)
+	for _, sub := range d.dirs {
+		files = append(files, sub.allFiles()...)
+	}
+	return files
+}
+
+// printTOC prints a table of contents linking to each file's heading, at the given
+// anchors. With maxDepth 0 it's a flat list of files; otherwise directories are expanded
+// down to maxDepth, and a directory at maxDepth becomes a collapsible block holding links
+// to every file below it, so huge trees stay navigable.
+func printTOC(w io.Writer, files []string, anchors map[string]string, maxDepth int) {
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "## %s\n", tocHeading)
+	fmt.Fprintln(w)
+	if maxDepth <= 0 {
+		for _, f := range files {
+			fmt.Fprintf(w, "- %s\n", tocLink(f, anchors))
+		}
+		return
+	}
+	printTOCDir(w, buildTOCTree(files), anchors, 0, maxDepth, "")
+}
+
+func printTOCDir(w io.Writer, d *tocDir, anchors map[string]string, depth, maxDepth int, indent string) {
+	for _, f := range d.files {
+		fmt.Fprintf(w, "%s- %s\n", indent, tocLink(f, anchors))
+	}
+	for _, sub := range d.dirs {
+		if depth+1 < maxDepth {
+			fmt.Fprintf(w, "%s- %s/\n", indent, sub.path)
+			printTOCDir(w, sub, anchors, depth+1, maxDepth, indent+"  ")
+			continue
+		}
+
+		// At the depth limit: collapse everything below into one block
+		files := sub.allFiles()
+		fmt.Fprintf(w, "%s- <details><summary>%s/ (%d files)</summary>\n\n", indent, sub.path, len(files))
+		for _, f := range files {
+			fmt.Fprintf(w, "%s  - %s\n", indent, tocLink(f, anchors))
+		}
+		fmt.Fprintf(w, "\n%s  </details>\n", indent)
+	}
+}
+
+// tocLink renders a Markdown link to a file's heading, at its anchor in anchors.
+func tocLink(path string, anchors map[string]string) string {
+	return fmt.Sprintf("[%s](#%s)", path, anchors[path])
+}
@@ -0,0 +1,133 @@
+package cb2md
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestHeadingAnchor checks GitHub-style anchors for file paths.
+func TestHeadingAnchor(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"main.go", "maingo"},
+		{"src/pkg/util.go", "srcpkgutilgo"},
+		{"My File_v2-final.md", "my-file_v2-finalmd"},
+		{"Docs/README.MD", "docsreadmemd"},
+		{"web/.eslintrc.json", "webeslintrcjson"},
+		{"a b/c.d.e", "a-bcde"},
+	}
+	for _, tt := range tests {
+		if got := headingAnchor(tt.text); got != tt.want {
+			t.Errorf("headingAnchor(%q) = %q; want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// TestTOCDepth checks that the TOC expands directories up to the limit and collapses files below it.
+func TestTOCDepth(t *testing.T) {
+	files := []string{
+		"main.go",
+		"src/app.go",
+		"src/pkg/a.go",
+		"src/pkg/deep/b.go",
+	}
+
+	var buf strings.Builder
+	printTOC(&buf, files, (&scan{}).fileAnchors(files), 2)
+	want := `
+## Table of Contents
+
+- [main.go](#maingo)
+- src/
+  - [src/app.go](#srcappgo)
+  - <details><summary>src/pkg/ (2 files)</summary>
+
+    - [src/pkg/a.go](#srcpkgago)
+    - [src/pkg/deep/b.go](#srcpkgdeepbgo)
+
+    </details>
+`
+	if buf.String() != want {
+		t.Errorf("TOC got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	if strings.Contains(buf.String(), "- src/pkg/deep/\n") {
+		t.Errorf("directories below the depth limit should not be expanded:\n%s", buf.String())
+	}
+}
+
+// TestAnchorSet checks that colliding anchors get numbered suffixes, like GitHub's.
+func TestAnchorSet(t *testing.T) {
+	seen := anchorSet{}
+	for _, tt := range []struct{ text, want string }{
+		{"ab.go", "abgo"},
+		{"a/b.go", "abgo-1"},
+		{"a.b.go", "abgo-2"},
+		{"abgo", "abgo-3"},
+		{"other.go", "othergo"},
+	} {
+		if got := seen.add(tt.text); got != tt.want {
+			t.Errorf("add(%q) = %q; want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// TestTOC checks that the flat TOC links every included file, in order, to its heading.
+func TestTOC(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"ab.go":         "package ab\n",
+		"a/b.go":        "package a\n",
+		"docs/guide.md": "# Guide\n",
+		"logo.png":      "\x89PNG",
+	})
+
+	out := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, TOC: true})
+	want := "## Table of Contents\n\n" +
+		"- [a/b.go](#abgo)\n" +
+		"- [ab.go](#abgo-1)\n" +
+		"- [docs/guide.md](#docsguidemd)\n" +
+		"\n## Full File List\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("output should contain the TOC %q:\n%s", want, out)
+	}
+}
+
+// TestBackToTop checks that -back-to-top ends every file's section, whatever its content,
+// with a link to the table of contents, and that it requires -toc.
+func TestBackToTop(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"a.go":     "package a\n",
+		"b.bin":    "\x00\x01binary",
+		"docs.md":  "# Docs\n",
+		"logo.png": "\x89PNG",
+	})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, TOC: true, BackToTop: true})
+	if !strings.Contains(got, "\n## Table of Contents\n") {
+		t.Fatalf("expected a table of contents:\n%s", got)
+	}
+	link := "[↑ back to top](#table-of-contents)\n\n"
+	for _, want := range []string{
+		"```go\npackage a\n```\n\n" + link + "### b.bin\n",
+		"_binary file, contents omitted_\n\n" + link + "### docs.md\n",
+		"```markdown\n# Docs\n```\n\n" + link,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, link); n != 3 {
+		t.Errorf("expected 3 back-to-top links, got %d:\n%s", n, got)
+	}
+	if !strings.HasSuffix(got, link) {
+		t.Errorf("the last file should end with a back-to-top link:\n%s", got)
+	}
+
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, BackToTop: true}, io.Discard); err == nil {
+		t.Errorf("expected an error for -back-to-top without -toc")
+	}
+}
@@ -0,0 +1,113 @@
+package cb2md
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// charCounter counts the UTF-8 characters, the words, the lines and the bytes written to it.
+type charCounter struct {
+	chars, words int
+	lines, bytes int
+	inWord       bool
+}
+
+func (c *charCounter) Write(p []byte) (int, error) {
+	c.bytes += len(p)
+	c.lines += bytes.Count(p, []byte("\n"))
+	for _, b := range p {
+		// Count every byte except UTF-8 continuation bytes, so characters split across writes count once
+		if b&0xC0 != 0x80 {
+			c.chars++
+		}
+		space := b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f' || b == '\v'
+		if !space && !c.inWord {
+			c.words++
+		}
+		c.inWord = !space
+	}
+	return len(p), nil
+}
+
+// tokens estimates the number of LLM tokens in what was written; see estimateTokens.
+func (c *charCounter) tokens() int {
+	return estimateTokens(c.chars, c.words)
+}
+
+// estimateTokens approximates the number of LLM tokens in a text of the given number of
+// characters and words, using the common rule of thumb of about four characters per
+// token. Prose made of many short words tokenizes worse than that, at about three tokens
+// per four words, so whichever estimate is higher wins.
+func estimateTokens(chars, words int) int {
+	return max((chars+3)/4, (words*4+2)/3)
+}
+
+// largestFilesShown is how many files the per-file breakdowns of the token and word
+// summaries list.
+const largestFilesShown = 20
+
+// printTokenSummary prints the estimated token total of the whole output, followed by
+// that of the file contents, by language and by file, largest first.
+func printTokenSummary(w io.Writer, stats *contentStats, outputTokens int) {
+	fmt.Fprintf(w, "Estimated tokens: %d\n", outputTokens)
+
+	total := 0
+	for _, n := range stats.tokensByFile {
+		total += n
+	}
+	fmt.Fprintf(w, "File contents: %d\n", total)
+	printCountBreakdown(w, "Largest files:", stats.tokensByLanguage, stats.tokensByFile)
+}
+
+// printWordSummary prints the number of words in the file contents, by language and by
+// file, most first.
+func printWordSummary(w io.Writer, stats *contentStats) {
+	total := 0
+	for _, n := range stats.wordsByFile {
+		total += n
+	}
+	fmt.Fprintf(w, "Words: %d\n", total)
+	printCountBreakdown(w, "Most words:", stats.wordsByLanguage, stats.wordsByFile)
+}
+
+// printCountBreakdown prints counts by language, then under title the files with the
+// highest counts, up to largestFilesShown of them.
+func printCountBreakdown(w io.Writer, title string, byLanguage, byFile map[string]int) {
+	for _, lang := range sortedByCount(byLanguage) {
+		name := lang
+		if name == "" {
+			name = "(unknown)"
+		}
+		fmt.Fprintf(w, "  %-12s %8d\n", name, byLanguage[lang])
+	}
+
+	files := sortedByCount(byFile)
+	if len(files) == 0 {
+		return
+	}
+	fmt.Fprintln(w, title)
+	for _, f := range files[:min(len(files), largestFilesShown)] {
+		fmt.Fprintf(w, "  %8d  %s\n", byFile[f], f)
+	}
+	if more := len(files) - largestFilesShown; more > 0 {
+		fmt.Fprintf(w, "  (%d more files)\n", more)
+	}
+}
+
+// sortedByCount returns the keys of counts, largest count first and then by name.
+func sortedByCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if counts[a] != counts[b] {
+			return counts[a] > counts[b]
+		}
+		return a < b
+	})
+	return keys
+}
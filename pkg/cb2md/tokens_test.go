@@ -0,0 +1,150 @@
+package cb2md
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEstimateTokens checks the token heuristic, including multi-byte characters and
+// word counting across writes.
+func TestEstimateTokens(t *testing.T) {
+	var c charCounter
+	fmt.Fprint(&c, "héllo wo")
+	fmt.Fprint(&c, "rld \xc3") // a character split across two writes
+	fmt.Fprint(&c, "\xa9!")
+	if c.chars != 14 || c.words != 3 {
+		t.Errorf("chars, words = %d, %d; want 14, 3", c.chars, c.words)
+	}
+
+	tests := []struct{ chars, words, want int }{
+		{0, 0, 0},
+		{1, 1, 2},
+		{4, 0, 1},
+		{5, 0, 2},
+		{400, 10, 100}, // code: characters dominate
+		{400, 90, 120}, // prose of short words: words dominate
+	}
+	for _, tt := range tests {
+		if got := estimateTokens(tt.chars, tt.words); got != tt.want {
+			t.Errorf("estimateTokens(%d, %d) = %d; want %d", tt.chars, tt.words, got, tt.want)
+		}
+	}
+}
+
+// TestTokenEstimateRange checks the estimate for a short sentence against its actual
+// token count with common tokenizers (10 to 11 tokens).
+func TestTokenEstimateRange(t *testing.T) {
+	var c charCounter
+	fmt.Fprint(&c, "The quick brown fox jumps over the lazy dog.")
+	if got := c.tokens(); got < 8 || got > 14 {
+		t.Errorf("tokens = %d; want between 8 and 14", got)
+	}
+}
+
+// TestTokenSummary checks that per-language and per-file subtotals add up to the file
+// contents total, and that the whole output, with its tree and headings, counts more.
+func TestTokenSummary(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":     strings.Repeat("go code\n", 50),
+		"util/a.go":   "package util\n",
+		"web/app.ts":  strings.Repeat("let x = 1;\n", 20),
+		"README.md":   "# Title\n",
+		"data.xyz":    "???",
+		"logo.png":    strings.Repeat("x", 1000), // skip-content: not dumped, so no tokens
+		"docs/api.md": strings.Repeat("words ", 30),
+	})
+
+	var out strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, Tokens: true}, &out)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	for _, lang := range []string{"go", "typescript", "markdown", ""} {
+		if s.stats.tokensByLanguage[lang] == 0 {
+			t.Errorf("no tokens counted for %q: %v", lang, s.stats.tokensByLanguage)
+		}
+	}
+	if len(s.stats.tokensByLanguage) != 4 {
+		t.Errorf("expected 4 language buckets, got %v", s.stats.tokensByLanguage)
+	}
+	if len(s.stats.tokensByFile) != 6 {
+		t.Errorf("expected 6 files, got %v", s.stats.tokensByFile)
+	}
+	if want := estimateTokens(len("go code\n")*50, 100); s.stats.tokensByFile["main.go"] != want {
+		t.Errorf("main.go tokens = %d; want %d", s.stats.tokensByFile["main.go"], want)
+	}
+
+	var buf strings.Builder
+	printTokenSummary(&buf, s.stats, s.output.tokens())
+	var outputTotal, contentTotal, byLanguage, byFile int
+	section := ""
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		switch {
+		case strings.HasPrefix(line, "Estimated tokens:"):
+			fmt.Sscanf(line, "Estimated tokens: %d", &outputTotal)
+		case strings.HasPrefix(line, "File contents:"):
+			fmt.Sscanf(line, "File contents: %d", &contentTotal)
+			section = "languages"
+		case line == "Largest files:":
+			section = "files"
+		default:
+			fields := strings.Fields(line)
+			var n int
+			if section == "languages" {
+				fmt.Sscan(fields[len(fields)-1], &n)
+				byLanguage += n
+			} else {
+				fmt.Sscan(fields[0], &n)
+				byFile += n
+			}
+		}
+	}
+	if contentTotal == 0 || byLanguage != contentTotal || byFile != contentTotal {
+		t.Errorf("subtotals by language (%d) and by file (%d) should sum to %d; summary:\n%s", byLanguage, byFile, contentTotal, buf.String())
+	}
+	if outputTotal <= contentTotal {
+		t.Errorf("output total %d should exceed the contents total %d; summary:\n%s", outputTotal, contentTotal, buf.String())
+	}
+	if !strings.Contains(buf.String(), "Largest files:\n  "+fmt.Sprintf("%8d", s.stats.tokensByFile["main.go"])+"  main.go\n") {
+		t.Errorf("main.go should be listed first; summary:\n%s", buf.String())
+	}
+}
+
+// TestWordCount checks the word counts of known files, and that the summary reports them
+// in total, per language and per file.
+func TestWordCount(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"docs/guide.md": "# Getting started\n\nRun   the tool,\tthen read\nthe output.\n",
+		"notes.txt":     "one two three",
+		"main.go":       "package main\n",
+	})
+
+	var out, stderr strings.Builder
+	s, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, WordCount: true, Stderr: &stderr}, &out)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	want := map[string]int{"docs/guide.md": 10, "notes.txt": 3, "main.go": 2}
+	for f, n := range want {
+		if got := s.stats.wordsByFile[filepath.FromSlash(f)]; got != n {
+			t.Errorf("words in %s = %d; want %d", f, got, n)
+		}
+	}
+
+	summary := stderr.String()
+	for _, line := range []string{
+		"Words: 15\n",
+		"  markdown           10\n",
+		"  (unknown)           3\n",
+		"  go                  2\n",
+		"Most words:\n        10  " + filepath.FromSlash("docs/guide.md") + "\n         3  notes.txt\n",
+	} {
+		if !strings.Contains(summary, line) {
+			t.Errorf("summary should contain %q:\n%s", line, summary)
+		}
+	}
+}
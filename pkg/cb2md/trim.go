@@ -0,0 +1,91 @@
+package cb2md
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+)
+
+// bodyElided replaces the rest of a function body trimmed by smartTrimGo.
+const bodyElided = "// ... body elided"
+
+// trimKeepLines is how many lines at the start of a trimmed function body are kept.
+const trimKeepLines = 3
+
+// elision is a run of lines smartTrimGo can cut out of a function body: src[start:end],
+// to be replaced by repl.
+type elision struct {
+	start, end int
+	repl       string
+	saved      int // estimated tokens saved
+}
+
+// smartTrimGo trims Go source src down to about budget estimated tokens, if it's over:
+// the imports, types and function signatures are kept, along with the first few lines of
+// each function body, but the rest of the largest bodies is replaced with a
+// "// ... body elided" comment, as many as it takes to fit. Source that doesn't parse is
+// returned as is.
+func smartTrimGo(src []byte, budget int) []byte {
+	total := countTokens(src)
+	if total <= budget {
+		return src
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.SkipObjectResolution)
+	if err != nil {
+		return src
+	}
+
+	// The byte offset of the start of each line, by 1-based line number
+	lineStarts := []int{0, 0}
+	for i, b := range src {
+		if b == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	// Everything in a body past its first lines can go, up to the line of the closing brace
+	var elisions []elision
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		first := fset.Position(fn.Body.Lbrace).Line + 1
+		last := fset.Position(fn.Body.Rbrace).Line
+		if last-first <= trimKeepLines+1 {
+			continue
+		}
+		line := src[lineStarts[first]:lineStarts[first+1]]
+		indent := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]
+		e := elision{
+			start: lineStarts[first+trimKeepLines],
+			end:   lineStarts[last],
+			repl:  string(indent) + bodyElided + "\n",
+		}
+		e.saved = countTokens(src[e.start:e.end]) - countTokens([]byte(e.repl))
+		elisions = append(elisions, e)
+	}
+
+	// Elide the bodies that save the most first, until the rest fits
+	sort.SliceStable(elisions, func(i, j int) bool { return elisions[i].saved > elisions[j].saved })
+	n := 0
+	for n < len(elisions) && total > budget {
+		total -= elisions[n].saved
+		n++
+	}
+	elisions = elisions[:n]
+	sort.Slice(elisions, func(i, j int) bool { return elisions[i].start < elisions[j].start })
+
+	var out bytes.Buffer
+	prev := 0
+	for _, e := range elisions {
+		out.Write(src[prev:e.start])
+		out.WriteString(e.repl)
+		prev = e.end
+	}
+	out.Write(src[prev:])
+	return out.Bytes()
+}
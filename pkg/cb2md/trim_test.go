@@ -0,0 +1,71 @@
+package cb2md
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestSmartTrimGo checks that trimming an oversized Go file keeps the imports and every
+// function signature, and elides the large bodies, but only as many as needed.
+func TestSmartTrimGo(t *testing.T) {
+	var big strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&big, "\ttotal += compute(%d, \"some fairly long argument\")\n", i)
+	}
+	src := "package calc\n\nimport \"fmt\"\n\n" +
+		"// Small is short enough to keep.\nfunc Small() int {\n\treturn 1\n}\n\n" +
+		"func Large() int {\n\ttotal := 0\n" + big.String() + "\treturn total\n}\n\n" +
+		"func (c *Calc) Larger(x int) (int, error) {\n\ttotal := x\n" + big.String() + big.String() + "\treturn total, nil\n}\n\n" +
+		"func compute(i int, s string) int {\n\treturn i + len(fmt.Sprint(s))\n}\n"
+
+	if got := smartTrimGo([]byte(src), countTokens([]byte(src))); string(got) != src {
+		t.Errorf("a file within budget should be left alone, got:\n%s", got)
+	}
+
+	// Eliding the larger body is enough
+	got := string(smartTrimGo([]byte(src), countTokens([]byte(src))*2/3))
+	for _, want := range []string{
+		"import \"fmt\"\n",
+		"func Small() int {\n\treturn 1\n}\n",
+		"func Large() int {\n\ttotal := 0\n" + big.String() + "\treturn total\n}\n",
+		"func (c *Calc) Larger(x int) (int, error) {\n\ttotal := x\n\ttotal += compute(0, \"some fairly long argument\")\n\ttotal += compute(1, \"some fairly long argument\")\n\t// ... body elided\n}\n",
+		"func compute(i int, s string) int {\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("trimmed source missing %q:\n%s", want, got)
+		}
+	}
+
+	// A tight budget elides both
+	got = string(smartTrimGo([]byte(src), 100))
+	if n := strings.Count(got, bodyElided); n != 2 {
+		t.Errorf("expected 2 bodies elided, got %d:\n%s", n, got)
+	}
+	if !strings.Contains(got, "func Large() int {\n") || !strings.Contains(got, "func compute(i int, s string) int {\n\treturn i + len(fmt.Sprint(s))\n}\n") {
+		t.Errorf("signatures and small bodies should be kept:\n%s", got)
+	}
+
+	// Source that doesn't parse is left alone
+	if broken := "package calc\n\nfunc {\n" + big.String(); string(smartTrimGo([]byte(broken), 10)) != broken {
+		t.Errorf("unparsable source should be left alone")
+	}
+}
+
+// TestSmartTrim checks that -smart-trim only applies to Go files.
+func TestSmartTrim(t *testing.T) {
+	body := strings.Repeat("\tx++\n", 200)
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":  "package main\n\nfunc main() {\n\tx := 0\n" + body + "\tprintln(x)\n}\n",
+		"notes.md": "# Notes\n\n" + strings.Repeat("Some notes about the code.\n", 100),
+	})
+
+	got := runOutput(t, tmp, Options{IgnoreFile: ".ignore", Markdown: true, SmartTrim: 100})
+	if want := "```go\npackage main\n\nfunc main() {\n\tx := 0\n\tx++\n\tx++\n\t// ... body elided\n}\n```\n"; !strings.Contains(got, want) {
+		t.Errorf("expected main.go trimmed:\n%s\nwant:\n%s", got, want)
+	}
+	if strings.Count(got, "Some notes about the code.") != 100 {
+		t.Errorf("notes.md should be left alone:\n%s", got)
+	}
+}
@@ -0,0 +1,200 @@
+package cb2md
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Uploader stores a finished output as a blob under key, e.g. in object storage.
+// Options.Uploader takes one to use instead of the one -upload's URL scheme calls for.
+type Uploader interface {
+	Upload(key string, data []byte) error
+}
+
+// newUploader returns the Uploader for an -upload URL, and the key to store the output
+// under. Only s3://bucket/key URLs are supported so far.
+func newUploader(rawURL string) (Uploader, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid -upload URL %q: %w", rawURL, err)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	switch {
+	case u.Scheme != "s3":
+		return nil, "", fmt.Errorf("unsupported -upload URL %q (want s3://bucket/key)", rawURL)
+	case u.Host == "" || key == "":
+		return nil, "", fmt.Errorf("invalid -upload URL %q (want s3://bucket/key)", rawURL)
+	}
+	return newS3Uploader(u.Host), key, nil
+}
+
+// s3Uploader puts objects into an S3 bucket (or an S3-compatible store), signing its
+// requests with AWS Signature Version 4. Credentials and the region come from the usual
+// AWS_* environment variables when uploading.
+type s3Uploader struct {
+	bucket string
+	client *http.Client
+	now    func() time.Time
+}
+
+func newS3Uploader(bucket string) *s3Uploader {
+	return &s3Uploader{bucket: bucket, client: http.DefaultClient, now: time.Now}
+}
+
+// s3Credentials are the AWS credentials and region to sign requests with.
+type s3Credentials struct {
+	accessKey, secretKey, sessionToken string
+	region                             string
+}
+
+// s3CredentialsFromEnv reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and, if set,
+// AWS_SESSION_TOKEN, plus the region from AWS_REGION or AWS_DEFAULT_REGION (us-east-1
+// if neither is set).
+func s3CredentialsFromEnv() (s3Credentials, error) {
+	creds := s3Credentials{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		region:       os.Getenv("AWS_REGION"),
+	}
+	if creds.accessKey == "" || creds.secretKey == "" {
+		return creds, fmt.Errorf("uploading to S3 needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if creds.region == "" {
+		creds.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if creds.region == "" {
+		creds.region = "us-east-1"
+	}
+	return creds, nil
+}
+
+// Upload puts data into the bucket under key. The endpoint is the bucket's virtual host
+// on AWS, or AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL) with the bucket in the path, for
+// S3-compatible stores such as MinIO.
+func (u *s3Uploader) Upload(key string, data []byte) error {
+	creds, err := s3CredentialsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	objectURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", u.bucket, creds.region, s3EscapePath(key))
+	if endpoint != "" {
+		objectURL = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(endpoint, "/"), u.bucket, s3EscapePath(key))
+	}
+
+	req, err := http.NewRequest(http.MethodPut, objectURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	req.Header.Set("Content-Type", contentType)
+	signS3Request(req, data, creds, u.now())
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error uploading to s3://%s/%s: %w", u.bucket, key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("error uploading to s3://%s/%s: %s: %s", u.bucket, key, resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// signS3Request adds the headers of an AWS Signature Version 4 for the S3 request req,
+// whose body is payload, made at time t. Every header already set on req is signed.
+func signS3Request(req *http.Request, payload []byte, creds s3Credentials, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	// The canonical headers: lowercased names, sorted, host included
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + creds.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretKey), day)
+	for _, part := range []string{creds.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		creds.accessKey, scope, signedHeaders, signature))
+}
+
+// s3EscapePath escapes an object key for use in a URL path, as S3 signing expects: every
+// byte but unreserved characters and "/" is percent-encoded.
+func s3EscapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,99 @@
+package cb2md
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// markdownError describes where the Markdown output went wrong.
+type markdownError struct {
+	line    int
+	heading string // the heading the problem is under, if any
+	msg     string
+}
+
+func (e *markdownError) Error() string {
+	if e.heading != "" {
+		return fmt.Sprintf("line %d (under %q): %s", e.line, e.heading, e.msg)
+	}
+	return fmt.Sprintf("line %d: %s", e.line, e.msg)
+}
+
+// validateMarkdown runs a quick sanity check of Markdown output: every code fence must be
+// closed, by a fence of the same character at least as long, and no heading may be more
+// than one level deeper than the heading before it. It returns the first problem found.
+func validateMarkdown(text []byte) error {
+	var (
+		fence          string // the fence of the open code block, if any
+		fenceLine      int
+		heading        string // the last heading seen, for reporting
+		fenceHeading   string
+		level, lineNum int
+	)
+	sc := bufio.NewScanner(bytes.NewReader(text))
+	sc.Buffer(make([]byte, 0, 64*1024), len(text)+1)
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimRight(sc.Text(), "\r")
+
+		// Up to three spaces of indentation are allowed before a fence or a heading
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) > 3 {
+			continue
+		}
+
+		if fence != "" {
+			if isClosingFence(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if f := openingFence(trimmed); f != "" {
+			fence, fenceLine, fenceHeading = f, lineNum, heading
+			continue
+		}
+
+		if n := headingLevel(trimmed); n > 0 {
+			if level > 0 && n > level+1 {
+				return &markdownError{line: lineNum, heading: heading, msg: fmt.Sprintf("heading level %d follows level %d", n, level)}
+			}
+			level, heading = n, strings.TrimSpace(trimmed[n:])
+		}
+	}
+	if fence != "" {
+		return &markdownError{line: fenceLine, heading: fenceHeading, msg: fmt.Sprintf("code fence %s is never closed", fence)}
+	}
+	return sc.Err()
+}
+
+// openingFence returns the fence (three or more backticks or tildes) that line opens a
+// code block with, or "" if it doesn't open one.
+func openingFence(line string) string {
+	if !strings.HasPrefix(line, "```") && !strings.HasPrefix(line, "~~~") {
+		return ""
+	}
+	fence := line[:len(line)-len(strings.TrimLeft(line, line[:1]))]
+	// The info string after a backtick fence can't have backticks of its own
+	if fence[0] == '`' && strings.Contains(line[len(fence):], "`") {
+		return ""
+	}
+	return fence
+}
+
+// isClosingFence reports whether line closes a code block opened with fence: a run of the
+// same character, at least as long, followed by nothing but spaces.
+func isClosingFence(line, fence string) bool {
+	rest := strings.TrimLeft(line, fence[:1])
+	return len(line)-len(rest) >= len(fence) && strings.TrimSpace(rest) == ""
+}
+
+// headingLevel returns the level of the ATX heading on line, or 0 if it isn't one.
+func headingLevel(line string) int {
+	n := len(line) - len(strings.TrimLeft(line, "#"))
+	if n == 0 || n > 6 || n < len(line) && line[n] != ' ' && line[n] != '\t' {
+		return 0
+	}
+	return n
+}
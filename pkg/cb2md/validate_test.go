@@ -0,0 +1,70 @@
+package cb2md
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestValidateMarkdown checks the fence and heading checks on hand-written Markdown.
+func TestValidateMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		line int // of the expected error, or 0 for none
+	}{
+		{"balanced", "## Full File List\n\n### a.md\n````markdown\n```go\nx\n```\n````\n", 0},
+		{"tildes", "~~~\n```\n~~~~\n", 0},
+		{"closing fence with spaces", "```go\nx\n```  \n", 0},
+		{"info string is not a closing fence", "```\nx\n```go\n", 1},
+		{"shorter fence does not close", "### a.md\n````\n```\n", 2},
+		{"fence in file content", "### a.md\n```markdown\n```go\nx\n```\n```\n", 6},
+		{"heading skips a level", "# Title\n\n### a.go\n", 3},
+		{"hash without space is no heading", "## List\n\n#### \n#tag\n", 3},
+		{"headings in code are ignored", "## List\n```\n#### not a heading\n```\n", 0},
+		{"indented code is ignored", "## List\n    ```\n", 0},
+	}
+	for _, tt := range tests {
+		err := validateMarkdown([]byte(tt.text))
+		var mdErr *markdownError
+		switch {
+		case tt.line == 0 && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.line != 0 && !errors.As(err, &mdErr):
+			t.Errorf("%s: expected an error at line %d, got %v", tt.name, tt.line, err)
+		case tt.line != 0 && mdErr.line != tt.line:
+			t.Errorf("%s: error at line %d (%v); want line %d", tt.name, mdErr.line, err, tt.line)
+		}
+	}
+}
+
+// TestValidate checks that a file full of fences doesn't break the output, thanks to the
+// longer fence around it, and that -validate would have caught it otherwise.
+func TestValidate(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"docs/fences.md": "Usage:\n\n```\n$ cb2md -o tree.md .\n",
+	})
+
+	outFile := filepath.Join(t.TempDir(), "tree.md")
+	if _, err := run(tmp, Options{IgnoreFile: ".ignore", Markdown: true, OutFile: outFile, Validate: true}, os.Stdout); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	got, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !strings.Contains(string(got), "````markdown\n") {
+		t.Errorf("expected the file in a four-backtick fence:\n%s", got)
+	}
+
+	// The same output with the usual three-backtick fence is caught
+	naive := strings.Replace(string(got), "````markdown\n", "```markdown\n", 1)
+	naive = strings.Replace(naive, "\n````\n", "\n```\n", 1)
+	err = validateMarkdown([]byte(naive))
+	if err == nil || !strings.Contains(err.Error(), "never closed") {
+		t.Errorf("expected an unclosed fence in:\n%s\ngot error %v", naive, err)
+	}
+}
@@ -0,0 +1,99 @@
+package cb2md
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlEscaper escapes text for use in XML element content and attribute values.
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// printTreeXML prints the tree below root inside a <directory_structure> element.
+func printTreeXML(w io.Writer, root *Node, opts Options) {
+	var tree strings.Builder
+	printTree(root, "", true, &tree, opts)
+	fmt.Fprintln(w, "<directory_structure>")
+	fmt.Fprint(w, xmlEscaper.Replace(tree.String()))
+	fmt.Fprintln(w, "</directory_structure>")
+}
+
+// printFileListXML is printFileList for -format=xml: each file becomes a <file> element
+// with its path (and language, when known) as attributes. The contents go in a CDATA
+// section, so they are kept verbatim, whatever tags they contain; only a "]]>" inside has
+// to be split across two sections. Files whose contents are omitted get an empty element
+// saying why.
+func (s *scan) printFileListXML(w io.Writer, files []string) {
+	opts := s.opts
+	for i, fpath := range files {
+		if i > 0 {
+			printDelimiter(w, opts)
+		}
+		if s.marks != nil {
+			s.marks.start()
+		}
+		language := s.fileLanguage(fpath)
+		attrs := fmt.Sprintf(` path="%s"`, xmlEscaper.Replace(s.shownPath(fpath)))
+		if language != "" {
+			attrs += fmt.Sprintf(` language="%s"`, language)
+		}
+
+		fmt.Fprintln(w)
+		if opts.ListOnly {
+			fmt.Fprintf(w, "<file%s/>\n", attrs)
+			continue
+		}
+
+		// Files a filter left out are only there to say so
+		if s.filtered[fpath] {
+			fmt.Fprintf(w, "<file%s omitted=\"content excluded by filter\"/>\n", attrs)
+			continue
+		}
+
+		// Files whose content we skip only get a short hex dump
+		if opts.HexPreview && s.contentSkipped[fpath] {
+			var dump bytes.Buffer
+			err := printHexPreview(s.absPath(fpath), &dump)
+			fmt.Fprintf(w, "<file%s preview=\"hex\">\n", attrs)
+			writeCDATA(w, dump.Bytes(), err)
+			fmt.Fprintln(w, "</file>")
+			continue
+		}
+		if s.contentSkipped[fpath] {
+			fmt.Fprintf(w, "<file%s omitted=\"skip-content file\"/>\n", attrs)
+			continue
+		}
+
+		if size := s.fileSize(fpath); opts.LargeWarning > 0 && size > opts.LargeWarning {
+			attrs += fmt.Sprintf(` warning="large file (%s)"`, formatSize(size))
+		}
+
+		content, err := s.fileContent(fpath, language)
+		if reason := s.omittedReason(err); reason != "" {
+			fmt.Fprintf(w, "<file%s omitted=\"%s\"/>\n", attrs, xmlEscaper.Replace(reason))
+			continue
+		}
+
+		if opts.PathComment {
+			if comment := pathComment(fpath, language); comment != "" {
+				content = append([]byte(comment+"\n"), content...)
+			}
+		}
+		content = s.escapeDelimiter(fpath, content)
+		fmt.Fprintf(w, "<file%s>\n", attrs)
+		writeCDATA(w, content, err)
+		fmt.Fprintln(w, "</file>")
+	}
+}
+
+// writeCDATA writes content, which ends in a newline unless empty, as a CDATA section on
+// lines of its own, followed by an <error> element if err isn't nil.
+func writeCDATA(w io.Writer, content []byte, err error) {
+	fmt.Fprintln(w, "<![CDATA[")
+	fmt.Fprintf(w, "%s", bytes.ReplaceAll(content, []byte("]]>"), []byte("]]]]><![CDATA[>")))
+	fmt.Fprintln(w, "]]>")
+	if err != nil {
+		fmt.Fprintf(w, "<error>%s</error>\n", xmlEscaper.Replace(err.Error()))
+	}
+}
@@ -0,0 +1,58 @@
+package cb2md
+
+import (
+	"encoding/xml"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFormats checks the Markdown and XML output for the same fixture, including content
+// that would close the tags or the CDATA section early.
+func TestFormats(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"main.go":    "package main\n",
+		"tricky.txt": "a < b && </file> ]]> done\n",
+	})
+	root := filepath.Base(tmp)
+
+	mdOut, xmlOut := readOutput(t, tmp, "md"), readOutput(t, tmp, "xml")
+
+	wantMD := "```\n" +
+		"└── " + root + "\n" +
+		"    ├── main.go\n" +
+		"    └── tricky.txt\n" +
+		"```\n\n" +
+		"## Full File List\n\n" +
+		"### main.go\n```go\npackage main\n```\n\n" +
+		"### tricky.txt\n```\na < b && </file> ]]> done\n```\n\n"
+	if mdOut != wantMD {
+		t.Errorf("md output:\n%s\nwant:\n%s", mdOut, wantMD)
+	}
+
+	wantXML := "<directory_structure>\n" +
+		"└── " + root + "\n" +
+		"    ├── main.go\n" +
+		"    └── tricky.txt\n" +
+		"</directory_structure>\n" +
+		"\n<file path=\"main.go\" language=\"go\">\n<![CDATA[\npackage main\n]]>\n</file>\n" +
+		"\n<file path=\"tricky.txt\">\n<![CDATA[\na < b && </file> ]]]]><![CDATA[> done\n]]>\n</file>\n"
+	if xmlOut != wantXML {
+		t.Errorf("xml output:\n%s\nwant:\n%s", xmlOut, wantXML)
+	}
+
+	// The XML output is well-formed, and the contents survive a round trip
+	var doc struct {
+		Files []struct {
+			Path    string `xml:"path,attr"`
+			Content string `xml:",chardata"`
+		} `xml:"file"`
+	}
+	if err := xml.Unmarshal([]byte("<root>"+xmlOut+"</root>"), &doc); err != nil {
+		t.Fatalf("xml output doesn't parse: %v", err)
+	}
+	if len(doc.Files) != 2 || strings.TrimSpace(doc.Files[1].Content) != "a < b && </file> ]]> done" {
+		t.Errorf("unexpected files after parsing: %+v", doc.Files)
+	}
+}
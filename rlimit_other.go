@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// defaultMaxOpen returns the default for -max-open: 0 (no limit), as there's no limit on
+// open files to derive it from here.
+func defaultMaxOpen() int {
+	return 0
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// defaultMaxOpen returns the default for -max-open: half the soft limit on open files, to
+// leave room for everything else the process has open, or 0 (no limit) if it's unknown or
+// too large to matter.
+func defaultMaxOpen() int {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil || lim.Cur > 1<<20 {
+		return 0
+	}
+	return max(int(lim.Cur/2), 1)
+}